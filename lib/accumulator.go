@@ -1,25 +1,43 @@
 package lib
 
 import (
+	"math/rand"
 	"sync"
+	"time"
 )
 
+//Accumulator summarises response stats as they arrive, overall, for each label and for each second of the test.
+//Raw stats are only kept for the SampleRate fraction of requests, 1 keeps every request and 0 keeps none.
 type Accumulator struct {
 	mu *sync.Mutex
-	Stats []ResponseStats
-	OverallStats []OverallStats
+	Summary *StatsSummary
+	LabelSummaries map[string]*StatsSummary
+	Windows []*StatsWindow
+	Series *TimeSeries
+	Samples []ResponseStats
+	SampleRate float64
+	Overall OverallSummary
 	MaxResponses int
 
+	//Done is closed once MaxResponses stats have been received
 	Done chan bool
+	doneOnce sync.Once
 
 	StatsChan chan ResponseStats
 	OverallStatsChan chan OverallStats
+
+	//receiving counts the goroutines still receiving on the stats channels
+	receiving sync.WaitGroup
 }
 
-func NewAccumulator(maxResponses int, statsChan chan ResponseStats, overallStatsChan chan OverallStats) *Accumulator {
+func NewAccumulator(maxResponses int, sampleRate float64, percentiles []float64, statsChan chan ResponseStats, overallStatsChan chan OverallStats) *Accumulator {
 	newAccumulator := &Accumulator{
 		Done : make(chan bool),
 		mu : &sync.Mutex{},
+		Summary : NewStatsSummary(),
+		LabelSummaries : make(map[string]*StatsSummary),
+		Series : NewTimeSeries(time.Now(), percentiles),
+		SampleRate : sampleRate,
 		StatsChan : statsChan,
 		OverallStatsChan : overallStatsChan,
 		MaxResponses : maxResponses,
@@ -28,25 +46,129 @@ func NewAccumulator(maxResponses int, statsChan chan ResponseStats, overallStats
 	return newAccumulator
 }
 
-//Start will create a go routine to listen on channel for new stats
+//Start will create a go routine to listen on channel for new stats, they exit once the channels are closed
 func (a *Accumulator)Start(){
+	a.receiving.Add(2)
 	go func() {
+		defer a.receiving.Done()
 		for stats := range a.StatsChan {
 			a.mu.Lock()
-			a.Stats = append(a.Stats, stats)
+			a.Record(stats)
+			received := a.Summary.Requests
 			a.mu.Unlock()
-			if ( len(a.Stats) >= a.MaxResponses) {
-				Log("top", "All requests received")
-				a.Done <- true
+			if ( received >= a.MaxResponses) {
+				a.doneOnce.Do(func() {
+					Log("top", "All requests received")
+					close(a.Done)
+				})
 			}
 		}
 	}()
 
 	go func() {
+		defer a.receiving.Done()
 		for stats := range a.OverallStatsChan {
-			a.mu.Lock()
-			a.OverallStats = append(a.OverallStats, stats)
-			a.mu.Unlock()
+			a.AddOverallStats(stats)
 		}
 	}()
 }
+
+//Wait returns once the stats channels have been closed and every stat sent on them has been recorded
+func (a *Accumulator) Wait() {
+	a.receiving.Wait()
+}
+
+func (a *Accumulator) AddOverallStats(stats OverallStats) {
+	a.mu.Lock()
+	a.Overall.Record(stats)
+	a.Series.RecordOverall(stats, time.Now())
+	a.mu.Unlock()
+}
+
+//Record adds stats to the overall summary, the summary of its label (and the labels of a chain's steps), the time series and any window it falls in, mu must be held
+func (a *Accumulator) Record(stats ResponseStats) {
+	a.Summary.Record(stats)
+	a.Series.Record(stats)
+	a.labelSummary(stats.Label).Record(stats)
+	for _, step := range stats.Steps {
+		a.labelSummary(step.Label).Record(step)
+	}
+
+	for _, window := range a.Windows {
+		if (window.Contains(stats)) {
+			window.Summary.Record(stats)
+		}
+	}
+
+	if (a.SampleRate >= 1 || (a.SampleRate > 0 && rand.Float64() < a.SampleRate)) {
+		a.Samples = append(a.Samples, stats)
+	}
+}
+
+func (a *Accumulator) labelSummary(label string) *StatsSummary {
+	summary, ok := a.LabelSummaries[label]
+	if (!ok) {
+		summary = NewStatsSummary()
+		a.LabelSummaries[label] = summary
+	}
+	return summary
+}
+
+//Received is the number of response stats received so far
+func (a *Accumulator) Received() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Summary.Requests
+}
+
+//Snapshot copies the summaries so they can be analysed while more stats arrive
+func (a *Accumulator) Snapshot() (summary *StatsSummary, labelSummaries map[string]*StatsSummary, samples []ResponseStats, overall OverallSummary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	labelSummaries = make(map[string]*StatsSummary)
+	for label, labelSummary := range a.LabelSummaries {
+		labelSummaries[label] = labelSummary.Copy()
+	}
+	return a.Summary.Copy(), labelSummaries, a.Samples, a.Overall
+}
+
+//CurrentSummary copies just the overall summary, for when the label summaries and samples aren't needed
+func (a *Accumulator) CurrentSummary() *StatsSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Summary.Copy()
+}
+
+//Timeline copies the last limit per second buckets up to now, or all of them when limit isn't positive, along with the stats of the rolling window
+func (a *Accumulator) Timeline(limit int) (buckets []MetricsBucket, rolling RollingStats) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Series.Snapshot(time.Now(), limit)
+}
+
+//AddWindow starts summarising the stats of requests meant to be sent between start and end, until the window is removed
+func (a *Accumulator) AddWindow(start time.Time, end time.Time) *StatsWindow {
+	window := &StatsWindow{
+		Start : start,
+		End : end,
+		Summary : NewStatsSummary(),
+	}
+	a.mu.Lock()
+	a.Windows = append(a.Windows, window)
+	a.mu.Unlock()
+	return window
+}
+
+//RemoveWindow stops summarising stats into the window and returns a copy of its summary
+func (a *Accumulator) RemoveWindow(window *StatsWindow) *StatsSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for index, candidate := range a.Windows {
+		if (candidate == window) {
+			a.Windows = append(a.Windows[:index], a.Windows[index+1:]...)
+			break
+		}
+	}
+	return window.Summary.Copy()
+}
@@ -3,7 +3,6 @@ package lib
 import (
 	"time"
 	"fmt"
-	"sort"
 	"math"
 	"sync"
 )
@@ -12,9 +11,13 @@ type Analyser struct {
 	Frequency time.Duration
 	Ticker *time.Ticker
 	ThroughputTicker *time.Ticker
+	//quit is closed to stop the ticker goroutines, ticking counts those that haven't exited
+	quit chan bool
+	ticking sync.WaitGroup
 	Accumulator *Accumulator
 	StatsChan chan AggregatedStats
 	Percentiles []float64
+	Labels []string
 
 	Harvest float64
 	Yield float64
@@ -26,18 +29,30 @@ type Analyser struct {
 
 	CalculateRate bool
 
-	Fail chan bool
+	//Search is set when the test is a capacity search, its levels are included in the aggregated stats
+	Search *CapacitySearch
 
 	mu sync.Mutex
 	ThroughputBytes []float64
 	ThroughputResps []float64
+
+	//Latest is the most recent analysis, set before it's sent on StatsChan
+	Latest AggregatedStats
+
+	lastThroughputTime time.Time
+	lastThroughputResponses int
+	lastThroughputBytes int
 }
 
 const throughputFrequency = time.Millisecond * 500
 
+//liveTimelineBuckets is how many seconds of the timeline are sent while the test runs, the final analysis sends all of it
+const liveTimelineBuckets = 300
+
 type AggregatedStats struct {
+	//RawStats are the stats kept by the accumulator's sampling, by default none are kept
 	RawStats []ResponseStats
-	OverallStats []OverallStats
+	Overall OverallSummary
 
 	StartTime time.Time
 	TotalTestDuration time.Duration
@@ -47,9 +62,21 @@ type AggregatedStats struct {
 	TotalRequests int
 	TotalResponses int
 	TotalValidResponses int
+	WrongStatusResponses int
 	AvgConcurrentExecutors int
 	MaxConcurrentExecutors int
 
+	//Open model scheduling, see Spawner.StartScheduledRequests
+	RequestsScheduled int
+	RequestsDelayed int
+	RequestsDropped int
+	MeanDelay time.Duration
+
+	//The rate and concurrency the load profile was aiming for on the latest tick, and the rate actually achieved
+	TargetRate float64
+	AchievedRate float64
+	TargetConcurrency int
+
 	Yield float64
 	Harvest float64
 
@@ -73,11 +100,22 @@ type AggregatedStats struct {
 	TimeToConnectPercentiles []time.Duration
 	MaxTimeToConnect time.Duration
 
+	//Response times are measured from when each request was meant to be sent, correcting for coordinated omission.
+	//The TotalTime stats above are service times, measured from when each request was actually sent.
+	ResponseTimePercentiles []time.Duration
+	MaxResponseTime time.Duration
+	MeanResponseTime time.Duration
+
+	//Phases breaks latencies down into DNS lookup, TCP connect, TLS handshake, time to first byte and transfer
+	Phases []PhaseStats
+	ConnectionsReused int
+
 	Failures int
 	RespFailures int
 	ValidationFailures int
-	FailureCounts map[string][]DescriptiveError
+	FailureCounts map[string]FailureCount
 
+	//Values spread through each latency distribution, for drawing histograms
 	TimeToRespond []float64
 	TimeToConnect []float64
 	TotalTime []float64
@@ -86,13 +124,29 @@ type AggregatedStats struct {
 	OverallFailureDescription string
 
 	Rate float64
+
+	Endpoints []EndpointStats
+
+	//Buckets breaks the test down second by second, only the latest seconds of it until the final analysis, and Rolling covers the last few seconds, the rest of the stats are cumulative
+	Buckets []MetricsBucket
+	Rolling RollingStats
+
+	SearchLevels []SearchLevel
+	SearchSummary string
 }
 
 func NewAnalyser(acc *Accumulator, reqOpts RequestOptions, calcRate bool) (*Analyser) {
+	labels := []string{}
+	for _, definition := range reqOpts.Requests {
+		labels = append(labels, definition.Labels()...)
+	}
+
 	analyser := &Analyser{
+		Labels : labels,
 		Accumulator : acc,
 		Frequency : reqOpts.AnalaysisFreqTime,
 		StatsChan : make(chan AggregatedStats),
+		quit : make(chan bool),
 		Percentiles : reqOpts.Percentiles,
 		WarmUpTime : reqOpts.WarmUpTime,
 		CalculateRate : calcRate,
@@ -115,78 +169,125 @@ func (a *Analyser) Start() {
 }
 
 func (a *Analyser) SetupAnalysis() {
+	a.ticking.Add(2)
 	go func() {
-		for _ = range a.Ticker.C {
-			if (time.Now().After(a.StartTime.Add(a.WarmUpTime))) {
-				a.Analyse()
+		defer a.ticking.Done()
+		for {
+			select {
+			case <- a.Ticker.C:
+				if (time.Now().After(a.StartTime.Add(a.WarmUpTime))) {
+					a.Analyse()
+				}
+			case <- a.quit:
+				return
 			}
 		}
 	}()
 
 	//Calculate throughput (occurs at different rate than overall analysis)
 	go func() {
-		for _ = range a.ThroughputTicker.C {
-			if (time.Now().After(a.StartTime.Add(a.WarmUpTime))) {
-				a.SetThroughput()
+		defer a.ticking.Done()
+		for {
+			select {
+			case <- a.ThroughputTicker.C:
+				if (time.Now().After(a.StartTime.Add(a.WarmUpTime))) {
+					a.SetThroughput()
+				}
+			case <- a.quit:
+				return
 			}
 		}
 	}()
 }
 
+//Stop stops the periodic analysis and waits for an analysis in progress to be sent
 func (a *Analyser) Stop() {
 	a.Ticker.Stop()
 	a.ThroughputTicker.Stop()
+	close(a.quit)
+	a.ticking.Wait()
 }
 
+//Cleanup performs the final analysis once the analyser has stopped, then closes StatsChan as nothing more will be sent
 func (a *Analyser) Cleanup() {
 	a.SetThroughput()
-	a.Analyse()
+	a.analyse(0)
+	close(a.StatsChan)
 }
 
+//Analyse sends the stats so far, with the timeline cut down to the latest seconds so each analysis costs the same however long the test runs
 func (a *Analyser) Analyse() {
-	if (len(a.Accumulator.OverallStats) == 0 || len(a.Accumulator.Stats) == 0) {
+	a.analyse(liveTimelineBuckets)
+}
+
+//analyse sends the stats so far with the last timelineBuckets seconds of the timeline, or all of it when timelineBuckets isn't positive
+func (a *Analyser) analyse(timelineBuckets int) {
+	summary, labelSummaries, samples, overall := a.Accumulator.Snapshot()
+	if (overall.Count == 0 || summary.Requests == 0) {
 		return
 	}
 
 	now := time.Now()
 
 	stats := AggregatedStats{
-		Rate : a.Accumulator.OverallStats[len(a.Accumulator.OverallStats) - 1].Rate,
-		RawStats : a.Accumulator.Stats,
-		OverallStats : a.Accumulator.OverallStats,
+		Rate : overall.Latest.Rate,
+		RawStats : samples,
+		Overall : overall,
 		Percentiles : a.Percentiles,
 	}
 
-	stats.StartTime, stats.TimeElapsed, stats.TotalTestDuration, stats.TimeWaitingOnFinalReqs = DetermineOverallTimes(stats.OverallStats)
+	stats.StartTime, stats.TimeElapsed, stats.TotalTestDuration, stats.TimeWaitingOnFinalReqs = DetermineOverallTimes(stats.Overall)
+
+	stats.TimeToConnectPercentiles, stats.TimeToRespondPercentiles, stats.TotalTimePercentiles = DeterminePercentilesLatencies(stats.Percentiles, summary)
 
-	stats.TimeToConnectPercentiles, stats.TimeToRespondPercentiles, stats.TotalTimePercentiles = DeterminePercentilesLatencies(stats.Percentiles, stats.RawStats)
+	stats.MaxTotalTime, stats.MaxTimeToRespond, stats.MaxTimeToConnect = DetermineMaxLatencies(summary)
 
-	stats.MaxTotalTime, stats.MaxTimeToRespond, stats.MaxTimeToConnect = DetermineMaxLatencies(stats.RawStats)
+	stats.MinTotalTime = time.Duration(summary.TotalTime.Min)
 
-	stats.MinTotalTime = DetermineMinLatencies(stats.RawStats)
+	stats.MeanTotalTime = summary.TotalTime.Mean()
 
-	stats.MeanTotalTime = MeanLatencies(stats.RawStats)
+	stats.ResponseTimePercentiles, stats.MaxResponseTime, stats.MeanResponseTime = DetermineResponseTimeLatencies(stats.Percentiles, summary)
 
-	stats.AvgConcurrentExecutors = AverageConcurrency(stats.OverallStats)
+	stats.Phases, stats.ConnectionsReused = DeterminePhaseStats(stats.Percentiles, summary)
 
-	stats.MaxConcurrentExecutors = MaxConcurrency(stats.OverallStats)
+	stats.AvgConcurrentExecutors = AverageConcurrency(stats.Overall)
 
-	stats.Failures, stats.FailureCounts = GroupFailures(stats.RawStats)
+	stats.MaxConcurrentExecutors = MaxConcurrency(stats.Overall)
 
-	stats.TimeToRespond, stats.TimeToConnect, stats.TotalTime = extractLatencies(stats.RawStats)
+	stats.Failures, stats.FailureCounts = summary.Failures, summary.FailureCounts
 
-	stats.TotalResponses = NumResponses(stats.RawStats)
-	stats.TotalRequests = stats.OverallStats[len(stats.OverallStats) - 1].RequestsIssued
+	stats.TimeToRespond, stats.TimeToConnect, stats.TotalTime = extractLatencies(summary)
+
+	stats.TotalResponses = summary.Responses
+	stats.TotalRequests = overall.Latest.RequestsIssued
+	//The latest overall stats can trail the responses received, and every response was issued
+	if (summary.Requests > stats.TotalRequests) {
+		stats.TotalRequests = summary.Requests
+	}
+
+	stats.TargetRate, stats.AchievedRate, stats.TargetConcurrency = overall.Latest.TargetRate, overall.Latest.AchievedRate, overall.Latest.TargetConcurrency
+
+	stats.RequestsScheduled, stats.RequestsDelayed, stats.RequestsDropped, stats.MeanDelay = SchedulingDelays(overall.Latest)
 
 	if (a.CalculateRate) {
 		stats.Rate = float64(stats.TotalRequests) / stats.TimeElapsed.Seconds()
 	}
 
-	stats.TotalValidResponses = ValidResponses(stats.RawStats)
+	stats.TotalValidResponses = summary.ValidResponses
+	stats.WrongStatusResponses = summary.WrongStatusResponses
 
 	stats.Harvest = Harvest(stats.TotalResponses, stats.TotalRequests)
 	stats.Yield = Yield(stats.TotalResponses, stats.TotalValidResponses)
 
+	if (a.Search != nil) {
+		stats.SearchLevels, stats.SearchSummary = a.Search.Results()
+	}
+
+	stats.Buckets, stats.Rolling = a.Accumulator.Timeline(timelineBuckets)
+
+	stats.Endpoints = DetermineEndpointStats(a.Labels, stats.Percentiles, labelSummaries, overall.Latest.RequestsIssuedByLabel)
+
+	a.mu.Lock()
 	if( len(a.ThroughputBytes) != 0 ) {
 		stats.LatestByteThroughput = a.ThroughputBytes[len(a.ThroughputBytes) - 1]
 		stats.LatestRespThroughput = a.ThroughputResps[len(a.ThroughputResps) - 1]
@@ -196,9 +297,14 @@ func (a *Analyser) Analyse() {
 
 		stats.AverageByteThroughput, stats.AverageRespThroughput = a.AvgThroughput()
 	}
+	a.mu.Unlock()
 
 	stats.OverallFailure, stats.OverallFailureDescription = Failure(stats, a.Harvest, a.Yield, a.RespThroughput, a.PercentilesLatencies)
 
+	a.mu.Lock()
+	a.Latest = stats
+	a.mu.Unlock()
+
 	calcTime := time.Since(now)
 	Log("analyse", fmt.Sprintln(stats.TotalResponses," valid responses received, ", stats.TotalRequests, " requests issued"))
 	Log("analyse", fmt.Sprintln("Sending to stats channel, performed analysis in ",calcTime))
@@ -206,28 +312,37 @@ func (a *Analyser) Analyse() {
 	a.StatsChan <- stats
 }
 
+//LatestStats returns the most recent analysis, after Cleanup this covers the whole test
+func (a *Analyser) LatestStats() AggregatedStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Latest
+}
+
 func (a *Analyser) SetThroughput() {
 	a.mu.Lock()
-	throughputBytes, throughputReqs := a.Throughput(a.Accumulator.Stats)
+	throughputBytes, throughputReqs := a.Throughput()
 	a.ThroughputBytes = append(a.ThroughputBytes, throughputBytes)
 	a.ThroughputResps = append(a.ThroughputResps, throughputReqs)
 	a.mu.Unlock()
 }
 
-func (a *Analyser) Throughput(stats []ResponseStats) (byteRate float64, respRate float64) {
-	totalBytes := 0
-	totalResponses := 0
+//Throughput works out the rate of responses and response bytes since it was last called, mu must be held
+func (a *Analyser) Throughput() (byteRate float64, respRate float64) {
+	a.Accumulator.mu.Lock()
+	responses, responseBytes := a.Accumulator.Summary.Responses, a.Accumulator.Summary.ResponseBytes
+	a.Accumulator.mu.Unlock()
+
 	now := time.Now()
-	lastInterval := now.Add(-throughputFrequency)
-	for _, stat := range stats {
-		if DoAnalysis(stat) && stat.FinishTime.After(lastInterval) && stat.FinishTime.Before(now) {
-			totalBytes += len([]byte(stat.RespPayload))
-			totalResponses += 1
-		}
+	interval := now.Sub(a.lastThroughputTime)
+	if (a.lastThroughputTime.IsZero() || interval <= 0) {
+		interval = throughputFrequency
 	}
 
-	byteRate = float64(totalBytes) / throughputFrequency.Seconds()
-	respRate = float64(totalResponses) / throughputFrequency.Seconds()
+	byteRate = float64(responseBytes - a.lastThroughputBytes) / interval.Seconds()
+	respRate = float64(responses - a.lastThroughputResponses) / interval.Seconds()
+
+	a.lastThroughputTime, a.lastThroughputResponses, a.lastThroughputBytes = now, responses, responseBytes
 	return byteRate, respRate
 }
 
@@ -250,201 +365,107 @@ func Harvest(numResponses int, numRequests int) float64 {
 	return float64(numResponses)/float64(numRequests) * 100
 }
 
-func ValidResponses(stats []ResponseStats) int {
-	validResponses := 0
-	for _, stat := range stats {
-		if (!stat.Failure()) {
-			validResponses += 1
-		}
-	}
-	return validResponses
-}
-
 func Yield(numResponses int, validResponses int) float64 {
 	if (numResponses == 0) { return 0.0}
 	return float64(validResponses)/float64(numResponses) * 100
 }
 
-func NumResponses(stats []ResponseStats) int {
-	numResponses := 0
-	for _, stat := range stats {
-		containsResponse := true
-		for _, failure := range stat.Failures {
-			if _, ok := failure.(RequestExecutionError); ok {
-				containsResponse = false
-			}
-			if _, ok := failure.(StatusCodeError); ok {
-				containsResponse = false
-			}
+//ContainsResponse is false when one of the failures means a response was never received, a response with the wrong status code still counts
+func ContainsResponse(stat ResponseStats) bool {
+	for _, failure := range stat.Failures {
+		if _, ok := failure.(RequestExecutionError); ok {
+			return false
 		}
-		if (containsResponse) {
-			numResponses += 1
+		if scriptErr, ok := failure.(ScriptError); ok && scriptErr.Hook != "after" {
+			return false
 		}
 	}
-	return numResponses
+	return true
 }
 
-func DetermineOverallTimes(overallStats []OverallStats) (startTime time.Time, timeElapsed time.Duration, totalTestDuration time.Duration, timeWaitingOnFinalReqs time.Duration)  {
-	if (len(overallStats) == 0 ) { return time.Now(), time.Nanosecond, time.Nanosecond, time.Nanosecond}
+func DetermineOverallTimes(overall OverallSummary) (startTime time.Time, timeElapsed time.Duration, totalTestDuration time.Duration, timeWaitingOnFinalReqs time.Duration)  {
+	if (overall.Count == 0 ) { return time.Now(), time.Nanosecond, time.Nanosecond, time.Nanosecond}
 
-	latestStat := overallStats[len(overallStats)-1]
+	latestStat := overall.Latest
 	return latestStat.StartTime, latestStat.TimeElapsed, latestStat.TotalTestDuration, latestStat.TimeWaitingOnFinalReqs
 }
 
-func AverageConcurrency(stats []OverallStats) int {
-	if (len(stats) == 0 ) { return 0}
-	total := 0
-	for _, stat := range stats {
-		total += stat.NumExecutors
-	}
-	return int( math.Ceil( float64(total / len(stats)) ) )
+func AverageConcurrency(overall OverallSummary) int {
+	if (overall.Count == 0 ) { return 0}
+	return int( math.Ceil( float64(overall.TotalExecutors / overall.Count) ) )
 }
 
-func MaxConcurrency(stats []OverallStats) int {
-	if (len(stats) == 0 ) { return 0}
-	max := 0
-	for _, stat := range stats {
-		if (stat.NumExecutors > max) {
-			max = stat.NumExecutors
-		}
-	}
-	return max
+func MaxConcurrency(overall OverallSummary) int {
+	return overall.MaxExecutors
 }
 
-func GroupFailures(stats []ResponseStats) (failures int, failureGroups map[string][]DescriptiveError) {
-	failureGroups = make(map[string][]DescriptiveError)
-	for _, stat := range stats {
-		if stat.Failure() {
-			for _, failure := range stat.Failures {
-				if fails, ok := failureGroups[failure.Error()]; ok {
-					failureGroups[failure.Error()] = append(fails, failure)
-				} else {
-					failureGroups[failure.Error()] = []DescriptiveError{failure}
-				}
-			}
-			failures += 1
-		}
+//SchedulingDelays returns how many scheduled requests were delayed or dropped and how long delayed requests waited on average
+func SchedulingDelays(stat OverallStats) (scheduled int, delayed int, dropped int, meanDelay time.Duration) {
+	if (stat.RequestsDelayed > 0) {
+		meanDelay = stat.TotalDelay / time.Duration(stat.RequestsDelayed)
 	}
-	return
+	return stat.RequestsScheduled, stat.RequestsDelayed, stat.RequestsDropped, meanDelay
 }
 
-func DoAnalysis(stat ResponseStats) bool {
+//WrongStatus is true when one of the failures is a status code that wasn't expected, the request still got a response
+func WrongStatus(stat ResponseStats) bool {
 	for _, failure := range stat.Failures {
-		if _, ok := failure.(RequestExecutionError); ok {
-			return false
-		}
 		if _, ok := failure.(StatusCodeError); ok {
-			return false
+			return true
 		}
 	}
-	return true
+	return false
 }
 
-func DetermineMaxLatencies(stats []ResponseStats) (maxTotalTime time.Duration, maxTimeToRespond time.Duration, maxTimeToConnect time.Duration) {
-	maxTotalTimeInt := int64(0)
-	maxTimeToRespondInt := int64(0)
-	maxTimeToConnectInt := int64(0)
-	for _, stat := range stats {
-		if (!DoAnalysis(stat)) { continue }
-
-		if (stat.TotalTime.Nanoseconds() > maxTotalTimeInt) {
-			maxTotalTimeInt = stat.TotalTime.Nanoseconds()
-		}
-
-		if (stat.TimeToConnect.Nanoseconds() > maxTimeToConnectInt) {
-			maxTimeToConnectInt = stat.TimeToConnect.Nanoseconds()
-		}
-
-		if (stat.TimeToRespond.Nanoseconds() > maxTimeToRespondInt) {
-			maxTimeToRespondInt = stat.TimeToRespond.Nanoseconds()
-		}
-	}
-
-	maxTotalTime = time.Duration(maxTotalTimeInt) * time.Nanosecond
-	maxTimeToConnect = time.Duration(maxTimeToConnectInt) * time.Nanosecond
-	maxTimeToRespond = time.Duration(maxTimeToRespondInt) * time.Nanosecond
-	return
+func DoAnalysis(stat ResponseStats) bool {
+	return ContainsResponse(stat)
 }
 
-func DetermineMinLatencies(stats []ResponseStats) (minTotalTime time.Duration) {
-	minTotalTimeInt := int64(0)
-	for _, stat := range stats {
-		if (!DoAnalysis(stat)) { continue }
-
-		if (minTotalTimeInt == 0 || stat.TotalTime.Nanoseconds() < minTotalTimeInt) {
-			minTotalTimeInt = stat.TotalTime.Nanoseconds()
-		}
-	}
-
-	minTotalTime = time.Duration(minTotalTimeInt) * time.Nanosecond
-	return
+func DetermineMaxLatencies(summary *StatsSummary) (maxTotalTime time.Duration, maxTimeToRespond time.Duration, maxTimeToConnect time.Duration) {
+	return time.Duration(summary.TotalTime.Max), time.Duration(summary.TimeToRespond.Max), time.Duration(summary.TimeToConnect.Max)
 }
 
-func MeanLatencies(stats []ResponseStats) (meanTotalTime time.Duration) {
-	totalLatency := int64(0)
-	numSuccesses := 0
-	for _, stat := range stats {
-		if (!DoAnalysis(stat)) { continue }
-
-		numSuccesses += 1
-		totalLatency += stat.TotalTime.Nanoseconds()
-	}
-	if (numSuccesses == 0 ) {return time.Second * time.Duration(0)}
-	meanLatency := totalLatency / int64( numSuccesses )
-
-	return time.Duration(meanLatency) * time.Nanosecond
+func DeterminePercentilesLatencies(percentiles []float64, summary *StatsSummary) (TimeToConnectPercentiles, TimeToRespondPercentiles, TotalTimePercentiles []time.Duration) {
+	return summary.TimeToConnect.Percentiles(percentiles), summary.TimeToRespond.Percentiles(percentiles), summary.TotalTime.Percentiles(percentiles)
 }
 
-func DeterminePercentilesLatencies(percentiles []float64, stats []ResponseStats) (TimeToConnectPercentiles, TimeToRespondPercentiles, TotalTimePercentiles []time.Duration) {
-	TotalTimes := []int{}
-	TimeToResponds := []int{}
-	TimeToConnects := []int{}
-
-	for _, stat := range stats {
-		if (!DoAnalysis(stat)) { continue }
-
-		TotalTimes = append(TotalTimes, int(stat.TotalTime.Nanoseconds()))
-		TimeToResponds = append(TimeToResponds, int(stat.TimeToRespond.Nanoseconds()))
-		TimeToConnects = append(TimeToConnects, int(stat.TimeToConnect.Nanoseconds()))
-	}
-
-	if len(TotalTimes) == 0 {
-		return TimeToConnectPercentiles, TimeToRespondPercentiles, TotalTimePercentiles
-	}
+//DetermineResponseTimeLatencies works out the percentiles, max and mean of the response times measured from each request's intended send time
+func DetermineResponseTimeLatencies(percentiles []float64, summary *StatsSummary) (responseTimePercentiles []time.Duration, maxResponseTime time.Duration, meanResponseTime time.Duration) {
+	return summary.ResponseTime.Percentiles(percentiles), time.Duration(summary.ResponseTime.Max), summary.ResponseTime.Mean()
+}
 
-	sort.Ints(TotalTimes)
-	sort.Ints(TimeToResponds)
-	sort.Ints(TimeToConnects)
+//PhaseStats holds the percentiles, max and representative latencies (for histograms) of one phase of a request.
+//Requests that skipped the phase, such as the DNS lookup on a reused connection, aren't counted.
+type PhaseStats struct {
+	Name string
+	Percentiles []time.Duration
+	Max time.Duration
+	Latencies []float64
+}
 
-	TimeToConnectPercentiles = make([]time.Duration, len(percentiles))
-	TimeToRespondPercentiles = make([]time.Duration, len(percentiles))
-	TotalTimePercentiles = make([]time.Duration, len(percentiles))
+var phaseNames = []string{"DNS Lookup", "TCP Connect", "TLS Handshake", "Time To First Byte", "Transfer"}
 
-	for index, percentile := range percentiles {
-		percentileIndexRaw := float64(len(TotalTimes)-1) * percentile
-		percentileIndexRaw = math.Ceil(percentileIndexRaw)
-		percentileIndex := int(percentileIndexRaw)
+func phaseDurations(phases RequestPhases) []time.Duration {
+	return []time.Duration{phases.DNSLookup, phases.TCPConnect, phases.TLSHandshake, phases.TimeToFirstByte, phases.Transfer}
+}
 
-		TimeToConnectPercentiles[index] = time.Duration(TimeToConnects[percentileIndex]) * time.Nanosecond
-		TimeToRespondPercentiles[index] = time.Duration(TimeToResponds[percentileIndex]) * time.Nanosecond
-		TotalTimePercentiles[index] = time.Duration(TotalTimes[percentileIndex]) * time.Nanosecond
+//DeterminePhaseStats works out the stats for each phase of the requests, along with how many reused a connection
+func DeterminePhaseStats(percentiles []float64, summary *StatsSummary) (phaseStats []PhaseStats, connectionsReused int) {
+	for index, name := range phaseNames {
+		histogram := summary.Phases[index]
+		phaseStats = append(phaseStats, PhaseStats{
+			Name : name,
+			Percentiles : histogram.Percentiles(percentiles),
+			Max : time.Duration(histogram.Max),
+			Latencies : histogram.Values(maxHistogramValues),
+		})
 	}
-
-	return TimeToConnectPercentiles, TimeToRespondPercentiles, TotalTimePercentiles
+	return phaseStats, summary.ConnectionsReused
 }
 
-func extractLatencies(stats []ResponseStats) (TimeToRespond, TimeToConnect, TotalTime []float64) {
-	for _, stat := range stats {
-		respond := float64( stat.TimeToRespond.Nanoseconds() )
-		if (respond != 0) { TimeToRespond = append(TimeToRespond, respond) }
-
-		connect := float64( stat.TimeToConnect.Nanoseconds() )
-		if (connect != 0) { TimeToConnect = append(TimeToConnect, connect) }
-
-		total := float64( stat.TotalTime.Nanoseconds() )
-		if (total != 0) {TotalTime = append(TotalTime, total ) }
-	}
-	return
+//extractLatencies returns values spread through each latency distribution for drawing histograms
+func extractLatencies(summary *StatsSummary) (TimeToRespond, TimeToConnect, TotalTime []float64) {
+	return summary.TimeToRespond.Values(maxHistogramValues), summary.TimeToConnect.Values(maxHistogramValues), summary.TotalTime.Values(maxHistogramValues)
 }
 
 func commonFixes() {
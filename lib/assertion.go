@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//The failure categories of each kind of assertion
+const (
+	JSONPathAssertionCategory = "JSONPath"
+	BodyRegexAssertionCategory = "BodyRegex"
+	BodySizeAssertionCategory = "BodySize"
+	ContentTypeAssertionCategory = "ContentType"
+	LatencyAssertionCategory = "Latency"
+)
+
+//Assertions are checks on a response beyond its status code, headers and schema, anything left unset isn't checked
+type Assertions struct {
+	JSONPath []JSONPathAssertion `json:"jsonPath"`
+	BodyRegex string `json:"bodyRegex"`
+	MinBodyBytes int `json:"minBodyBytes"`
+	MaxBodyBytes int `json:"maxBodyBytes"`
+	//ContentType is compared with the media type of the response, ignoring parameters such as charset
+	ContentType string `json:"contentType"`
+	//MaxLatencyMs is the latency SLA of the request, measured as the time it took to issue and read the response
+	MaxLatencyMs float64 `json:"maxLatencyMs"`
+
+	bodyRegex *regexp.Regexp
+}
+
+//JSONPathAssertion checks the value at Path either equals a JSON value or matches a regex
+type JSONPathAssertion struct {
+	Path string `json:"path"`
+	Equals json.RawMessage `json:"equals"`
+	Matches string `json:"matches"`
+
+	equals string
+	matches *regexp.Regexp
+}
+
+func (a *Assertions) compile() (err error) {
+	if (a.BodyRegex != "") {
+		a.bodyRegex, err = regexp.Compile(a.BodyRegex)
+		if (err != nil) {
+			return errors.New(fmt.Sprintf("the bodyRegex assertion is an invalid regex, %v", err))
+		}
+	}
+
+	if (a.MinBodyBytes < 0 || a.MaxBodyBytes < 0 || (a.MaxBodyBytes > 0 && a.MaxBodyBytes < a.MinBodyBytes)) {
+		return errors.New(fmt.Sprintf("the body size assertion needs 0 <= minBodyBytes <= maxBodyBytes, got %v and %v", a.MinBodyBytes, a.MaxBodyBytes))
+	}
+	if (a.MaxLatencyMs < 0) {
+		return errors.New(fmt.Sprintf("maxLatencyMs must not be negative, got %v", a.MaxLatencyMs))
+	}
+
+	for index := range a.JSONPath {
+		err = a.JSONPath[index].compile()
+		if (err != nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *JSONPathAssertion) compile() (err error) {
+	if (a.Path == "") {
+		return errors.New("a jsonPath assertion needs a path")
+	}
+	if ((len(a.Equals) == 0) == (a.Matches == "")) {
+		return errors.New(fmt.Sprintf("the jsonPath assertion on '%v' needs exactly one of equals or matches", a.Path))
+	}
+
+	if (len(a.Equals) > 0) {
+		decoder := json.NewDecoder(bytes.NewReader(a.Equals))
+		decoder.UseNumber()
+		var expected interface{}
+		err = decoder.Decode(&expected)
+		if (err != nil) {
+			return errors.New(fmt.Sprintf("the jsonPath assertion on '%v' has an invalid equals value, %v", a.Path, err))
+		}
+		a.equals, err = jsonValueToString(expected)
+		return err
+	}
+
+	a.matches, err = regexp.Compile(a.Matches)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("the jsonPath assertion on '%v' has an invalid regex, %v", a.Path, err))
+	}
+	return nil
+}
+
+//Empty is true when there's nothing to check
+func (a *Assertions) Empty() bool {
+	return len(a.JSONPath) == 0 && a.BodyRegex == "" && a.MinBodyBytes == 0 && a.MaxBodyBytes == 0 && a.ContentType == "" && a.MaxLatencyMs == 0
+}
+
+type AssertionError struct {
+	DisplayableError
+	Msg string
+	description string
+}
+
+func NewAssertionError(category string, description string, msg string) *AssertionError {
+	return &AssertionError{
+		Msg : msg,
+		description : description,
+		DisplayableError: DisplayableError{category : category,},
+	}
+}
+
+func (e AssertionError) Error() string {
+	return e.Msg
+}
+
+func (e AssertionError) Description() string {
+	return e.description
+}
+
+func (e AssertionError) Category() string {
+	return e.category
+}
+
+//Check runs every assertion against a response. The messages leave out sizes and latencies so failures group together.
+func (a *Assertions) Check(respPayload string, resp *http.Response, totalTime time.Duration) (failures []DescriptiveError) {
+	if (a.MaxLatencyMs > 0 && totalTime > time.Duration(a.MaxLatencyMs * float64(time.Millisecond))) {
+		failures = append(failures, *NewAssertionError(LatencyAssertionCategory, "The request took longer than its latency SLA",
+			fmt.Sprintf("Request took longer than %vms", a.MaxLatencyMs)))
+	}
+
+	if (a.ContentType != "") {
+		mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if (err != nil || !strings.EqualFold(mediaType, a.ContentType)) {
+			failures = append(failures, *NewAssertionError(ContentTypeAssertionCategory, "The response had an unexpected content type",
+				fmt.Sprintf("Content type '%v' is not '%v'", resp.Header.Get("Content-Type"), a.ContentType)))
+		}
+	}
+
+	size := len(respPayload)
+	if (size < a.MinBodyBytes || (a.MaxBodyBytes > 0 && size > a.MaxBodyBytes)) {
+		failures = append(failures, *NewAssertionError(BodySizeAssertionCategory, "The response body was outside its expected size",
+			fmt.Sprintf("Body size is not between %v and %v bytes", a.MinBodyBytes, a.bodySizeLimit())))
+	}
+
+	if (a.bodyRegex != nil && !a.bodyRegex.MatchString(respPayload)) {
+		failures = append(failures, *NewAssertionError(BodyRegexAssertionCategory, "The response body did not match its regex",
+			fmt.Sprintf("Body did not match regex '%v'", a.BodyRegex)))
+	}
+
+	if (len(a.JSONPath) > 0) {
+		failures = append(failures, a.checkJSONPaths(respPayload)...)
+	}
+	return failures
+}
+
+func (a *Assertions) bodySizeLimit() string {
+	if (a.MaxBodyBytes == 0) {
+		return "any"
+	}
+	return fmt.Sprint(a.MaxBodyBytes)
+}
+
+//checkJSONPaths decodes the payload once for all of the JSONPath assertions
+func (a *Assertions) checkJSONPaths(respPayload string) (failures []DescriptiveError) {
+	decoder := json.NewDecoder(strings.NewReader(respPayload))
+	decoder.UseNumber()
+	var document interface{}
+	err := decoder.Decode(&document)
+	if (err != nil) {
+		return []DescriptiveError{*NewAssertionError(JSONPathAssertionCategory, "A JSONPath assertion on the response failed",
+			"The response is not valid JSON for the JSONPath assertions")}
+	}
+
+	for _, assertion := range a.JSONPath {
+		msg := ""
+		value, err := LookupJSONPath(document, assertion.Path)
+		if (err != nil) {
+			msg = fmt.Sprintf("JSONPath '%v' was not found", assertion.Path)
+		} else {
+			//The value found is left out of the message, it changes with each response and can be anything the response holds
+			actual, _ := jsonValueToString(value)
+			if (assertion.matches != nil && !assertion.matches.MatchString(actual)) {
+				msg = fmt.Sprintf("JSONPath '%v' doesn't match '%v'", assertion.Path, assertion.Matches)
+			} else if (assertion.matches == nil && actual != assertion.equals) {
+				msg = fmt.Sprintf("JSONPath '%v' is not '%v'", assertion.Path, assertion.equals)
+			}
+		}
+		if (msg != "") {
+			failures = append(failures, *NewAssertionError(JSONPathAssertionCategory, "A JSONPath assertion on the response failed", msg))
+		}
+	}
+	return failures
+}
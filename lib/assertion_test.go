@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func TestAssertions(t *testing.T) {
+	payload := `{"status": "ok", "items": [{"id": 12}], "version": "1.4.2"}`
+	resp := &http.Response{Header : http.Header{"Content-Type" : []string{"application/json; charset=utf-8"}}}
+
+	c.Convey("Each kind of assertion that fails is its own category", t, func(){
+		assertions := Assertions{
+			JSONPath : []JSONPathAssertion{
+				{Path : "$.status", Equals : json.RawMessage(`"error"`)},
+				{Path : "items[0].id", Equals : json.RawMessage(`12`)},
+				{Path : "$.version", Matches : `^2\.`},
+				{Path : "$.missing", Matches : `.`},
+			},
+			BodyRegex : `"total"`,
+			MaxBodyBytes : 10,
+			ContentType : "text/html",
+			MaxLatencyMs : 100,
+		}
+		c.So(assertions.compile(), c.ShouldBeNil)
+
+		failures := assertions.Check(payload, resp, time.Millisecond * 150)
+		categories := []string{}
+		for _, failure := range failures {
+			categories = append(categories, failure.Category())
+		}
+		c.So(categories, c.ShouldResemble, []string{LatencyAssertionCategory, ContentTypeAssertionCategory, BodySizeAssertionCategory, BodyRegexAssertionCategory,
+			JSONPathAssertionCategory, JSONPathAssertionCategory, JSONPathAssertionCategory})
+		c.So(failures[4].Error(), c.ShouldEqual, "JSONPath '$.status' is not 'error'")
+		c.So(failures[5].Error(), c.ShouldEqual, "JSONPath '$.version' doesn't match '^2\\.'")
+		c.So(failures[6].Error(), c.ShouldEqual, "JSONPath '$.missing' was not found")
+	})
+
+	c.Convey("A response meeting every assertion passes", t, func(){
+		assertions := Assertions{
+			JSONPath : []JSONPathAssertion{{Path : "$.status", Equals : json.RawMessage(`"ok"`)}},
+			BodyRegex : `"items"`,
+			MinBodyBytes : 10,
+			MaxBodyBytes : 1000,
+			ContentType : "application/json",
+			MaxLatencyMs : 100,
+		}
+		c.So(assertions.compile(), c.ShouldBeNil)
+		c.So(assertions.Check(payload, resp, time.Millisecond * 50), c.ShouldBeEmpty)
+	})
+
+	c.Convey("Invalid assertions are rejected", t, func(){
+		c.So((&Assertions{BodyRegex : "("}).compile(), c.ShouldNotBeNil)
+		c.So((&Assertions{MinBodyBytes : 100, MaxBodyBytes : 10}).compile(), c.ShouldNotBeNil)
+		c.So((&Assertions{JSONPath : []JSONPathAssertion{{Path : "$.a"}}}).compile(), c.ShouldNotBeNil)
+	})
+
+	c.Convey("Assertions from a requests file are checked on each response", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, payload)
+		}))
+		defer server.Close()
+
+		reqOpts := NewPlan(server.URL).RequestOptions
+		definition := RequestDefinition{URL : server.URL}
+		c.So(json.Unmarshal([]byte(`{"assert": {"jsonPath": [{"path": "$.status", "equals": "down"}], "contentType": "application/json"}}`), &definition), c.ShouldBeNil)
+		c.So(definition.applyDefaults(reqOpts), c.ShouldBeNil)
+
+		recorder := NewRequestRecorder(reqOpts)
+		stats, err := recorder.PerformRequest(&definition, map[string]string{})
+		c.So(err, c.ShouldBeNil)
+		c.So(len(stats.Failures), c.ShouldEqual, 1)
+		c.So(stats.Failures[0].Category(), c.ShouldEqual, JSONPathAssertionCategory)
+		c.So(ContainsResponse(stats), c.ShouldBeTrue)
+	})
+}
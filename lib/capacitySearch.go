@@ -0,0 +1,345 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	StepSearch = "step"
+	BinarySearch = "binary"
+)
+
+const maxSearchLevels = 50
+const minSearchGap = 1.0
+const searchPollFrequency = time.Millisecond * 50
+
+func ValidSearch(strategy string) bool {
+	return strategy == StepSearch || strategy == BinarySearch
+}
+
+//SearchLevel is the outcome of holding one rate during a capacity search
+type SearchLevel struct {
+	Rate float64
+	Passed bool
+	FailureDescription string
+	Stats AggregatedStats
+}
+
+//CapacitySearch looks for the highest rate the target sustains without failing the harvest, yield, throughput and latency thresholds.
+//Each level holds a rate for HoldTime, then pauses while in flight requests finish so the level is judged on its own stats.
+//A step search raises the rate by StepRate until a level fails, a binary search doubles the rate until a level fails and then bisects
+//between the highest rate that passed and the lowest that failed until they are within Precision percent.
+type CapacitySearch struct {
+	Strategy string
+	StartRate float64
+	StepRate float64
+	MaxRate float64
+	Precision float64
+
+	HoldTime time.Duration
+	SettleTime time.Duration
+	DrainTime time.Duration
+
+	Harvest float64
+	Yield float64
+	Throughput float64
+	PercentileLatencies []float64
+	Percentiles []float64
+
+	Spawner *Spawner
+	Accumulator *Accumulator
+
+	Done chan bool
+
+	//quit is closed to end the search early, searching is done once its goroutine has exited
+	quit chan bool
+	quitOnce sync.Once
+	searching sync.WaitGroup
+
+	mu sync.Mutex
+	Levels []SearchLevel
+}
+
+func NewCapacitySearch(spawner *Spawner, accumulator *Accumulator, reqOpts RequestOptions) *CapacitySearch {
+	stepRate := reqOpts.SearchStep
+	if (stepRate <= 0) {
+		stepRate = reqOpts.Rate
+	}
+
+	return &CapacitySearch{
+		Strategy : reqOpts.Search,
+		StartRate : reqOpts.Rate,
+		StepRate : stepRate,
+		MaxRate : reqOpts.SearchMax,
+		Precision : reqOpts.SearchPrecision,
+
+		HoldTime : reqOpts.SearchHoldTime,
+		SettleTime : reqOpts.WarmUpTime,
+		DrainTime : reqOpts.Timeout,
+
+		Harvest : reqOpts.Harvest,
+		Yield : reqOpts.Yield,
+		Throughput : reqOpts.Throughput,
+		PercentileLatencies : reqOpts.PercentileLatencies,
+		Percentiles : reqOpts.Percentiles,
+
+		Spawner : spawner,
+		Accumulator : accumulator,
+		Done : make(chan bool),
+		quit : make(chan bool),
+	}
+}
+
+func (c *CapacitySearch) Start() {
+	Log("search", fmt.Sprintln("Starting a ", c.Strategy, " capacity search from ", c.StartRate, " req/s, holding each level for ", c.HoldTime) )
+	c.searching.Add(1)
+	go func() {
+		defer c.searching.Done()
+		for {
+			rate, ok := c.NextRate()
+			if (!ok || c.stopped()) {
+				break
+			}
+			level, finished := c.runLevel(rate)
+			if (!finished) {
+				return
+			}
+			Log("search", fmt.Sprintln("Level ", rate, " req/s passed: ", level.Passed, " ", level.FailureDescription) )
+
+			c.mu.Lock()
+			c.Levels = append(c.Levels, level)
+			c.mu.Unlock()
+		}
+
+		if (!c.stopped()) {
+			Log("search", c.Summary())
+			select {
+			case c.Done <- true:
+			case <- c.quit:
+			}
+		}
+	}()
+}
+
+//Stop ends the search, abandoning the level being run, and waits for it to exit
+func (c *CapacitySearch) Stop() {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+	})
+	c.searching.Wait()
+}
+
+func (c *CapacitySearch) stopped() bool {
+	select {
+	case <- c.quit:
+		return true
+	default:
+		return c.Spawner.IsStopped()
+	}
+}
+
+//NextRate picks the rate for the next level from the levels run so far, ok is false once the search is over
+func (c *CapacitySearch) NextRate() (rate float64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if (len(c.Levels) == 0) {
+		return c.StartRate, true
+	}
+	if (len(c.Levels) >= maxSearchLevels) {
+		return 0, false
+	}
+
+	last := c.Levels[len(c.Levels) - 1]
+	passed, failed := c.bounds()
+
+	switch c.Strategy {
+	case StepSearch:
+		if (!last.Passed) {
+			return 0, false
+		}
+		rate = last.Rate + c.StepRate
+	default:
+		if (failed == nil) {
+			rate = last.Rate * 2
+		} else {
+			highestPass := 0.0
+			if (passed != nil) {
+				highestPass = passed.Rate
+			}
+			gap := failed.Rate - highestPass
+			if (gap < minSearchGap || gap / failed.Rate * 100 <= c.Precision) {
+				return 0, false
+			}
+			rate = (highestPass + failed.Rate) / 2
+		}
+	}
+
+	if (c.MaxRate > 0 && rate > c.MaxRate) {
+		if (last.Rate >= c.MaxRate) {
+			return 0, false
+		}
+		rate = c.MaxRate
+	}
+	return rate, true
+}
+
+//bounds returns the level with the highest rate that passed and the level with the lowest rate that failed, mu must be held
+func (c *CapacitySearch) bounds() (passed *SearchLevel, failed *SearchLevel) {
+	for index := range c.Levels {
+		level := &c.Levels[index]
+		if (level.Passed && (passed == nil || level.Rate > passed.Rate)) {
+			passed = level
+		}
+		if (!level.Passed && (failed == nil || level.Rate < failed.Rate)) {
+			failed = level
+		}
+	}
+	return passed, failed
+}
+
+//runLevel holds the rate for HoldTime, summarising the requests meant to be sent after the first SettleTime in a window of the accumulator.
+//finished is false when the search was stopped before the level was over.
+func (c *CapacitySearch) runLevel(rate float64) (level SearchLevel, finished bool) {
+	_, droppedBefore := c.Spawner.IssuedAndDropped()
+	levelStart := time.Now()
+	levelEnd := levelStart.Add(c.HoldTime)
+	windowStart := levelStart.Add(c.SettleTime)
+	if (!windowStart.Before(levelEnd)) {
+		windowStart = levelStart
+	}
+	window := c.Accumulator.AddWindow(windowStart, levelEnd)
+	c.Spawner.SetRate(rate)
+
+	hold := time.NewTimer(c.HoldTime)
+	defer hold.Stop()
+	select {
+	case <- hold.C:
+	case <- c.quit:
+		c.Accumulator.RemoveWindow(window)
+		return SearchLevel{}, false
+	}
+
+	c.Spawner.SetRate(0)
+	c.waitForInFlight()
+	_, droppedAfter := c.Spawner.IssuedAndDropped()
+
+	return c.EvaluateLevel(rate, c.Accumulator.RemoveWindow(window), droppedAfter - droppedBefore, levelEnd.Sub(windowStart)), true
+}
+
+//waitForInFlight waits until every issued request has returned its stats, or DrainTime has passed
+func (c *CapacitySearch) waitForInFlight() {
+	deadline := time.Now().Add(c.DrainTime)
+	for (time.Now().Before(deadline) && !c.stopped()) {
+		issued, _ := c.Spawner.IssuedAndDropped()
+		if (c.Accumulator.Received() >= issued) {
+			return
+		}
+		time.Sleep(searchPollFrequency)
+	}
+}
+
+//EvaluateLevel analyses the summary of requests issued during a level and checks it against the failure thresholds
+func (c *CapacitySearch) EvaluateLevel(rate float64, summary *StatsSummary, dropped int, window time.Duration) SearchLevel {
+	levelStats := AggregatedStats{
+		Rate : rate,
+		Percentiles : c.Percentiles,
+		TimeElapsed : window,
+		RequestsDropped : dropped,
+	}
+
+	levelStats.TimeToConnectPercentiles, levelStats.TimeToRespondPercentiles, levelStats.TotalTimePercentiles = DeterminePercentilesLatencies(levelStats.Percentiles, summary)
+	levelStats.MaxTotalTime, levelStats.MaxTimeToRespond, levelStats.MaxTimeToConnect = DetermineMaxLatencies(summary)
+	levelStats.MinTotalTime = time.Duration(summary.TotalTime.Min)
+	levelStats.MeanTotalTime = summary.TotalTime.Mean()
+	levelStats.ResponseTimePercentiles, levelStats.MaxResponseTime, levelStats.MeanResponseTime = DetermineResponseTimeLatencies(levelStats.Percentiles, summary)
+	levelStats.Failures, levelStats.FailureCounts = summary.Failures, summary.FailureCounts
+
+	levelStats.TotalRequests = summary.Requests + dropped
+	levelStats.TotalResponses = summary.Responses
+	levelStats.TotalValidResponses = summary.ValidResponses
+	levelStats.WrongStatusResponses = summary.WrongStatusResponses
+	levelStats.Harvest = Harvest(levelStats.TotalResponses, levelStats.TotalRequests)
+	levelStats.Yield = Yield(levelStats.TotalResponses, levelStats.TotalValidResponses)
+
+	if (window > 0) {
+		levelStats.AverageRespThroughput = float64(levelStats.TotalResponses) / window.Seconds()
+		levelStats.LatestRespThroughput = levelStats.AverageRespThroughput
+	}
+
+	levelStats.OverallFailure, levelStats.OverallFailureDescription = Failure(levelStats, c.Harvest, c.Yield, c.Throughput, c.PercentileLatencies)
+
+	return SearchLevel{
+		Rate : rate,
+		Passed : !levelStats.OverallFailure,
+		FailureDescription : levelStats.OverallFailureDescription,
+		Stats : levelStats,
+	}
+}
+
+//Results returns a copy of the levels run so far along with a summary of the search
+func (c *CapacitySearch) Results() (levels []SearchLevel, summary string) {
+	c.mu.Lock()
+	levels = append(levels, c.Levels...)
+	c.mu.Unlock()
+	return levels, c.Summary()
+}
+
+//Summary describes the highest rate that passed, with its p99 response time (or the top percentile when p99 isn't measured),
+//and the lowest rate that failed
+func (c *CapacitySearch) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if (len(c.Levels) == 0) {
+		return "The capacity search hasn't finished a level yet"
+	}
+
+	passed, failed := c.bounds()
+	if (passed == nil) {
+		return fmt.Sprintf("No rate passed, the lowest rate tried of %.2f req/s failed: %v", failed.Rate, failed.FailureDescription)
+	}
+
+	summary := fmt.Sprintf("This service sustains %.2f req/s", passed.Rate)
+	percentileIndex := len(passed.Stats.Percentiles) - 1
+	for index, percentile := range passed.Stats.Percentiles {
+		if (percentile == 0.99) {
+			percentileIndex = index
+		}
+	}
+	if (percentileIndex >= 0 && percentileIndex < len(passed.Stats.ResponseTimePercentiles)) {
+		summary += fmt.Sprintf(" at p%v < %v", passed.Stats.Percentiles[percentileIndex] * 100, passed.Stats.ResponseTimePercentiles[percentileIndex])
+	}
+	if (failed != nil) {
+		summary += fmt.Sprintf(", %.2f req/s failed: %v", failed.Rate, failed.FailureDescription)
+	}
+	return summary
+}
+
+//Report is a table of every level followed by the summary
+func (c *CapacitySearch) Report() string {
+	return SearchReport(c.Results())
+}
+
+//SearchReport is a table of the stats of each level followed by the summary, which the plain renderer prints when a search finishes
+func SearchReport(levels []SearchLevel, summary string) string {
+	output := bytes.NewBuffer([]byte{})
+	table := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "Rate\tResult\tRequests\tHarvest\tYield\tResp/s\tMean\tMax\tFailure")
+	for _, level := range levels {
+		result := "passed"
+		if (!level.Passed) {
+			result = "failed"
+		}
+		fmt.Fprintf(table, "%.2f\t%v\t%v\t%.2f%%\t%.2f%%\t%.2f\t%v\t%v\t%v\n",
+			level.Rate, result, level.Stats.TotalRequests, level.Stats.Harvest, level.Stats.Yield,
+			level.Stats.AverageRespThroughput, level.Stats.MeanResponseTime, level.Stats.MaxResponseTime, level.FailureDescription)
+	}
+	table.Flush()
+
+	return output.String() + summary
+}
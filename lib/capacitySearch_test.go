@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"errors"
+	"time"
+)
+
+func TestCapacitySearch(t *testing.T) {
+	c.Convey("With a binary capacity search starting at 100 req/s", t, func(){
+		search := &CapacitySearch{
+			Strategy : BinarySearch,
+			StartRate : 100,
+			Precision : 5,
+			Percentiles : []float64{0.5, 0.99},
+		}
+		level := func(rate float64, passed bool) SearchLevel {
+			return SearchLevel{
+				Rate : rate,
+				Passed : passed,
+				FailureDescription : "too slow",
+				Stats : AggregatedStats{
+					Percentiles : search.Percentiles,
+					ResponseTimePercentiles : []time.Duration{time.Millisecond, time.Millisecond * 20},
+				},
+			}
+		}
+
+		c.Convey("The rate doubles until a level fails and then bisects", func(){
+			rate, ok := search.NextRate()
+			c.So(ok, c.ShouldBeTrue)
+			c.So(rate, c.ShouldEqual, 100)
+
+			search.Levels = append(search.Levels, level(100, true))
+			rate, _ = search.NextRate()
+			c.So(rate, c.ShouldEqual, 200)
+
+			search.Levels = append(search.Levels, level(200, false))
+			rate, _ = search.NextRate()
+			c.So(rate, c.ShouldEqual, 150)
+		})
+
+		c.Convey("It stops once the passing and failing rates are close enough", func(){
+			search.Levels = []SearchLevel{level(100, true), level(200, false), level(150, true), level(175, true), level(187.5, true), level(193.75, false)}
+			_, ok := search.NextRate()
+			c.So(ok, c.ShouldBeFalse)
+			c.So(search.Summary(), c.ShouldStartWith, "This service sustains 187.50 req/s at p99 < 20ms, 193.75 req/s failed")
+		})
+	})
+
+	c.Convey("A level is judged against the failure thresholds", t, func(){
+		search := &CapacitySearch{Harvest : 90, Yield : 90, Percentiles : []float64{0.5}}
+		start := time.Now()
+		stats := []ResponseStats{
+			{StartTime : start, TotalTime : time.Millisecond},
+			{StartTime : start, TotalTime : time.Millisecond, Failures : []DescriptiveError{*NewRequestExecutionError(errors.New("refused"))}},
+		}
+		level := search.EvaluateLevel(10, SummariseStats(stats), 0, time.Second)
+		c.So(level.Passed, c.ShouldBeFalse)
+		c.So(level.Stats.Harvest, c.ShouldEqual, 50)
+	})
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+//Extraction pulls a value out of a response so later steps in a chain can use it as {{.Name}}.
+//Exactly one of JSONPath, Header or Regex should be set, a regex returns its first group if it has one.
+type Extraction struct {
+	Name string `json:"name"`
+	JSONPath string `json:"jsonPath"`
+	Header string `json:"header"`
+	Regex string `json:"regex"`
+
+	regex *regexp.Regexp
+}
+
+func (e *Extraction) compile() (err error) {
+	if (e.Name == "") {
+		return errors.New("an extraction needs a name")
+	}
+
+	sources := 0
+	for _, source := range []string{e.JSONPath, e.Header, e.Regex} {
+		if (source != "") {
+			sources += 1
+		}
+	}
+	if (sources != 1) {
+		return errors.New(fmt.Sprintf("extraction '%v' needs exactly one of jsonPath, header or regex", e.Name))
+	}
+
+	if (e.Regex != "") {
+		e.regex, err = regexp.Compile(e.Regex)
+		if (err != nil) {
+			return errors.New(fmt.Sprintf("extraction '%v' has an invalid regex, %v", e.Name, err))
+		}
+	}
+	return nil
+}
+
+func (e *Extraction) Extract(respPayload string, resp *http.Response) (value string, err error) {
+	if (e.JSONPath != "") {
+		return ExtractJSONPath(respPayload, e.JSONPath)
+	}
+
+	if (e.Header != "") {
+		value = resp.Header.Get(e.Header)
+		if (value == "") {
+			return "", errors.New(fmt.Sprintf("Header '%v' could not be found in response", e.Header))
+		}
+		return value, nil
+	}
+
+	matches := e.regex.FindStringSubmatch(respPayload)
+	if (matches == nil) {
+		return "", errors.New(fmt.Sprintf("Regex '%v' did not match the response", e.Regex))
+	}
+	if (len(matches) > 1) {
+		return matches[1], nil
+	}
+	return matches[0], nil
+}
+
+type ExtractionError struct {
+	DisplayableError
+	Name string
+	err error
+}
+
+func NewExtractionError(name string, err error) *ExtractionError {
+	return &ExtractionError{
+		Name : name,
+		err : err,
+		DisplayableError: DisplayableError{category : "Extraction",},
+	}
+}
+
+func (e ExtractionError) Error() string {
+	return fmt.Sprintf("Could not extract '%v', %v", e.Name, e.err.Error())
+}
+
+func (e ExtractionError) Description() string {
+	return "A value could not be extracted from the response for later steps"
+}
+
+func (e ExtractionError) Category() string {
+	return e.category
+}
+
+//ExtractValues runs every extraction for a step against its response, storing what it finds in vars
+func ExtractValues(extractions []Extraction, respPayload string, resp *http.Response, vars map[string]string) (failures []DescriptiveError) {
+	for index := range extractions {
+		value, err := extractions[index].Extract(respPayload, resp)
+		if (err != nil) {
+			failures = append(failures, *NewExtractionError(extractions[index].Name, err))
+			continue
+		}
+		vars[extractions[index].Name] = value
+	}
+	return failures
+}
+
+//PerformChain issues each step of a chain in order as a single virtual user, the chain stops at the first step that fails.
+//vars start with any feeder values and collect what each step extracts.
+//The returned stats cover the chain as a whole, with the stats for each step that was issued in Steps.
+func (r *RequestRecorder) PerformChain(definition *RequestDefinition, vars map[string]string) (respStats ResponseStats, err error) {
+	respStats = ResponseStats{
+		Label : definition.Label,
+		StartTime : time.Now(),
+		Phases : RequestPhases{ConnectionReused : true},
+	}
+
+	for index := range definition.Steps {
+		step := &definition.Steps[index]
+
+		stepStats, stepErr := r.PerformRequest(step, vars)
+		stepStats.Label = step.Label
+
+		respStats.Steps = append(respStats.Steps, stepStats)
+		respStats.TimeToConnect += stepStats.TimeToConnect
+		respStats.TimeToRespond += stepStats.TimeToRespond
+		respStats.Phases = respStats.Phases.Add(stepStats.Phases)
+		respStats.StatusCode = stepStats.StatusCode
+		respStats.Failures = append(respStats.Failures, stepStats.Failures...)
+
+		if (stepErr != nil) {
+			err = stepErr
+		}
+		if (stepStats.Failure()) {
+			break
+		}
+	}
+
+	respStats.FinishTime = time.Now()
+	respStats.TotalTime = respStats.FinishTime.Sub(respStats.StartTime)
+
+	return respStats, err
+}
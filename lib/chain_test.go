@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func TestExtractJSONPath(t *testing.T) {
+	c.Convey("With a JSON payload", t, func(){
+		payload := `{"auth": {"token": "abc"}, "items": [{"id": 12}, {"id": 13}]}`
+
+		c.Convey("Strings and numbers can be extracted by path", func(){
+			token, err := ExtractJSONPath(payload, "$.auth.token")
+			c.So(err, c.ShouldBeNil)
+			c.So(token, c.ShouldEqual, "abc")
+
+			id, err := ExtractJSONPath(payload, "items[1].id")
+			c.So(err, c.ShouldBeNil)
+			c.So(id, c.ShouldEqual, "13")
+		})
+
+		c.Convey("A missing value is an error", func(){
+			_, err := ExtractJSONPath(payload, "$.auth.missing")
+			c.So(err, c.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPerformChain(t *testing.T) {
+	c.Convey("With a server that hands out a token and checks it", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if (req.URL.Path == "/login") {
+				w.Header().Set("X-Session", "session-1")
+				fmt.Fprint(w, `{"token": "secret"}`)
+				return
+			}
+			if (req.Header.Get("Authorization") != "Bearer secret" || req.URL.Query().Get("session") != "session-1") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true}`)
+		}))
+		defer server.Close()
+
+		reqOpts := RequestOptions{
+			ResponseCodes : OnlyStatusCode(200),
+			Timeout : time.Second,
+		}
+		definition := RequestDefinition{
+			Label : "login",
+			Steps : []RequestDefinition{
+				{
+					URL : server.URL + "/login",
+					Extract : []Extraction{
+						{Name : "token", JSONPath : "$.token"},
+						{Name : "session", Header : "X-Session"},
+					},
+				},
+				{
+					URL : server.URL + "/items?session={{.session}}",
+					Headers : map[string]string{"Authorization": "Bearer {{.token}}"},
+				},
+			},
+		}
+		err := definition.applyDefaults(reqOpts)
+		c.So(err, c.ShouldBeNil)
+
+		recorder := NewRequestRecorder(reqOpts)
+
+		c.Convey("Values extracted from earlier steps are used in later ones", func(){
+			stats, err := recorder.PerformChain(&definition, make(map[string]string))
+			c.So(err, c.ShouldBeNil)
+			c.So(stats.Failure(), c.ShouldBeFalse)
+			c.So(stats.Label, c.ShouldEqual, "login")
+			c.So(len(stats.Steps), c.ShouldEqual, 2)
+			c.So(stats.Steps[1].Label, c.ShouldEqual, "login > GET " + server.URL + "/items?session={{.session}}")
+		})
+
+		c.Convey("The chain stops at the first step that fails", func(){
+			definition.Steps[0].Extract[0].JSONPath = "$.missing"
+			stats, _ := recorder.PerformChain(&definition, make(map[string]string))
+			c.So(stats.Failure(), c.ShouldBeTrue)
+			c.So(len(stats.Steps), c.ShouldEqual, 1)
+			c.So(stats.Failures[0].Category(), c.ShouldEqual, "Extraction")
+		})
+	})
+}
@@ -1,12 +1,21 @@
 package lib
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"fmt"
 	"time"
 )
 
+//Exit codes, so a pipeline can tell a test that failed its thresholds from one that couldn't start or was stopped part way
+const (
+	ExitPassed = 0
+	ExitThresholdFailure = 1
+	ExitConfigurationError = 2
+	ExitAborted = 3
+)
+
 type Choreographer struct {
 	ExecuteSingleRequest bool
 	IncreaseRateToFailure bool
@@ -21,6 +30,8 @@ type Choreographer struct {
 	Accumulator *Accumulator
 	Analyser *Analyser
 	Reporter *Reporter
+	Search *CapacitySearch
+	Metrics *MetricsServer
 
 }
 
@@ -35,7 +46,7 @@ func NewChoreographer(reqOpts RequestOptions, outOpts OutputOptions) *Choreograp
 	}
 
 	choreographer.Spawner = NewSpawner(choreographer.ResponseStatsChan, choreographer.OverallStatsChan, choreographer.RequestOptions)
-	choreographer.Accumulator = NewAccumulator(choreographer.RequestOptions.RequestsToIssue, choreographer.Spawner.StatsChan, choreographer.Spawner.OverallStatsChan)
+	choreographer.Accumulator = NewAccumulator(choreographer.RequestOptions.RequestsToIssue, choreographer.RequestOptions.SampleRate, choreographer.RequestOptions.Percentiles, choreographer.Spawner.StatsChan, choreographer.Spawner.OverallStatsChan)
 
 	calcRate := false
 	if (!choreographer.IncreaseRateToFailure) {
@@ -43,6 +54,14 @@ func NewChoreographer(reqOpts RequestOptions, outOpts OutputOptions) *Choreograp
 	}
 
 	choreographer.Analyser = NewAnalyser(choreographer.Accumulator, reqOpts, calcRate)
+
+	if (choreographer.IncreaseRateToFailure) {
+		choreographer.Search = NewCapacitySearch(choreographer.Spawner, choreographer.Accumulator, reqOpts)
+		choreographer.Analyser.Search = choreographer.Search
+	}
+	if (choreographer.OutputOptions.MetricsAddress != "") {
+		choreographer.Metrics = NewMetricsServer(choreographer.OutputOptions.MetricsAddress, choreographer.Accumulator, choreographer.Spawner.CurrentOverallStats)
+	}
 	choreographer.Reporter = NewReporter(choreographer.Analyser.StatsChan, choreographer.OutputOptions, choreographer.RequestOptions)
 
 	if (choreographer.ExecuteSingleRequest) {
@@ -52,50 +71,157 @@ func NewChoreographer(reqOpts RequestOptions, outOpts OutputOptions) *Choreograp
 	return choreographer
 }
 
+//Start runs the test from the command line, stopping it on an interrupt, and exits with the test's exit code
 func (c *Choreographer) Start() {
-	Log("top", fmt.Sprintf("Starting to execute") )
-
+	ctx, cancel := context.WithCancel(context.Background())
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<- sigChan
+		cancel()
+	}()
+
+	result := c.Run(ctx)
+	os.Exit(result.ExitCode)
+}
+
+//Run executes the test until it finishes or ctx is cancelled, cleans up and returns the final stats
+func (c *Choreographer) Run(ctx context.Context) *Result {
+	Log("top", fmt.Sprintf("Starting to execute") )
 
+	c.Spawner.Context = ctx
 	c.Spawner.Start()
+	if (c.Metrics != nil) {
+		c.Metrics.Start()
+	}
+
+	//Like feederDone, searchDone is nil unless the test is a capacity search
+	var searchDone chan bool
+	if (c.Search != nil) {
+		c.Search.Start()
+		searchDone = c.Search.Done
+	}
+
+	//A nil channel never receives, so this case only fires when there's a feeder that can stop the test
+	var feederDone chan bool
+	if (c.RequestOptions.Feeder != nil) {
+		feederDone = c.RequestOptions.Feeder.Done
+	}
 
 	now := time.Now()
 	for {
 		select {
-		case <- c.Analyser.Fail:
-			if (c.IncreaseRateToFailure) {
-				c.cleanup()
-				Log("top", fmt.Sprintf("Failure occurred at %v", time.Since(now)) )
-				os.Exit(0)
-			}
+		case <- searchDone:
+			c.cleanup()
+			Log("top", fmt.Sprintf("Capacity search finished after %v", time.Since(now)) )
+			result := c.result(c.exitCode())
+			result.SearchReport = c.Search.Report()
+			return result
 		case <- c.Spawner.Done:
 			c.cleanup()
 			Log("top", fmt.Sprintf("Max execution time reached") )
-			os.Exit(0)
+			return c.result(c.exitCode())
+		case <- feederDone:
+			c.cleanup()
+			Log("top", fmt.Sprintf("Feeder data ran out, exiting") )
+			return c.result(c.exitCode())
 		case <- c.Accumulator.Done:
 			c.cleanup()
 			Log("top", fmt.Sprintf("Finished executing all requests, exiting") )
-			os.Exit(0)
+			return c.result(c.exitCode())
 		case <- c.Reporter.Done:
 			c.cleanup()
 			Log("top", fmt.Sprintf("Interupted, exiting") )
-			os.Exit(1)
-		case <- sigChan:
+			return c.result(ExitAborted)
+		case <- ctx.Done():
 			c.cleanup()
 			Log("top", fmt.Sprintf("Interupted, exiting") )
-			os.Exit(1)
+			return c.result(ExitAborted)
+		}
+	}
+}
+
+func (c *Choreographer) result(exitCode int) *Result {
+	stats := c.Analyser.LatestStats()
+	return &Result{
+		Stats : stats,
+		Passed : exitCode == ExitPassed,
+		Aborted : exitCode == ExitAborted,
+		ExitCode : exitCode,
+		requestOptions : c.RequestOptions,
+	}
+}
+
+//exitCode judges a test that ran to the end, a capacity search passes when any level passed
+func (c *Choreographer) exitCode() int {
+	if (c.Search != nil) {
+		levels, _ := c.Search.Results()
+		for _, level := range levels {
+			if (level.Passed) {
+				return ExitPassed
+			}
 		}
+		return ExitThresholdFailure
 	}
+
+	stats := c.Analyser.LatestStats()
+	if (stats.TotalRequests == 0 || stats.OverallFailure) {
+		return ExitThresholdFailure
+	}
+	return ExitPassed
 }
 
+//cleanup stops every part of the test in turn, so no goroutine of the test is left running once Run returns
 func (c *Choreographer) cleanup () {
+	if (c.Search != nil) {
+		c.Search.Stop()
+	}
 	c.Spawner.Stop()
+	//Nothing sends on the stats channels once the spawner has stopped, closing them ends the accumulator
+	close(c.ResponseStatsChan)
+	close(c.OverallStatsChan)
+	c.Accumulator.Wait()
 	c.Analyser.Stop()
 
-	c.Spawner.Cleanup()
+	c.Accumulator.AddOverallStats(c.Spawner.Cleanup())
 	c.Analyser.Cleanup()
 
-	c.Reporter.Cleanup()
+	c.Reporter.Cleanup(c.Analyser.LatestStats())
 	c.Reporter.Stop()
+
+	c.writeReports(c.Analyser.LatestStats())
+	if (c.Metrics != nil) {
+		c.Metrics.Stop()
+	}
+}
+
+//writeReports writes the final stats to the -out, -junit and -htmlreport files, when they're given
+//writeReports writes the report files asked for, an error writing one is printed to stderr as logging is usually off
+func (c *Choreographer) writeReports(stats AggregatedStats) {
+	if (c.OutputOptions.ReportPath != "") {
+		err := WriteReport(c.OutputOptions.ReportPath, NewReport(stats, c.RequestOptions))
+		if (err != nil) {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			Log("top", fmt.Sprintf("Wrote the report to %v", c.OutputOptions.ReportPath) )
+		}
+	}
+
+	if (c.OutputOptions.JUnitPath != "") {
+		err := WriteJUnitReport(c.OutputOptions.JUnitPath, NewJUnitReport(stats, c.RequestOptions))
+		if (err != nil) {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			Log("top", fmt.Sprintf("Wrote the JUnit report to %v", c.OutputOptions.JUnitPath) )
+		}
+	}
+
+	if (c.OutputOptions.HTMLReportPath != "") {
+		err := WriteHTMLReport(c.OutputOptions.HTMLReportPath, c.OutputOptions.StaticDir, stats, c.RequestOptions)
+		if (err != nil) {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			Log("top", fmt.Sprintf("Wrote the HTML report to %v", c.OutputOptions.HTMLReportPath) )
+		}
+	}
 }
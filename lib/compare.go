@@ -0,0 +1,336 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+//minCompareSamples is the fewest per second buckets each run needs before a difference is tested for significance,
+//with fewer a change past the threshold is a regression on its own
+const minCompareSamples = 5
+
+//CompareOptions are the changes between a baseline and current report that count as a regression
+type CompareOptions struct {
+	//LatencyThreshold is the percentage a latency percentile can rise by, as long as it's risen by more than MinLatencyMs
+	LatencyThreshold float64
+	MinLatencyMs float64
+	//ThroughputThreshold is the percentage the mean throughput can fall by
+	ThroughputThreshold float64
+	//ErrorRateThreshold is the number of percentage points the error rate can rise by
+	ErrorRateThreshold float64
+	//Significance is the p value a change has to be under, by a Mann-Whitney U test of the per second figures, to count. 0 turns the test off
+	Significance float64
+}
+
+var DefaultCompareOptions = CompareOptions{
+	LatencyThreshold : 10,
+	MinLatencyMs : 1,
+	ThroughputThreshold : 10,
+	ErrorRateThreshold : 1,
+	Significance : 0.05,
+}
+
+//MetricComparison is one figure of the baseline and current runs, PValue is negative when the change wasn't tested
+type MetricComparison struct {
+	Name string
+	Baseline float64
+	Current float64
+	Change string
+	PValue float64
+	Regression bool
+	Description string
+}
+
+type Comparison struct {
+	Metrics []MetricComparison
+}
+
+//Regressions are the metrics that got significantly worse
+func (c Comparison) Regressions() (regressions []MetricComparison) {
+	for _, metric := range c.Metrics {
+		if (metric.Regression) {
+			regressions = append(regressions, metric)
+		}
+	}
+	return regressions
+}
+
+//DoCompare runs the compare command, `deathstar compare [options] baseline.json current.json`, and returns the exit code
+func DoCompare(args []string, output io.Writer) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	latencyThreshold := flags.Float64("latency", DefaultCompareOptions.LatencyThreshold, "The % a latency percentile can rise by before it's a regression")
+	minLatencyMs := flags.Float64("minlatency", DefaultCompareOptions.MinLatencyMs, "The ms a latency percentile has to rise by before it's a regression, so tiny latencies don't flag")
+	throughputThreshold := flags.Float64("throughput", DefaultCompareOptions.ThroughputThreshold, "The % the mean resp/s can fall by before it's a regression")
+	errorRateThreshold := flags.Float64("errors", DefaultCompareOptions.ErrorRateThreshold, "The percentage points the error rate can rise by before it's a regression")
+	significance := flags.Float64("significance", DefaultCompareOptions.Significance, "The p value of the per second figures a change must be under to be a regression, 0 flags every change past the thresholds")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deathstar compare [options] baseline.json current.json")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if (err != nil) {
+		return ExitConfigurationError
+	}
+	if (flags.NArg() != 2) {
+		flags.Usage()
+		return ExitConfigurationError
+	}
+
+	baseline, err := ReadReport(flags.Arg(0))
+	if (err != nil) {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConfigurationError
+	}
+	current, err := ReadReport(flags.Arg(1))
+	if (err != nil) {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConfigurationError
+	}
+
+	comparison := CompareReports(baseline, current, CompareOptions{
+		LatencyThreshold : *latencyThreshold,
+		MinLatencyMs : *minLatencyMs,
+		ThroughputThreshold : *throughputThreshold,
+		ErrorRateThreshold : *errorRateThreshold,
+		Significance : *significance,
+	})
+	fmt.Fprintf(output, "Comparing %v against the baseline %v\n\n", flags.Arg(1), flags.Arg(0))
+	WriteComparison(output, comparison)
+
+	if (len(comparison.Regressions()) > 0) {
+		return ExitThresholdFailure
+	}
+	return ExitPassed
+}
+
+//ReadReport reads a report written by -out, it must be the version this build writes
+func ReadReport(path string) (report Report, err error) {
+	reportBytes, err := ioutil.ReadFile(path)
+	if (err != nil) {
+		return report, errors.New(fmt.Sprintf("Could not read the report %v, err: %v", path, err))
+	}
+	err = json.Unmarshal(reportBytes, &report)
+	if (err != nil) {
+		return report, errors.New(fmt.Sprintf("Could not decode the report %v, err: %v", path, err))
+	}
+	if (report.Version != ReportVersion) {
+		return report, errors.New(fmt.Sprintf("The report %v is version %v, only version %v reports can be compared", path, report.Version, ReportVersion))
+	}
+	return report, nil
+}
+
+//CompareReports compares the latency percentiles, throughput and error rate of the current run against the baseline
+func CompareReports(baseline Report, current Report, opts CompareOptions) (comparison Comparison) {
+	for _, baselinePercentile := range baseline.Latency.Total.Percentiles {
+		currentMs, ok := findPercentileMs(current.Latency.Total.Percentiles, baselinePercentile.Percentile)
+		if (!ok) {
+			continue
+		}
+		metric := MetricComparison{
+			Name : fmt.Sprintf("p%v latency (ms)", math.Round(baselinePercentile.Percentile * 1000000) / 10000),
+			Baseline : baselinePercentile.Ms,
+			Current : currentMs,
+			Change : percentageChange(baselinePercentile.Ms, currentMs),
+			PValue : -1,
+		}
+		if (currentMs - baselinePercentile.Ms > opts.MinLatencyMs && currentMs > baselinePercentile.Ms * (1 + opts.LatencyThreshold / 100)) {
+			metric.Regression, metric.PValue = isSignificant(bucketPercentiles(baseline, baselinePercentile.Percentile), bucketPercentiles(current, baselinePercentile.Percentile), opts.Significance)
+			metric.Description = fmt.Sprintf("%v rose %v from %.2f to %.2f", metric.Name, metric.Change, metric.Baseline, metric.Current)
+		}
+		comparison.Metrics = append(comparison.Metrics, metric)
+	}
+
+	throughput := MetricComparison{
+		Name : "Throughput (resp/s)",
+		Baseline : baseline.Throughput.MeanResponsesPerSec,
+		Current : current.Throughput.MeanResponsesPerSec,
+		Change : percentageChange(baseline.Throughput.MeanResponsesPerSec, current.Throughput.MeanResponsesPerSec),
+		PValue : -1,
+	}
+	if (throughput.Current < throughput.Baseline * (1 - opts.ThroughputThreshold / 100)) {
+		//A fall in throughput is a rise in the negated figures
+		throughput.Regression, throughput.PValue = isSignificant(negate(bucketResponses(baseline)), negate(bucketResponses(current)), opts.Significance)
+		throughput.Description = fmt.Sprintf("%v fell %v from %.2f to %.2f", throughput.Name, throughput.Change, throughput.Baseline, throughput.Current)
+	}
+	comparison.Metrics = append(comparison.Metrics, throughput)
+
+	errorRate := MetricComparison{
+		Name : "Error rate (%)",
+		Baseline : reportErrorRate(baseline),
+		Current : reportErrorRate(current),
+		PValue : -1,
+	}
+	errorRate.Change = fmt.Sprintf("%+.2f points", errorRate.Current - errorRate.Baseline)
+	if (errorRate.Current - errorRate.Baseline > opts.ErrorRateThreshold) {
+		errorRate.Regression, errorRate.PValue = isSignificant(bucketErrorRates(baseline), bucketErrorRates(current), opts.Significance)
+		errorRate.Description = fmt.Sprintf("%v rose %v from %.2f to %.2f", errorRate.Name, errorRate.Change, errorRate.Baseline, errorRate.Current)
+	}
+	comparison.Metrics = append(comparison.Metrics, errorRate)
+
+	return comparison
+}
+
+//WriteComparison prints a table of the metrics followed by each regression
+func WriteComparison(output io.Writer, comparison Comparison) {
+	table := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(table, "Metric\tBaseline\tCurrent\tChange\tp\t")
+	for _, metric := range comparison.Metrics {
+		pValue := "-"
+		if (metric.PValue >= 0) {
+			pValue = fmt.Sprintf("%.3f", metric.PValue)
+		}
+		marker := ""
+		if (metric.Regression) {
+			marker = "REGRESSION"
+		} else if (metric.Description != "") {
+			marker = "past threshold, not significant"
+		}
+		fmt.Fprintf(table, "%v\t%.2f\t%.2f\t%v\t%v\t%v\n", metric.Name, metric.Baseline, metric.Current, metric.Change, pValue, marker)
+	}
+	table.Flush()
+
+	regressions := comparison.Regressions()
+	if (len(regressions) == 0) {
+		fmt.Fprintln(output, "\nNo regressions found")
+		return
+	}
+	fmt.Fprintln(output, "")
+	for _, regression := range regressions {
+		fmt.Fprintf(output, "REGRESSION: %v\n", regression.Description)
+	}
+}
+
+//isSignificant tests whether current is stochastically greater than baseline, a regression counts without the test
+//when it's turned off or either run has too few samples to test
+func isSignificant(baseline []float64, current []float64, significance float64) (significant bool, pValue float64) {
+	if (significance <= 0 || len(baseline) < minCompareSamples || len(current) < minCompareSamples) {
+		return true, -1
+	}
+	pValue = MannWhitneyU(baseline, current)
+	return pValue < significance, pValue
+}
+
+//MannWhitneyU is the one sided p value, by the normal approximation with a correction for ties, of current not being greater than baseline
+func MannWhitneyU(baseline []float64, current []float64) float64 {
+	type sample struct {
+		value float64
+		current bool
+	}
+	samples := []sample{}
+	for _, value := range baseline {
+		samples = append(samples, sample{value : value})
+	}
+	for _, value := range current {
+		samples = append(samples, sample{value : value, current : true})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	n1, n2 := float64(len(baseline)), float64(len(current))
+	n := n1 + n2
+	currentRanks, tieCorrection := 0.0, 0.0
+	for start := 0; start < len(samples); {
+		end := start
+		for (end < len(samples) && samples[end].value == samples[start].value) {
+			end += 1
+		}
+		//Tied values share the mean of the ranks they span, ranks start at 1
+		rank := float64(start + end + 1) / 2
+		ties := float64(end - start)
+		tieCorrection += ties * ties * ties - ties
+		for index := start; index < end; index++ {
+			if (samples[index].current) {
+				currentRanks += rank
+			}
+		}
+		start = end
+	}
+
+	u := currentRanks - n2 * (n2 + 1) / 2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieCorrection / (n * (n - 1))))
+	if (sigma == 0) {
+		return 1
+	}
+	z := (u - mean - 0.5) / sigma
+	return 0.5 * math.Erfc(z / math.Sqrt2)
+}
+
+func findPercentileMs(percentiles []ReportPercentile, percentile float64) (ms float64, ok bool) {
+	for _, candidate := range percentiles {
+		if (candidate.Percentile == percentile) {
+			return candidate.Ms, true
+		}
+	}
+	return 0, false
+}
+
+//fullBuckets leaves out the last bucket of the time series, which only covers part of a second
+func fullBuckets(report Report) []ReportBucket {
+	if (len(report.TimeSeries) < 2) {
+		return report.TimeSeries
+	}
+	return report.TimeSeries[:len(report.TimeSeries) - 1]
+}
+
+func bucketPercentiles(report Report, percentile float64) (values []float64) {
+	for _, bucket := range fullBuckets(report) {
+		ms, ok := findPercentileMs(bucket.Latency.Percentiles, percentile)
+		if (ok && bucket.Responses > 0) {
+			values = append(values, ms)
+		}
+	}
+	return values
+}
+
+func bucketResponses(report Report) (values []float64) {
+	for _, bucket := range fullBuckets(report) {
+		values = append(values, float64(bucket.Responses))
+	}
+	return values
+}
+
+//bucketErrorRates is the percentage of requests sent each second that failed, as reportErrorRate is for the whole test.
+//A response with the wrong status is both a response and an error, so the responses can't be the denominator.
+func bucketErrorRates(report Report) (values []float64) {
+	for _, bucket := range fullBuckets(report) {
+		if (bucket.RequestsSent > 0) {
+			values = append(values, float64(bucket.Errors) / float64(bucket.RequestsSent) * 100)
+		}
+	}
+	return values
+}
+
+func negate(values []float64) (negated []float64) {
+	for _, value := range values {
+		negated = append(negated, -value)
+	}
+	return negated
+}
+
+//reportErrorRate is the percentage of requests issued that failed
+func reportErrorRate(report Report) float64 {
+	if (report.Requests.Issued == 0) {
+		return 0
+	}
+	return float64(report.Requests.Failures) / float64(report.Requests.Issued) * 100
+}
+
+func percentageChange(baseline float64, current float64) string {
+	if (baseline == 0) {
+		if (current == 0) {
+			return "+0.0%"
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", (current - baseline) / baseline * 100)
+}
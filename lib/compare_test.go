@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//compareReport has a bucket for each of the per second p50 latencies, with the failures spread across them, and a last partial bucket
+func compareReport(p50s []float64, rate int, failures int) Report {
+	stats := AggregatedStats{
+		Percentiles : []float64{0.5},
+		TotalRequests : rate * len(p50s),
+		TotalResponses : rate * len(p50s) - failures,
+		Failures : failures,
+	}
+	total := 0.0
+	for _, p50 := range p50s {
+		stats.Buckets = append(stats.Buckets, MetricsBucket{
+			RequestsSent : rate,
+			Responses : rate - failures / len(p50s),
+			Errors : failures / len(p50s),
+			Percentiles : []time.Duration{time.Duration(p50 * float64(time.Millisecond))},
+		})
+		total += p50
+	}
+	stats.Buckets = append(stats.Buckets, MetricsBucket{RequestsSent : 1, Responses : 1, Percentiles : []time.Duration{time.Second}})
+	stats.TotalTimePercentiles = []time.Duration{time.Duration(total / float64(len(p50s)) * float64(time.Millisecond))}
+	stats.AverageRespThroughput = float64(rate)
+	return NewReport(stats, DefaultRequestOptions)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := compareReport([]float64{10, 11, 9, 10, 12, 10, 11, 9}, 100, 0)
+
+	c.Convey("When the current run's latency is consistently higher", t, func(){
+		current := compareReport([]float64{14, 15, 13, 14, 16, 15, 14, 13}, 100, 0)
+		comparison := CompareReports(baseline, current, DefaultCompareOptions)
+
+		c.Convey("The percentile is a significant regression", func(){
+			regressions := comparison.Regressions()
+			c.So(len(regressions), c.ShouldEqual, 1)
+			c.So(regressions[0].Name, c.ShouldEqual, "p50 latency (ms)")
+			c.So(regressions[0].PValue, c.ShouldBeBetween, 0, 0.05)
+		})
+	})
+
+	c.Convey("When the current run's latency is higher on average because of one slow second", t, func(){
+		current := compareReport([]float64{10, 11, 9, 10, 12, 10, 11, 40}, 100, 0)
+		comparison := CompareReports(baseline, current, DefaultCompareOptions)
+
+		c.Convey("It's past the threshold but not significant", func(){
+			c.So(comparison.Metrics[0].Description, c.ShouldNotEqual, "")
+			c.So(comparison.Metrics[0].Regression, c.ShouldBeFalse)
+		})
+
+		c.Convey("Unless the test is turned off", func(){
+			opts := DefaultCompareOptions
+			opts.Significance = 0
+			c.So(len(CompareReports(baseline, current, opts).Regressions()), c.ShouldEqual, 1)
+		})
+	})
+
+	c.Convey("Falling throughput and rising errors are regressions", t, func(){
+		current := compareReport([]float64{10, 11, 9, 10, 12, 10, 11, 9}, 50, 40)
+		regressions := CompareReports(baseline, current, DefaultCompareOptions).Regressions()
+		c.So(len(regressions), c.ShouldEqual, 2)
+		c.So(regressions[0].Description, c.ShouldEqual, "Throughput (resp/s) fell -50.0% from 100.00 to 50.00")
+		c.So(regressions[1].Description, c.ShouldEqual, "Error rate (%) rose +10.00 points from 0.00 to 10.00")
+	})
+
+	c.Convey("Responses with the wrong status count once towards the error rate of each second, as they do overall", t, func(){
+		current := compareReport([]float64{10, 11, 9, 10, 12, 10, 11, 9}, 100, 0)
+		current.Requests.Failures = 80
+		for index := range current.TimeSeries {
+			current.TimeSeries[index].Errors = 10
+		}
+
+		c.So(reportErrorRate(current), c.ShouldEqual, 10)
+		c.So(len(bucketErrorRates(current)), c.ShouldEqual, 8)
+		for _, rate := range bucketErrorRates(current) {
+			c.So(rate, c.ShouldEqual, 10)
+		}
+		regressions := CompareReports(baseline, current, DefaultCompareOptions).Regressions()
+		c.So(len(regressions), c.ShouldEqual, 1)
+		c.So(regressions[0].Description, c.ShouldEqual, "Error rate (%) rose +10.00 points from 0.00 to 10.00")
+	})
+
+	c.Convey("Ties are shared so identical runs aren't significant", t, func(){
+		c.So(MannWhitneyU([]float64{1, 1, 1, 1, 1}, []float64{1, 1, 1, 1, 1}), c.ShouldEqual, 1)
+		c.So(MannWhitneyU([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}), c.ShouldBeLessThan, 0.01)
+		c.So(MannWhitneyU([]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}), c.ShouldBeGreaterThan, 0.99)
+	})
+
+	c.Convey("The compare command exits with a threshold failure when it finds a regression", t, func(){
+		dir, err := ioutil.TempDir("", "compare")
+		c.So(err, c.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		baselinePath, currentPath := filepath.Join(dir, "baseline.json"), filepath.Join(dir, "current.json")
+		c.So(WriteReport(baselinePath, baseline), c.ShouldBeNil)
+		c.So(WriteReport(currentPath, compareReport([]float64{14, 15, 13, 14, 16, 15, 14, 13}, 100, 0)), c.ShouldBeNil)
+
+		output := bytes.NewBufferString("")
+		c.So(DoCompare([]string{baselinePath, currentPath}, output), c.ShouldEqual, ExitThresholdFailure)
+		c.So(output.String(), c.ShouldContainSubstring, "REGRESSION: p50 latency (ms) rose +39.0% from 10.25 to 14.25")
+
+		output.Reset()
+		c.So(DoCompare([]string{"-latency", "50", baselinePath, currentPath}, output), c.ShouldEqual, ExitPassed)
+		c.So(output.String(), c.ShouldContainSubstring, "No regressions found")
+
+		c.So(DoCompare([]string{baselinePath}, output), c.ShouldEqual, ExitConfigurationError)
+		c.So(DoCompare([]string{baselinePath, filepath.Join(dir, "missing.json")}, output), c.ShouldEqual, ExitConfigurationError)
+	})
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"github.com/xeipuuv/gojsonschema"
 	"time"
 	"flag"
 	"runtime"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"strconv"
 	"errors"
+	"math"
 )
 
 type RequestOptions struct {
@@ -23,6 +25,21 @@ type RequestOptions struct {
 	EnableKeepAlive bool
 	TLSHandshakeTimeout time.Duration
 
+	//Requests to issue, either loaded from RequestsFile or built from the single request params above
+	RequestsFile string
+	Requests []RequestDefinition
+	Selection string
+
+	//Script is a Lua script run before and after every request that doesn't have its own
+	ScriptPath string
+	Script *Script
+
+	//Feeder rows are available to every request as template vars
+	FeederFile string
+	FeederStrategy string
+	FeederExhausted string
+	Feeder *Feeder
+
 	//Execution control params
 	Mode string
 
@@ -31,9 +48,29 @@ type RequestOptions struct {
 	RequestsToIssue int
 	Concurrency int
 
+	//Arrival is 'closed' for executors to pull requests as fast as they can, or 'constant'/'poisson' to schedule them at Rate
+	Arrival string
+	MaxConcurrency int
+	Overflow string
+
+	//Profile is a series of stages that change the rate or concurrency during the test
+	ProfileSpec string
+	Profile *LoadProfile
+
 	ExecuteSingleRequest bool
 	IncreaseRateToFailure bool
 
+	//Capacity search params, used when IncreaseRateToFailure is set
+	Search string
+	SearchHoldTime time.Duration
+	SearchStep float64
+	SearchMax float64
+	SearchPrecision float64
+
+	//SampleRate is the fraction of raw response stats kept alongside the summaries, 1 keeps every one and 0 none
+	Samples string
+	SampleRate float64
+
 	MaxExecutionSecs int
 	MaxExecutionTime time.Duration
 
@@ -52,22 +89,50 @@ type RequestOptions struct {
 	Throughput float64
 	PercentileLatencies []float64
 	Percentiles []float64
-	ResponseCode int
+	ResponseCodes StatusCodes
 
 	//Validation params
 	JSONSchema string
+	//Schema is JSONSchema compiled, it's shared by every request using the schema from the options
+	Schema *gojsonschema.Schema
+	//ValidationRate is the fraction of responses validated against the schema, parsed from Validation, which is 'all', 'none' or a percentage
+	Validation string
+	ValidationRate float64
 	RespHeaders map[string]string
+	//Assertions apply to every request that doesn't have its own
+	Assertions Assertions
 }
 
 type OutputOptions struct {
 	ShowHTML bool
 	ShowCLI bool
+
+	//Headless turns off the cli and html renderers and prints plain progress lines instead
+	Headless bool
+
+	//ReportPath is where the JSON report is written when the test finishes, nothing is written when it's empty
+	ReportPath string
+	//JUnitPath is where the JUnit XML of thresholds and validation is written when the test finishes
+	JUnitPath string
+	//HTMLReportPath is where a self-contained html report of the final stats is written when the test finishes
+	HTMLReportPath string
+	//StaticDir holds the html report template and the assets inlined into it
+	StaticDir string
+	//MetricsAddress is where Prometheus metrics are served at /metrics while the test runs, they're not served when it's empty
+	MetricsAddress string
+
+	//PushAddress is a udp:// or tcp:// address to push the rolling window's stats to every PushInterval in PushFormat, nothing is pushed when it's empty
+	PushAddress string
+	PushFormat string
+	PushPrefix string
+	PushTags map[string]string
+	PushInterval time.Duration
 }
 
 var DefaultRequestOptions RequestOptions = RequestOptions{
 	URL : "http://localhost:8080/test/fail/validate",
 	Method : "GET",
-	ResponseCode : 200,
+	ResponseCodes : OnlyStatusCode(200),
 
 	Timeout : time.Second * 2,
 	KeepAlive : time.Second * 2,
@@ -76,8 +141,16 @@ var DefaultRequestOptions RequestOptions = RequestOptions{
 	CPUs : runtime.NumCPU(),
 	Rate : 10,
 	Concurrency: 5,
+	MaxConcurrency: 100,
+	Arrival : ClosedArrival,
+	Overflow : DelayOverflow,
+	Samples : "none",
+	Validation : "all",
 
 	MaxExecutionSecs : 30*60,
+	Search : BinarySearch,
+	SearchHoldTime : time.Second * 30,
+	SearchPrecision : 5,
 	WarmUpSecs : 2,
 	Percentiles : []float64{0.01, 0.05, 0.25, 0.50, 0.75, 0.95, 0.99, 0.999, 0.9999},
 
@@ -96,6 +169,10 @@ var DefaultRequestOptions RequestOptions = RequestOptions{
 var DefaultOutputOptions OutputOptions = OutputOptions{
 	ShowHTML : true,
 	ShowCLI : true,
+	StaticDir : DefaultStaticDir,
+	PushFormat : StatsDFormat,
+	PushPrefix : "deathstar",
+	PushInterval : time.Second * 10,
 }
 
 var DefaultMode = "scale"
@@ -111,9 +188,16 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 	method := flag.String("method", defaultReqOpts.Method , "the url method to use")
 	defaultHeaders := fmt.Sprintf("%v",defaultReqOpts.Headers)
 	reqHeaderStr := flag.String("headers", defaultHeaders , "Requests headers for requests, in the form of a comma separated list; 'Max-Forwards:10,Accept-Charset:utf-8'")
+	requestsFile := flag.String("requests", defaultReqOpts.RequestsFile, "A JSONL file of requests to issue instead of -url/-method, one JSON object per line with method, url, headers, body, responseCode, schema and weight, a weight of 0 disables the request")
+	scriptLocation := flag.String("script", defaultReqOpts.ScriptPath, "A Lua script defining before(request) and/or after(request, response) hooks, run for every request without its own script")
+	feederFile := flag.String("feeder", defaultReqOpts.FeederFile, "A CSV (with a header row) or JSONL file of test data, each row's columns are available to requests as {{.column}}")
+	feederStrategy := flag.String("feederstrategy", SequentialFeeder, "How feeder rows are handed out, 'sequential', 'random' or 'unique' (each executor keeps its own row)")
+	feederExhausted := flag.String("feederexhausted", WrapWhenExhausted, "What to do when the feeder runs out of rows, 'wrap' to start again or 'stop' to end the test")
+	selection := flag.String("selection", DefaultSelection, "How requests from the -requests file are handed out, 'roundrobin' or 'weighted'")
 
 	//Validation params
-	jsonSchemaLocation := flag.String("schema", defaultReqOpts.JSONSchema, "The location of the schema file")
+	jsonSchemaLocation := flag.String("schema", defaultReqOpts.JSONSchema, "The location of the schema file, leave empty to skip schema validation")
+	validation := flag.String("validate", defaultReqOpts.Validation, "Responses to validate against the schema, 'all', 'none' or a percentage such as '10%', so the cost of validation can be traded for throughput")
 
 	defaultRespHeaders := fmt.Sprintf("%v",defaultReqOpts.RespHeaders)
 	respHeaderStr := flag.String("respheaders", defaultRespHeaders, "Response headers to validate in responses, in the form of a comma separated list; 'Max-Forwards:10,Accept-Charset:utf-8'")
@@ -121,10 +205,26 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 	//Execution control params
 	showCLI := flag.Bool("cli", defaultOutOpts.ShowCLI, "show fancy cli")
 	showHTML := flag.Bool("html", defaultOutOpts.ShowHTML, "serve fancy html")
+	headless := flag.Bool("headless", defaultOutOpts.Headless, "print plain progress lines instead of showing the cli or serving html, for CI")
+	reportPath := flag.String("out", defaultOutOpts.ReportPath, "A file to write a JSON report of the final stats to when the test finishes")
+	junitPath := flag.String("junit", defaultOutOpts.JUnitPath, "A file to write JUnit XML to when the test finishes, with a test case for each threshold and failure category")
+	htmlReportPath := flag.String("htmlreport", defaultOutOpts.HTMLReportPath, "A file to write a self-contained html report of the final stats to when the test finishes, for attaching to tickets")
+	staticDir := flag.String("staticdir", defaultOutOpts.StaticDir, "The directory holding the html report template and its assets")
+	metricsAddress := flag.String("metrics", defaultOutOpts.MetricsAddress, "An address such as :9102 to serve Prometheus metrics at /metrics while the test runs")
+	pushAddress := flag.String("push", defaultOutOpts.PushAddress, "A udp://host:port or tcp://host:port address to push live metrics to")
+	pushFormat := flag.String("pushformat", defaultOutOpts.PushFormat, "The format of pushed metrics, 'statsd', 'graphite' or 'influx'")
+	pushPrefix := flag.String("pushprefix", defaultOutOpts.PushPrefix, "The prefix of pushed metric names, or the measurement name for influx")
+	rawPushTags := flag.String("pushtags", "", "Tags to push with every metric, such as test=checkout,env=staging")
+	pushIntervalSecs := flag.Int("pushinterval", int(defaultOutOpts.PushInterval.Seconds()), "Seconds between pushes of live metrics")
 	rate := flag.Float64("rate", defaultReqOpts.Rate, "req/s to issue")
 	numReq := flag.Int("reqs", defaultReqOpts.RequestsToIssue, "Total requests to issue")
 	concurrency := flag.Int("conc", defaultReqOpts.Concurrency, "Concurrent requests to issue")
 	cpus := flag.Int("cpus", defaultReqOpts.CPUs, "CPUs to execute with")
+	arrival := flag.String("arrival", defaultReqOpts.Arrival, "'closed' for executors to issue requests as fast as they can, 'constant' or 'poisson' to schedule requests at -rate req/s whether or not the executors keep up")
+	maxConcurrency := flag.Int("maxconc", defaultReqOpts.MaxConcurrency, "The most executors the pool can grow to when scheduled requests find no free executor")
+	overflow := flag.String("overflow", defaultReqOpts.Overflow, "What to do with a scheduled request when the pool can't grow, 'delay' until an executor is free or 'drop' it")
+	profileSpec := flag.String("profile", defaultReqOpts.ProfileSpec, "A load profile of comma separated stages to follow instead of a fixed rate, e.g. 'ramp 200rps 2m, hold 10m, spike 800rps 30s, ramp 0rps 1m'. Stages are ramp, step, spike, hold or soak, targets are req/s (rps) or executors (conc)")
+	samples := flag.String("samples", defaultReqOpts.Samples, "Raw response stats to keep alongside the latency histograms, 'none', 'all' or a percentage such as '5%'. Raw stats include request and response payloads so keeping them all grows memory for as long as the test runs")
 	keepAlive := flag.Bool("keepalive", defaultReqOpts.EnableKeepAlive, "Execute with keep alive")
 
 	executionSecs := flag.Int("time", defaultReqOpts.MaxExecutionSecs, "Maximum time (in secs) to execute the test")
@@ -135,7 +235,7 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 	renderFrequencyMs := flag.Int("render", defaultReqOpts.RenderFrequencyMs, "Time in between each push of data to the frontend")
 
 	//Failure detection params
-	expectedResponseCode := flag.Int("responsecode", defaultReqOpts.ResponseCode, "The expected response code for all requests")
+	rawResponseCodes := flag.String("responsecode", defaultReqOpts.ResponseCodes.String(), "The expected response codes for all requests, a comma separated list of codes and ranges such as '200-299,304'")
 	failureHarvest := flag.Float64("harvest", defaultReqOpts.Harvest, "The expected harvest % (percentage of requests that should get a response), below this value indicates a test failure")
 	failureYield := flag.Float64("yield", defaultReqOpts.Yield, "The expected yield % (percentage of responses that should validate), below this value indicates a test failure")
 	failureThroughput := flag.Float64("throughput", defaultReqOpts.Throughput, "The expected resp/s that should be returned by the test, below this value indicates a test failure")
@@ -143,7 +243,13 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 	defaultPercentileLatencies := fmt.Sprintf("%v",defaultReqOpts.PercentileLatencies)
 	failurePercentilesString := flag.String("percentiles", defaultPercentileLatencies , "The expected percentile latencies (in the form of a comma separated list) to achieve in the test, latencies below these values indicate a test failure. Latencies are for the 1, 5, 25, 50, 75, 95, 99, 99.9, 99.99 percentiles")
 
-	mode := flag.String("mode", DefaultMode , "'fail' to continually ramp up request speed until failure, 'scale' for a test with consistent load, 'valid' for a test with a single request")
+	search := flag.String("search", defaultReqOpts.Search, "How 'search' mode looks for the highest rate that passes, 'step' to raise the rate by -searchstep until a level fails or 'binary' to double it until a level fails and then bisect")
+	searchHoldSecs := flag.Int("searchhold", int(defaultReqOpts.SearchHoldTime.Seconds()), "Time (in secs) each level of a capacity search is held before it's judged against -harvest, -yield, -throughput and -percentiles")
+	searchStep := flag.Float64("searchstep", defaultReqOpts.SearchStep, "The req/s a step search adds at each level, defaults to -rate")
+	searchMax := flag.Float64("searchmax", defaultReqOpts.SearchMax, "The highest req/s a capacity search will try, 0 for no limit")
+	searchPrecision := flag.Float64("searchprecision", defaultReqOpts.SearchPrecision, "A binary search stops once the highest passing and lowest failing rates are within this percentage of each other")
+
+	mode := flag.String("mode", DefaultMode , "'search' to find the highest rate that passes the failure thresholds starting from -rate, 'fail' for a step search that stops at the first failure, 'scale' for a test with consistent load, 'valid' for a test with a single request")
 	Log("top", fmt.Sprintf("Starting in '%v' mode", *mode) )
 
 	flag.Parse()
@@ -158,9 +264,54 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 		return
 	}
 
-	jsonSchema, err := ioutil.ReadFile(*jsonSchemaLocation)
+	jsonSchema := []byte{}
+	if (*jsonSchemaLocation != "") {
+		jsonSchema, err = ioutil.ReadFile(*jsonSchemaLocation)
+		if (err != nil) {
+			return reqOpts, outOpts, errors.New(fmt.Sprintf("Could not load schema file at %v err: %v",*jsonSchemaLocation, err))
+		}
+	}
+
+	responseCodes, err := ParseStatusCodes(*rawResponseCodes)
 	if (err != nil) {
-		return reqOpts, outOpts, errors.New(fmt.Sprintf("Could not load schema file at %v err: %v",*jsonSchemaLocation, err))
+		return reqOpts, outOpts, err
+	}
+
+	pushTags, err := ParsePushTags(*rawPushTags)
+	if (err != nil) {
+		return reqOpts, outOpts, err
+	}
+	if (*pushAddress != "") {
+		_, _, err = ParsePushAddress(*pushAddress)
+		if (err != nil) {
+			return reqOpts, outOpts, err
+		}
+		_, err = NewPushFormat(*pushFormat)
+		if (err != nil) {
+			return reqOpts, outOpts, err
+		}
+		if (*pushIntervalSecs < 1) {
+			return reqOpts, outOpts, errors.New(fmt.Sprintf("The push interval must be at least a second, not %v", *pushIntervalSecs))
+		}
+	}
+
+	if (*maxConcurrency < *concurrency) {
+		*maxConcurrency = *concurrency
+	}
+
+	explicitFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
+
+	//A profile runs for its own duration unless -time or -reqs say otherwise, PrepareRequestOptions fills in those left at zero
+	if (*profileSpec != "") {
+		if (!explicitFlags["time"]) {
+			*executionSecs = 0
+		}
+		if (!explicitFlags["reqs"]) {
+			*numReq = 0
+		}
 	}
 
 	executionTime := time.Duration(*executionSecs) * time.Second
@@ -174,25 +325,47 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 		return
 	}
 
+	increaseRateToFailure := false
+	executeSingleRequest := false
 	if (*mode == "fail") {
-		reqOpts.IncreaseRateToFailure = true
+		increaseRateToFailure = true
+		*search = StepSearch
+	} else if (*mode == "search") {
+		increaseRateToFailure = true
 	} else if (*mode == "scale" ) {
 	} else if (*mode == "valid" ) {
-		reqOpts.ExecuteSingleRequest = true
+		executeSingleRequest = true
+	}
+
+	//A capacity search sets the rate itself, so it runs as an open model until it's done unless -reqs or -arrival say otherwise
+	if (increaseRateToFailure) {
+		if (!explicitFlags["reqs"]) {
+			*numReq = math.MaxInt32
+		}
+		if (*arrival == ClosedArrival) {
+			*arrival = ConstantArrival
+		}
 	}
 
 	if *showCLI {
 		showLogs = false
 	}
 
-	return RequestOptions{
+	reqOpts = RequestOptions{
 		//Request control params
 		Method : *method,
 		URL : *url,
 		Headers : reqHeaders,
+		RequestsFile : *requestsFile,
+		Selection : *selection,
+		ScriptPath : *scriptLocation,
+		FeederFile : *feederFile,
+		FeederStrategy : *feederStrategy,
+		FeederExhausted : *feederExhausted,
 
 		//Validation params
 		JSONSchema : string(jsonSchema),
+		Validation : *validation,
 		RespHeaders : respHeaders,
 
 		//Execution control params
@@ -206,6 +379,20 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 		CPUs : *cpus,
 		Concurrency : *concurrency,
 		RequestsToIssue : *numReq,
+		Arrival : *arrival,
+		MaxConcurrency : *maxConcurrency,
+		Overflow : *overflow,
+		ProfileSpec : *profileSpec,
+
+		ExecuteSingleRequest : executeSingleRequest,
+		IncreaseRateToFailure : increaseRateToFailure,
+		Search : *search,
+		SearchHoldTime : time.Duration(*searchHoldSecs) * time.Second,
+		SearchStep : *searchStep,
+		SearchMax : *searchMax,
+		SearchPrecision : *searchPrecision,
+
+		Samples : *samples,
 
 		MaxExecutionTime : executionTime,
 		WarmUpTime : warmUpTime,
@@ -213,16 +400,38 @@ func digestOptions()(reqOpts RequestOptions, outOpts OutputOptions, err error) {
 		RenderFrequency : renderFrequencyTime,
 
 		//Failure detection params
-		ResponseCode: *expectedResponseCode,
+		ResponseCodes: responseCodes,
 		Harvest: *failureHarvest,
 		Yield: *failureYield,
 		Throughput: *failureThroughput,
 		PercentileLatencies: failurePercentiles,
 		Percentiles : defaultReqOpts.Percentiles,
+	}
+
+	//Selection, arrival, overflow and search are checked, the profile and samples parsed and the script, feeder and requests loaded the same way as for a Plan
+	reqOpts, err = PrepareRequestOptions(reqOpts)
+	if (err != nil) {
+		return reqOpts, outOpts, err
+	}
+
+	if (*headless) {
+		*showHTML, *showCLI = false, false
+	}
 
-	}, OutputOptions {
+	return reqOpts, OutputOptions {
 		ShowHTML : *showHTML,
 		ShowCLI: *showCLI,
+		Headless : *headless,
+		ReportPath : *reportPath,
+		JUnitPath : *junitPath,
+		HTMLReportPath : *htmlReportPath,
+		StaticDir : *staticDir,
+		MetricsAddress : *metricsAddress,
+		PushAddress : *pushAddress,
+		PushFormat : *pushFormat,
+		PushPrefix : *pushPrefix,
+		PushTags : pushTags,
+		PushInterval : time.Duration(*pushIntervalSecs) * time.Second,
 	}, nil
 }
 
@@ -241,6 +450,21 @@ func parsePercentiles(rawPercentileLatency string, percentiles []float64) (perce
 	return
 }
 
+//parseSamples turns 'none', 'all' or a percentage into the fraction of raw stats to keep, or of responses to validate
+func parseSamples(name string, rawSamples string) (sampleRate float64, err error) {
+	switch rawSamples {
+	case "none":
+		return 0, nil
+	case "all":
+		return 1, nil
+	}
+	percentage, err := strconv.ParseFloat(strings.TrimSuffix(rawSamples, "%"), 64)
+	if (err != nil || percentage < 0 || percentage > 100) {
+		return 0, errors.New(fmt.Sprintf("Unknown %v '%v', expected 'none', 'all' or a percentage such as '5%%'", name, rawSamples))
+	}
+	return percentage / 100, nil
+}
+
 func parseHeaders(headerStr string) (headers map[string]string, err error) {
 	headers = make(map[string]string)
 	headerStr = strings.TrimPrefix(headerStr, "map")
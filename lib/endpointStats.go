@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"sort"
+	"time"
+)
+
+//EndpointStats breaks down the aggregated stats for a single request definition, identified by its label
+type EndpointStats struct {
+	Label string
+
+	TotalRequests int
+	TotalResponses int
+	TotalValidResponses int
+
+	Yield float64
+	Harvest float64
+
+	TotalTimePercentiles []time.Duration
+	TimeToRespondPercentiles []time.Duration
+	TimeToConnectPercentiles []time.Duration
+	ResponseTimePercentiles []time.Duration
+
+	MaxTotalTime time.Duration
+	MeanTotalTime time.Duration
+	MinTotalTime time.Duration
+	MaxResponseTime time.Duration
+
+	Failures int
+	FailureCounts map[string]FailureCount
+}
+
+//DetermineEndpointStats analyses the summary of each label the same way the overall stats are analysed.
+//The steps of a chain are summarised under their own labels, as well as the chain as a whole under its label.
+//Endpoints are returned in the order of labels, any label summarised but not in labels is appended after them in alphabetical order.
+func DetermineEndpointStats(labels []string, percentiles []float64, summaries map[string]*StatsSummary, requestsIssued map[string]int) (endpoints []EndpointStats) {
+	orderedLabels := append([]string{}, labels...)
+	otherLabels := []string{}
+	for label := range summaries {
+		if (!containsString(orderedLabels, label)) {
+			otherLabels = append(otherLabels, label)
+		}
+	}
+	sort.Strings(otherLabels)
+	orderedLabels = append(orderedLabels, otherLabels...)
+
+	for _, label := range orderedLabels {
+		summary, ok := summaries[label]
+		if (!ok) {
+			summary = NewStatsSummary()
+		}
+
+		endpoint := EndpointStats{
+			Label : label,
+			TotalRequests : requestsIssued[label],
+		}
+		//Steps aren't issued by the spawner, so every step that was recorded is a step that was issued
+		if _, ok := requestsIssued[label]; !ok {
+			endpoint.TotalRequests = summary.Requests
+		}
+
+		endpoint.TimeToConnectPercentiles, endpoint.TimeToRespondPercentiles, endpoint.TotalTimePercentiles = DeterminePercentilesLatencies(percentiles, summary)
+		endpoint.ResponseTimePercentiles, endpoint.MaxResponseTime, _ = DetermineResponseTimeLatencies(percentiles, summary)
+		endpoint.MaxTotalTime, _, _ = DetermineMaxLatencies(summary)
+		endpoint.MinTotalTime = time.Duration(summary.TotalTime.Min)
+		endpoint.MeanTotalTime = summary.TotalTime.Mean()
+
+		endpoint.Failures, endpoint.FailureCounts = summary.Failures, summary.FailureCounts
+
+		endpoint.TotalResponses = summary.Responses
+		endpoint.TotalValidResponses = summary.ValidResponses
+		endpoint.Harvest = Harvest(endpoint.TotalResponses, endpoint.TotalRequests)
+		endpoint.Yield = Yield(endpoint.TotalResponses, endpoint.TotalValidResponses)
+
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+func containsString(strs []string, str string) bool {
+	for _, candidate := range strs {
+		if (candidate == str) {
+			return true
+		}
+	}
+	return false
+}
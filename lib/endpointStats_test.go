@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"errors"
+	"time"
+)
+
+func TestDetermineEndpointStats(t *testing.T) {
+	c.Convey("With stats for a request that waited for an executor", t, func(){
+		start := time.Now()
+		stats := []ResponseStats{
+			{Label : "fast", StartTime : start, TotalTime : time.Millisecond * 10},
+			{Label : "slow", IntendedTime : start.Add(-time.Second), StartTime : start, TotalTime : time.Millisecond * 10},
+		}
+
+		summaries := map[string]*StatsSummary{
+			"fast" : SummariseStats(stats[:1]),
+			"slow" : SummariseStats(stats[1:]),
+		}
+		endpoints := DetermineEndpointStats([]string{"fast", "slow"}, []float64{0.5}, summaries, map[string]int{"fast": 1, "slow": 1})
+
+		c.Convey("Service time ignores the wait but response time includes it", func(){
+			c.So(len(endpoints), c.ShouldEqual, 2)
+			c.So(endpoints[1].TotalTimePercentiles[0], c.ShouldEqual, time.Millisecond * 10)
+			c.So(endpoints[1].ResponseTimePercentiles[0], c.ShouldEqual, time.Second + time.Millisecond * 10)
+		})
+
+		c.Convey("Without an intended time the response time is the service time", func(){
+			c.So(endpoints[0].ResponseTimePercentiles[0], c.ShouldEqual, time.Millisecond * 10)
+		})
+	})
+
+	c.Convey("With responses for a mix of labels", t, func(){
+		refused := *NewRequestExecutionError(errors.New("connection refused"))
+		stats := []ResponseStats{
+			{Label : "GET /items", StatusCode : 200, TotalTime : time.Millisecond * 10},
+			{Label : "POST /items", StatusCode : 201, TotalTime : time.Millisecond * 40},
+			{Label : "GET /items", StatusCode : 200, TotalTime : time.Millisecond * 20},
+			{Label : "GET /items", Failures : []DescriptiveError{refused}},
+			{Label : "POST /items", StatusCode : 500, TotalTime : time.Millisecond * 80, Failures : []DescriptiveError{*NewStatusCodeError(500)}},
+			{Label : "GET /items", StatusCode : 200, TotalTime : time.Millisecond * 30},
+			{Label : "login > token", StatusCode : 200, TotalTime : time.Millisecond * 5},
+		}
+		summaries := make(map[string]*StatsSummary)
+		for _, stat := range stats {
+			if _, ok := summaries[stat.Label]; !ok {
+				summaries[stat.Label] = NewStatsSummary()
+			}
+			summaries[stat.Label].Record(stat)
+		}
+		issued := map[string]int{"GET /items": 5, "POST /items": 2, "DELETE /items": 0}
+		endpoints := DetermineEndpointStats([]string{"GET /items", "POST /items", "DELETE /items"}, []float64{0.5, 1}, summaries, issued)
+
+		c.Convey("Endpoints follow the labels given, then any other label recorded", func(){
+			labels := []string{}
+			for _, endpoint := range endpoints {
+				labels = append(labels, endpoint.Label)
+			}
+			c.So(labels, c.ShouldResemble, []string{"GET /items", "POST /items", "DELETE /items", "login > token"})
+		})
+
+		c.Convey("Each endpoint counts only its own requests, responses and failures", func(){
+			get, post := endpoints[0], endpoints[1]
+			c.So(get.TotalRequests, c.ShouldEqual, 5)
+			c.So(get.TotalResponses, c.ShouldEqual, 3)
+			c.So(get.TotalValidResponses, c.ShouldEqual, 3)
+			c.So(get.Failures, c.ShouldEqual, 1)
+			c.So(get.FailureCounts[failureKey(refused)].Count, c.ShouldEqual, 1)
+			c.So(get.Harvest, c.ShouldEqual, 60)
+			c.So(get.Yield, c.ShouldEqual, 100)
+
+			c.So(post.TotalRequests, c.ShouldEqual, 2)
+			c.So(post.TotalResponses, c.ShouldEqual, 2)
+			c.So(post.TotalValidResponses, c.ShouldEqual, 1)
+			c.So(post.Harvest, c.ShouldEqual, 100)
+			c.So(post.Yield, c.ShouldEqual, 50)
+		})
+
+		c.Convey("Each endpoint's latencies come from its own responses", func(){
+			get, post := endpoints[0], endpoints[1]
+			c.So(get.MinTotalTime, c.ShouldEqual, time.Millisecond * 10)
+			c.So(get.MeanTotalTime, c.ShouldEqual, time.Millisecond * 20)
+			c.So(get.MaxTotalTime, c.ShouldEqual, time.Millisecond * 30)
+			c.So(get.TotalTimePercentiles[0], c.ShouldAlmostEqual, time.Millisecond * 20, time.Millisecond / 10)
+			c.So(post.TotalTimePercentiles[1], c.ShouldAlmostEqual, time.Millisecond * 80, time.Millisecond / 10)
+		})
+
+		c.Convey("An endpoint with nothing recorded has empty figures, and a step counts what was recorded", func(){
+			c.So(endpoints[2].TotalRequests, c.ShouldEqual, 0)
+			c.So(endpoints[2].Harvest, c.ShouldEqual, 0)
+			c.So(endpoints[3].TotalRequests, c.ShouldEqual, 1)
+			c.So(endpoints[3].Harvest, c.ShouldEqual, 100)
+		})
+	})
+}
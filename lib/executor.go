@@ -1,32 +1,50 @@
 package lib
 
 import (
+	"context"
 	"net/http"
 	"time"
 	"fmt"
 	"math/rand"
+	"sync"
 )
 
 type Executor struct {
 	Id string
 	Req http.Request
-	IsExecuting bool
 	Connecting bool
 	Responding bool
-	RequestChan chan bool
-	Done chan bool
+	RequestChan chan ScheduledRequest
 	StatsChan chan ResponseStats
 	RequestOptions RequestOptions
 	Started bool
-	Stopped bool
+
+	//mu guards IsExecuting, which the spawner reads while the executor runs
+	mu sync.Mutex
+	IsExecuting bool
+
+	//quit is closed to make the executor exit once it has finished its current request, and Done is closed when it has
+	quit chan bool
+	quitOnce sync.Once
+	Done chan bool
 
 	Requester *RequestRecorder
 	CustomClient *http.Client
+
+	//Context is given to every request, when it's cancelled the request in flight is cancelled too
+	Context context.Context
+
+	//Sequence is shared by every executor, it numbers each templated request for {{seq}}
+	Sequence *uint64
+
+	//Skipped is called with a request the executor received but didn't issue, so it isn't counted as issued
+	Skipped func(definition *RequestDefinition)
 }
 
-func NewExecutor(id string, requestChan chan bool, statsChan chan ResponseStats, reqOpts RequestOptions) *Executor {
+func NewExecutor(id string, requestChan chan ScheduledRequest, statsChan chan ResponseStats, reqOpts RequestOptions) *Executor {
 	newExecutor :=  &Executor{
-		Done : make (chan bool),
+		quit : make(chan bool),
+		Done : make(chan bool),
 		Id : id,
 		RequestChan : requestChan,
 		StatsChan : statsChan,
@@ -38,41 +56,117 @@ func NewExecutor(id string, requestChan chan bool, statsChan chan ResponseStats,
 
 // Start will cause the executor to pull off the channel instructions to issue requests,
 // It will only attempt to receive off the channel when it's done its request response cycle.
+// It returns once the executor is retired or stopped, or the channel is closed.
 func (e *Executor) Start(){
-	if (e.Stopped) { return }
+	defer close(e.Done)
+	if (e.quitting()) { return }
 
 	e.Started = true
 
 	e.Requester = NewRequestRecorder(e.RequestOptions)
+	e.Requester.Templates = NewTemplateRunner(e.Id, e.Sequence)
+	e.Requester.Context = e.Context
+	e.Requester.Scripts.Context = e.Context
 	if e.HasCustomClient() {
 		e.Requester.Client = e.CustomClient
 	}
+	defer e.Requester.Close()
 
-	for j := range e.RequestChan {
+	for {
+		var scheduled ScheduledRequest
+		select {
+		case <- e.quit:
+			Log("execute", fmt.Sprintln("executor", e.Id, "has left the pool") )
+			return
+		case request, open := <- e.RequestChan:
+			if (!open) { return }
+			scheduled = request
+		}
+		//When a request arrives as the executor is told to quit, either can be picked, quitting takes priority
+		if (e.quitting()) {
+			if (e.Skipped != nil) {
+				e.Skipped(scheduled.Definition)
+			}
+			return
+		}
+
+		definition := scheduled.Definition
+		vars, ok := e.feederVars()
+		if (!ok) {
+			Log("execute", fmt.Sprintln("executor", e.Id, "has no feeder data left, skipping request") )
+			if (e.Skipped != nil) {
+				e.Skipped(definition)
+			}
+			continue
+		}
+
+		e.mu.Lock()
 		e.IsExecuting = true
-		Log("execute", fmt.Sprintln("executor", e.Id, "issuing request", j) )
-		stats, err := e.Requester.PerformRequest()
+		e.mu.Unlock()
+		Log("execute", fmt.Sprintln("executor", e.Id, "issuing request", definition.Method, definition.URL) )
+		var stats ResponseStats
+		var err error
+		if (definition.IsChain()) {
+			stats, err = e.Requester.PerformChain(definition, vars)
+		} else {
+			stats, err = e.Requester.PerformRequest(definition, vars)
+			stats.Label = definition.Label
+		}
+		stats.IntendedTime = scheduled.IntendedTime
 		if (err != nil) {
 			Log( "all", fmt.Sprintln("An error occurred executing request, ", err) )
 		}
 
-		Log("execute", fmt.Sprintln("executor", e.Id, "returning stats", j) )
+		Log("execute", fmt.Sprintln("executor", e.Id, "returning stats", definition.Method, definition.URL) )
+		e.mu.Lock()
 		e.IsExecuting = false
+		e.mu.Unlock()
+
 		e.StatsChan <- stats
-		if (e.Stopped) {
-			e.Done <- true
-		}
 	}
 }
 
-func (e *Executor) Stop() {
-	e.Stopped = true
-	if (e.IsExecuting) {
-		for _ = range e.Done {
-			return
-		}
+func (e *Executor) quitting() bool {
+	select {
+	case <- e.quit:
+		return true
+	default:
+		return false
 	}
-	return
+}
+
+//feederVars starts the vars for a request with the next feeder row, ok is false once the feeder has stopped
+func (e *Executor) feederVars() (vars map[string]string, ok bool) {
+	vars = make(map[string]string)
+	if (e.RequestOptions.Feeder == nil) {
+		return vars, true
+	}
+
+	row, ok := e.RequestOptions.Feeder.Next(e.Id)
+	for column, value := range row {
+		vars[column] = value
+	}
+	return vars, ok
+}
+
+//Retire makes the executor exit once it has finished its current request, or straight away if it's idle
+func (e *Executor) Retire() {
+	e.quitOnce.Do(func() {
+		close(e.quit)
+	})
+}
+
+//Stop retires the executor and waits for it to exit, which waits for the request it's issuing if it's issuing one
+func (e *Executor) Stop() {
+	e.Retire()
+	<- e.Done
+}
+
+//Executing is true while the executor is issuing a request
+func (e *Executor) Executing() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.IsExecuting
 }
 
 func testRequest() ResponseStats {
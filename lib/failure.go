@@ -2,27 +2,56 @@ package lib
 
 import "fmt"
 
+//ThresholdResult is the outcome of checking one of the failure thresholds against the stats
+type ThresholdResult struct {
+	Name string
+	Passed bool
+	Description string
+}
+
 func Failure(stats AggregatedStats, harvest float64, yield float64, throughput float64, percentileLatencies []float64) (failure bool, failureDescription string) {
+	for _, result := range CheckThresholds(stats, harvest, yield, throughput, percentileLatencies) {
+		if (!result.Passed) {
+			return true, result.Description
+		}
+	}
+	return false, ""
+}
+
+//CheckThresholds checks the harvest, yield, throughput and each percentile latency that's been measured, in that order
+func CheckThresholds(stats AggregatedStats, harvest float64, yield float64, throughput float64, percentileLatencies []float64) (results []ThresholdResult) {
+	harvestResult := ThresholdResult{Name : "Harvest", Passed : true, Description : fmt.Sprintf("Harvest of %v meets expected harvest of %v", stats.Harvest, harvest)}
 	if (stats.Harvest < harvest) {
-		return true, fmt.Sprintf("Harvest of %v is below expected harvest of %v",stats.Harvest, harvest)
+		harvestResult.Passed, harvestResult.Description = false, fmt.Sprintf("Harvest of %v is below expected harvest of %v",stats.Harvest, harvest)
 	}
+	results = append(results, harvestResult)
 
+	yieldResult := ThresholdResult{Name : "Yield", Passed : true, Description : fmt.Sprintf("Yield of %v meets expected yield of %v", stats.Yield, yield)}
 	if (stats.Yield < yield) {
-		return true, fmt.Sprintf("Yield of %v is below expected yield of %v", stats.Yield, yield)
+		yieldResult.Passed, yieldResult.Description = false, fmt.Sprintf("Yield of %v is below expected yield of %v", stats.Yield, yield)
 	}
+	results = append(results, yieldResult)
 
+	throughputResult := ThresholdResult{Name : "Throughput", Passed : true, Description : fmt.Sprintf("Throughput of %v resp/s meets expected throughput of %v resp/s", stats.AverageRespThroughput, throughput)}
 	if (stats.AverageRespThroughput < throughput) {
-		return true, fmt.Sprintf("Throughput of %v resp/s is below expected yield of %v resp/s", stats.AverageRespThroughput, throughput)
+		throughputResult.Passed, throughputResult.Description = false, fmt.Sprintf("Throughput of %v resp/s is below expected yield of %v resp/s", stats.AverageRespThroughput, throughput)
 	}
+	results = append(results, throughputResult)
 
 	for index, expectedLatency := range percentileLatencies {
-		if index < len(stats.TotalTimePercentiles) - 1 {
+		if index < len(stats.TotalTimePercentiles) && index < len(stats.Percentiles) {
 			totalTimePercentile := stats.TotalTimePercentiles[index].Seconds()
+			latencyResult := ThresholdResult{
+				Name : fmt.Sprintf("%v percentile latency", stats.Percentiles[index]),
+				Passed : true,
+				Description : fmt.Sprintf("%v percentile latency of %v is within expected latency of %v", stats.Percentiles[index], totalTimePercentile, expectedLatency),
+			}
 			if (totalTimePercentile > expectedLatency) {
-				return true, fmt.Sprintf("%v percentile latency of %v is longer than expected latency of %v", stats.Percentiles[index], totalTimePercentile, expectedLatency )
+				latencyResult.Passed, latencyResult.Description = false, fmt.Sprintf("%v percentile latency of %v is longer than expected latency of %v", stats.Percentiles[index], totalTimePercentile, expectedLatency )
 			}
+			results = append(results, latencyResult)
 		}
 	}
 
-	return false, ""
+	return results
 }
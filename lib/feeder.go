@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	SequentialFeeder = "sequential"
+	RandomFeeder = "random"
+	UniqueFeeder = "unique"
+
+	WrapWhenExhausted = "wrap"
+	StopWhenExhausted = "stop"
+)
+
+//Feeder hands out rows of test data from a CSV or JSONL file, each row's columns become template vars for a request.
+//Sequential hands rows out in order, random picks any row, unique gives each executor its own row to keep.
+//When sequential or unique run out of rows they either wrap around or close Done to stop the test.
+type Feeder struct {
+	Location string
+	Strategy string
+	Exhausted string
+	Rows []map[string]string
+
+	Done chan bool
+
+	mu sync.Mutex
+	next int
+	executorRows map[string]map[string]string
+	doneOnce sync.Once
+}
+
+func ValidFeederStrategy(strategy string) bool {
+	return strategy == SequentialFeeder || strategy == RandomFeeder || strategy == UniqueFeeder
+}
+
+func ValidFeederExhausted(exhausted string) bool {
+	return exhausted == WrapWhenExhausted || exhausted == StopWhenExhausted
+}
+
+//LoadFeeder reads every row of a feeder file, files ending in .csv are read as CSV with a header row, anything else as JSONL
+func LoadFeeder(location string, strategy string, exhausted string) (feeder *Feeder, err error) {
+	if (!ValidFeederStrategy(strategy)) {
+		return nil, errors.New(fmt.Sprintf("Unknown feeder strategy '%v', expected '%v', '%v' or '%v'", strategy, SequentialFeeder, RandomFeeder, UniqueFeeder))
+	}
+	if (!ValidFeederExhausted(exhausted)) {
+		return nil, errors.New(fmt.Sprintf("Unknown feeder exhausted behaviour '%v', expected '%v' or '%v'", exhausted, WrapWhenExhausted, StopWhenExhausted))
+	}
+
+	file, err := os.Open(location)
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not load feeder file at %v err: %v", location, err))
+	}
+	defer file.Close()
+
+	var rows []map[string]string
+	if (strings.ToLower(filepath.Ext(location)) == ".csv") {
+		rows, err = readCSVRows(file)
+	} else {
+		rows, err = readJSONLRows(file)
+	}
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not read feeder file at %v err: %v", location, err))
+	}
+	if (len(rows) == 0) {
+		return nil, errors.New(fmt.Sprintf("No rows were found in feeder file %v", location))
+	}
+
+	return &Feeder{
+		Location : location,
+		Strategy : strategy,
+		Exhausted : exhausted,
+		Rows : rows,
+		Done : make(chan bool),
+		executorRows : make(map[string]map[string]string),
+	}, nil
+}
+
+func readCSVRows(reader io.Reader) (rows []map[string]string, err error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if (err != nil || len(records) == 0) {
+		return rows, err
+	}
+
+	columns := records[0]
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for index, column := range columns {
+			if (index < len(record)) {
+				row[column] = record[index]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readJSONLRows(reader io.Reader) (rows []map[string]string, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") { continue }
+
+		decoder := json.NewDecoder(bytes.NewReader([]byte(line)))
+		decoder.UseNumber()
+		values := make(map[string]interface{})
+		err = decoder.Decode(&values)
+		if (err != nil) {
+			return rows, errors.New(fmt.Sprintf("line %v is not a JSON object, %v", lineNum, err))
+		}
+
+		row := make(map[string]string)
+		for column, value := range values {
+			row[column], err = jsonValueToString(value)
+			if (err != nil) {
+				return rows, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+//CheckExecutors returns an error when a unique feeder that wraps has fewer rows than executors, as wrapping would give the same row to several of them
+func (f *Feeder) CheckExecutors(executors int) error {
+	if (f.Strategy == UniqueFeeder && f.Exhausted == WrapWhenExhausted && executors > len(f.Rows)) {
+		return errors.New(fmt.Sprintf("The unique feeder %v has %v rows but there can be %v executors, each needs its own row. Add rows, lower the concurrency or use -feederexhausted %v",
+			f.Location, len(f.Rows), executors, StopWhenExhausted))
+	}
+	return nil
+}
+
+//Next returns the row an executor should use for its next request, ok is false once the feeder has stopped
+func (f *Feeder) Next(executorId string) (row map[string]string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.Strategy {
+	case RandomFeeder:
+		return f.Rows[rand.Intn(len(f.Rows))], true
+	case UniqueFeeder:
+		if row, ok := f.executorRows[executorId]; ok {
+			return row, true
+		}
+		row, ok = f.nextRow()
+		if (ok) {
+			f.executorRows[executorId] = row
+		}
+		return row, ok
+	default:
+		return f.nextRow()
+	}
+}
+
+func (f *Feeder) nextRow() (row map[string]string, ok bool) {
+	if (f.next >= len(f.Rows)) {
+		if (f.Exhausted == StopWhenExhausted) {
+			f.doneOnce.Do(func() {
+				Log("top", fmt.Sprintf("Feeder %v has run out of rows", f.Location))
+				close(f.Done)
+			})
+			return nil, false
+		}
+		f.next = 0
+	}
+	row = f.Rows[f.next]
+	f.next += 1
+	return row, true
+}
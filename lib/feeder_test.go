@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func TestFeeder(t *testing.T) {
+	c.Convey("With a CSV feeder file", t, func(){
+		location := writeTempFile(t, "users.csv", "userId,password\n1,a\n2,b\n")
+		defer os.RemoveAll(filepath.Dir(location))
+
+		c.Convey("Sequential rows wrap around by default", func(){
+			feeder, err := LoadFeeder(location, SequentialFeeder, WrapWhenExhausted)
+			c.So(err, c.ShouldBeNil)
+			ids := []string{}
+			for i := 0; i < 3; i++ {
+				row, ok := feeder.Next("0")
+				c.So(ok, c.ShouldBeTrue)
+				ids = append(ids, row["userId"])
+			}
+			c.So(ids, c.ShouldResemble, []string{"1", "2", "1"})
+		})
+
+		c.Convey("Sequential rows can stop the test when they run out", func(){
+			feeder, err := LoadFeeder(location, SequentialFeeder, StopWhenExhausted)
+			c.So(err, c.ShouldBeNil)
+			feeder.Next("0")
+			feeder.Next("1")
+			_, ok := feeder.Next("0")
+			c.So(ok, c.ShouldBeFalse)
+			_, open := <-feeder.Done
+			c.So(open, c.ShouldBeFalse)
+		})
+
+		c.Convey("Unique rows stay with the executor that claimed them", func(){
+			feeder, err := LoadFeeder(location, UniqueFeeder, StopWhenExhausted)
+			c.So(err, c.ShouldBeNil)
+			first, _ := feeder.Next("0")
+			second, _ := feeder.Next("1")
+			again, _ := feeder.Next("0")
+			c.So(first["password"], c.ShouldEqual, "a")
+			c.So(second["password"], c.ShouldEqual, "b")
+			c.So(again["password"], c.ShouldEqual, "a")
+			_, ok := feeder.Next("2")
+			c.So(ok, c.ShouldBeFalse)
+		})
+
+		c.Convey("A run with more requests to issue than rows ends when the rows run out rather than at the time limit", func(){
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			defer server.Close()
+
+			started := time.Now()
+			result, err := Run(context.Background(), Plan{RequestOptions : RequestOptions{URL : server.URL + "/{{.userId}}", RequestsToIssue : 10, MaxExecutionSecs : 30,
+				FeederFile : location, FeederExhausted : StopWhenExhausted}})
+			c.So(err, c.ShouldBeNil)
+			c.So(time.Since(started), c.ShouldBeLessThan, time.Second * 5)
+			c.So(result.Stats.TotalRequests, c.ShouldEqual, 2)
+		})
+
+		c.Convey("A unique feeder that wraps needs a row for every executor", func(){
+			_, err := PrepareRequestOptions(RequestOptions{URL : "http://localhost", FeederFile : location, FeederStrategy : UniqueFeeder, Concurrency : 2})
+			c.So(err, c.ShouldBeNil)
+			_, err = PrepareRequestOptions(RequestOptions{URL : "http://localhost", FeederFile : location, FeederStrategy : UniqueFeeder, Concurrency : 3})
+			c.So(err, c.ShouldNotBeNil)
+			_, err = PrepareRequestOptions(RequestOptions{URL : "http://localhost", FeederFile : location, FeederStrategy : UniqueFeeder, Concurrency : 3, FeederExhausted : StopWhenExhausted})
+			c.So(err, c.ShouldBeNil)
+		})
+
+		c.Convey("A request skipped once rows have run out isn't counted as issued", func(){
+			feeder, err := LoadFeeder(location, SequentialFeeder, StopWhenExhausted)
+			c.So(err, c.ShouldBeNil)
+			feeder.Next("0")
+			feeder.Next("0")
+
+			reqOpts := RequestOptions{Feeder : feeder, Requests : []RequestDefinition{{Label : "login", URL : "http://localhost"}}}
+			spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+			requestChan := make(chan ScheduledRequest, 1)
+			requestChan <- ScheduledRequest{Definition : spawner.Selector.Next()}
+			spawner.recordIssued(false, time.Now())
+			close(requestChan)
+
+			executor := NewExecutor("0", requestChan, spawner.StatsChan, reqOpts)
+			executor.Skipped = spawner.unissue
+			executor.Start()
+
+			issued, _ := spawner.IssuedAndDropped()
+			c.So(issued, c.ShouldEqual, 0)
+			c.So(spawner.Selector.Issued()["login"], c.ShouldEqual, 0)
+		})
+	})
+
+	c.Convey("With a JSONL feeder file", t, func(){
+		location := writeTempFile(t, "items.jsonl", `{"id": 12, "name": "thing", "tags": ["a"]}` + "\n")
+		defer os.RemoveAll(filepath.Dir(location))
+
+		c.Convey("Each value becomes a string var", func(){
+			feeder, err := LoadFeeder(location, RandomFeeder, WrapWhenExhausted)
+			c.So(err, c.ShouldBeNil)
+			row, ok := feeder.Next("0")
+			c.So(ok, c.ShouldBeTrue)
+			c.So(row, c.ShouldResemble, map[string]string{"id": "12", "name": "thing", "tags": `["a"]`})
+		})
+	})
+}
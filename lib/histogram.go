@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+//Values are kept to histogramSignificantDigits significant digits, anything above histogramHighestValue is counted as histogramHighestValue
+const histogramSignificantDigits = 2
+const histogramHighestValue = int64(time.Hour)
+
+//maxHistogramValues caps the number of values LatencyHistogram.Values returns for drawing histograms
+const maxHistogramValues = 2000
+
+//LatencyHistogram is an HDR histogram of durations in nanoseconds.
+//Values are counted in buckets whose width doubles with the magnitude of the value, so every value is kept to the same number of
+//significant digits and the histogram takes the same memory however many values are recorded. The count, sum, min and max are exact.
+type LatencyHistogram struct {
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount int64
+	subBucketMask int64
+	counts []int64
+
+	Count int64
+	Sum int64
+	Min int64
+	Max int64
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(histogramSignificantDigits)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	bucketCount := 1
+	for smallestUntrackableValue := subBucketCount; smallestUntrackableValue <= histogramHighestValue; smallestUntrackableValue <<= 1 {
+		bucketCount += 1
+	}
+
+	return &LatencyHistogram{
+		subBucketHalfCountMagnitude : subBucketCountMagnitude - 1,
+		subBucketHalfCount : subBucketCount / 2,
+		subBucketMask : subBucketCount - 1,
+		counts : make([]int64, (bucketCount + 1) * int(subBucketCount / 2)),
+	}
+}
+
+func (h *LatencyHistogram) Record(duration time.Duration) {
+	value := int64(duration)
+	if (value < 0) {
+		value = 0
+	}
+
+	if (h.Count == 0 || value < h.Min) {
+		h.Min = value
+	}
+	if (value > h.Max) {
+		h.Max = value
+	}
+	h.Count += 1
+	h.Sum += value
+
+	if (value > histogramHighestValue) {
+		value = histogramHighestValue
+	}
+	h.counts[h.countsIndex(value)] += 1
+}
+
+//Merge adds the values recorded by other to h
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	if (other.Count == 0) {
+		return
+	}
+	if (h.Count == 0 || other.Min < h.Min) {
+		h.Min = other.Min
+	}
+	if (other.Max > h.Max) {
+		h.Max = other.Max
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	for index, count := range other.counts {
+		h.counts[index] += count
+	}
+}
+
+func (h *LatencyHistogram) Mean() time.Duration {
+	if (h.Count == 0) {
+		return 0
+	}
+	return time.Duration(h.Sum / h.Count)
+}
+
+//ValueAtQuantile returns the value below which the quantile (0 to 1) of recorded values fall
+func (h *LatencyHistogram) ValueAtQuantile(quantile float64) time.Duration {
+	if (h.Count == 0) {
+		return 0
+	}
+
+	target := int64(math.Ceil(quantile * float64(h.Count)))
+	if (target < 1) {
+		target = 1
+	}
+
+	cumulative := int64(0)
+	for index, count := range h.counts {
+		cumulative += count
+		if (cumulative >= target) {
+			return h.clamp(h.highestEquivalentValue(index))
+		}
+	}
+	return time.Duration(h.Max)
+}
+
+//Percentiles returns the value at each quantile, or nil when nothing has been recorded
+func (h *LatencyHistogram) Percentiles(percentiles []float64) []time.Duration {
+	if (h.Count == 0) {
+		return nil
+	}
+	durations := make([]time.Duration, len(percentiles))
+	for index, percentile := range percentiles {
+		durations[index] = h.ValueAtQuantile(percentile)
+	}
+	return durations
+}
+
+//Values returns up to maxValues nanosecond values spread evenly through the recorded distribution, for drawing histograms
+func (h *LatencyHistogram) Values(maxValues int) (values []float64) {
+	numValues := int64(maxValues)
+	if (h.Count < numValues) {
+		numValues = h.Count
+	}
+
+	index := 0
+	cumulative := h.counts[0]
+	for valueIndex := int64(0); valueIndex < numValues; valueIndex++ {
+		target := (valueIndex + 1) * h.Count / numValues
+		for (cumulative < target && index < len(h.counts) - 1) {
+			index += 1
+			cumulative += h.counts[index]
+		}
+		values = append(values, float64(h.clamp(h.highestEquivalentValue(index))))
+	}
+	return values
+}
+
+//CumulativeCounts returns the number of recorded values at or below each of the ascending bounds, to the histogram's precision
+func (h *LatencyHistogram) CumulativeCounts(bounds []time.Duration) []int64 {
+	cumulativeCounts := make([]int64, len(bounds))
+	boundIndex := 0
+	cumulative := int64(0)
+	for index, count := range h.counts {
+		for (boundIndex < len(bounds) && h.highestEquivalentValue(index) > int64(bounds[boundIndex])) {
+			cumulativeCounts[boundIndex] = cumulative
+			boundIndex += 1
+		}
+		if (boundIndex == len(bounds)) {
+			return cumulativeCounts
+		}
+		cumulative += count
+	}
+	for ; boundIndex < len(bounds); boundIndex++ {
+		cumulativeCounts[boundIndex] = cumulative
+	}
+	return cumulativeCounts
+}
+
+func (h *LatencyHistogram) countsIndex(value int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(value | h.subBucketMask))
+	bucketIndex := int64(pow2Ceiling) - int64(h.subBucketHalfCountMagnitude + 1)
+	subBucketIndex := value >> uint(bucketIndex)
+	return int(((bucketIndex + 1) << h.subBucketHalfCountMagnitude) + (subBucketIndex - h.subBucketHalfCount))
+}
+
+//highestEquivalentValue is the largest value that would be counted at the index
+func (h *LatencyHistogram) highestEquivalentValue(index int) int64 {
+	bucketIndex := int64(index >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := int64(index) & (h.subBucketHalfCount - 1) + h.subBucketHalfCount
+	if (bucketIndex < 0) {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return (subBucketIndex << uint(bucketIndex)) + (int64(1) << uint(bucketIndex)) - 1
+}
+
+//clamp keeps a value read from the buckets within the exact min and max
+func (h *LatencyHistogram) clamp(value int64) time.Duration {
+	if (value > h.Max) {
+		value = h.Max
+	}
+	if (value < h.Min) {
+		value = h.Min
+	}
+	return time.Duration(value)
+}
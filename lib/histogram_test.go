@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	c.Convey("With a histogram of 1ms to 10s", t, func(){
+		histogram := NewLatencyHistogram()
+		for value := 1; value <= 10000; value++ {
+			histogram.Record(time.Duration(value) * time.Millisecond)
+		}
+
+		c.Convey("Percentiles are within the significant digits kept", func(){
+			percentiles := histogram.Percentiles([]float64{0.5, 0.99})
+			c.So(float64(percentiles[0]), c.ShouldAlmostEqual, float64(time.Second * 5), float64(time.Second * 5) / 100)
+			c.So(float64(percentiles[1]), c.ShouldAlmostEqual, float64(time.Millisecond * 9900), float64(time.Millisecond * 9900) / 100)
+		})
+
+		c.Convey("Count, min, max and mean are exact", func(){
+			c.So(histogram.Count, c.ShouldEqual, 10000)
+			c.So(histogram.Min, c.ShouldEqual, int64(time.Millisecond))
+			c.So(histogram.Max, c.ShouldEqual, int64(time.Second * 10))
+			c.So(histogram.Mean(), c.ShouldEqual, time.Microsecond * 5000500)
+		})
+
+		c.Convey("Merging adds the counts of another histogram", func(){
+			other := NewLatencyHistogram()
+			other.Record(time.Minute)
+			histogram.Merge(other)
+			c.So(histogram.Count, c.ShouldEqual, 10001)
+			c.So(histogram.ValueAtQuantile(1), c.ShouldEqual, time.Minute)
+		})
+
+		c.Convey("Values are capped and spread through the distribution", func(){
+			values := histogram.Values(100)
+			c.So(len(values), c.ShouldEqual, 100)
+			c.So(values[49], c.ShouldAlmostEqual, float64(time.Second * 5), float64(time.Second * 5) / 100)
+			c.So(values[99], c.ShouldEqual, float64(time.Second * 10))
+		})
+	})
+
+	c.Convey("Values beyond an hour are counted as an hour but the max is kept", t, func(){
+		histogram := NewLatencyHistogram()
+		histogram.Record(time.Hour * 2)
+		c.So(histogram.Max, c.ShouldEqual, int64(time.Hour * 2))
+		c.So(histogram.Percentiles([]float64{0.5})[0], c.ShouldEqual, time.Hour * 2)
+	})
+}
@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//DefaultStaticDir holds the report template and the assets inlined into it, relative to where deathstar is run like the default schema
+const DefaultStaticDir = "./lib/static"
+
+//reportStylesheets are inlined into the static report in this order
+var reportStylesheets = []string{"assets/lib/bootstrap/dist/css/bootstrap.min.css", "assets/css/keen-dashboards.css"}
+
+//HTMLReportData is everything the static report template shows, charts are drawn ahead of time as SVG so the file works offline
+type HTMLReportData struct {
+	RenderData
+
+	Generated string
+	Stylesheet template.CSS
+	Logo template.URL
+
+	Passed bool
+	Verdict string
+	Options ReportOptions
+	Thresholds []ThresholdResult
+	Failures []HTMLReportFailure
+
+	LatencyChart template.HTML
+	PhaseChart template.HTML
+	ThroughputChart template.HTML
+	KbChart template.HTML
+	RateChart template.HTML
+	TimelineLatencyChart template.HTML
+	ErrorsChart template.HTML
+}
+
+type HTMLReportFailure struct {
+	Category string
+	Description string
+	Count int
+}
+
+//WriteHTMLReport writes a single html file of the final stats to path, with its stylesheets and images inlined from staticDir
+func WriteHTMLReport(path string, staticDir string, stats AggregatedStats, reqOpts RequestOptions) error {
+	renderer := &RenderHTML{
+		Data : RenderData{
+			ReqOpts : reqOpts,
+		},
+	}
+	renderer.Generate(stats)
+	return renderer.RenderReport(path, staticDir)
+}
+
+//RenderReport executes template.html in staticDir with the latest generated data and writes it to path
+func (r *RenderHTML) RenderReport(path string, staticDir string) error {
+	templateBytes, err := ioutil.ReadFile(filepath.Join(staticDir, "template.html"))
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not read the HTML report template, err: %v", err))
+	}
+	htmlTempl, err := template.New("report").Parse(string(templateBytes))
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not parse the HTML report template, err: %v", err))
+	}
+
+	data, err := r.GenerateReport(staticDir)
+	if (err != nil) {
+		return err
+	}
+
+	buf := bytes.NewBufferString("")
+	err = htmlTempl.Execute(buf, data)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not render the HTML report, err: %v", err))
+	}
+
+	err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not write the HTML report to %v, err: %v", path, err))
+	}
+	return nil
+}
+
+//GenerateReport adds the inlined assets, verdict, tables and charts to the latest generated data
+func (r *RenderHTML) GenerateReport(staticDir string) (data HTMLReportData, err error) {
+	stats := r.Data.Latest
+	data = HTMLReportData{
+		RenderData : r.Data,
+		Generated : time.Now().Format(time.RFC1123),
+		Options : NewReportOptions(r.Data.ReqOpts),
+		Verdict : (&RenderPlain{ReqOpts : r.Data.ReqOpts}).Summary(stats),
+		Thresholds : CheckThresholds(stats, r.Data.ReqOpts.Harvest, r.Data.ReqOpts.Yield, r.Data.ReqOpts.Throughput, r.Data.ReqOpts.PercentileLatencies),
+	}
+
+	stylesheet := ""
+	for _, sheet := range reportStylesheets {
+		sheetBytes, err := ioutil.ReadFile(filepath.Join(staticDir, sheet))
+		if (err != nil) {
+			return data, errors.New(fmt.Sprintf("Could not read %v to inline in the HTML report, err: %v", sheet, err))
+		}
+		stylesheet += string(sheetBytes) + "\n"
+	}
+	data.Stylesheet = template.CSS(stylesheet)
+
+	logoBytes, err := ioutil.ReadFile(filepath.Join(staticDir, "assets/img/death_star-128.png"))
+	if (err != nil) {
+		return data, errors.New(fmt.Sprintf("Could not read the logo to inline in the HTML report, err: %v", err))
+	}
+	data.Logo = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(logoBytes))
+
+	data.Passed = stats.TotalRequests > 0 && !stats.OverallFailure
+	if (len(stats.SearchLevels) > 0) {
+		data.Passed = false
+		for _, level := range stats.SearchLevels {
+			data.Passed = data.Passed || level.Passed
+		}
+	}
+
+	for _, failureCount := range stats.FailureCounts {
+		data.Failures = append(data.Failures, HTMLReportFailure{
+			Category : failureCount.Example.Category(),
+			Description : failureCount.Example.Description(),
+			Count : failureCount.Count,
+		})
+	}
+	sort.Slice(data.Failures, func(i, j int) bool {
+		if (data.Failures[i].Count != data.Failures[j].Count) {
+			return data.Failures[i].Count > data.Failures[j].Count
+		}
+		return data.Failures[i].Description < data.Failures[j].Description
+	})
+
+	r.generateReportCharts(&data)
+	return data, nil
+}
+
+func (r *RenderHTML) generateReportCharts(data *HTMLReportData) {
+	data.LatencyChart = LineChart{
+		XTitle : "percentile",
+		YTitle : "seconds",
+		XLabels : r.Data.PercentileTitles,
+		Series : []ChartSeries{
+			{Name : "Total", Values : r.Data.LatestTotalPercentiles},
+			{Name : "Connect", Values : r.Data.LatestConnectPercentiles},
+			{Name : "Time to respond", Values : r.Data.LatestResponsePercentiles},
+			{Name : "Response", Values : r.Data.LatestResponseTimePercentiles},
+		},
+	}.SVG()
+
+	phases := LineChart{XTitle : "percentile", YTitle : "seconds", XLabels : r.Data.PercentileTitles}
+	for _, phase := range r.Data.Phases {
+		phases.Series = append(phases.Series, ChartSeries{Name : phase.Name, Values : phase.Percentiles})
+	}
+	data.PhaseChart = phases.SVG()
+
+	timeline := r.Data.Timeline
+	data.ThroughputChart = LineChart{
+		XTitle : "seconds",
+		YTitle : "per second",
+		XStep : timeline.Sampling,
+		Series : []ChartSeries{
+			{Name : "Requests sent", Values : timeline.RequestsSent},
+			{Name : "Responses", Values : timeline.Responses},
+			{Name : "Errors", Values : timeline.Errors},
+		},
+	}.SVG()
+	data.KbChart = LineChart{
+		XTitle : "seconds",
+		YTitle : "kb/s",
+		XStep : timeline.Sampling,
+		Series : []ChartSeries{{Name : "Response kb/s", Values : timeline.KbPerSecond}},
+	}.SVG()
+
+	latencies := LineChart{XTitle : "seconds", YTitle : "seconds", XStep : timeline.Sampling}
+	for index, percentileTimes := range timeline.Percentiles {
+		if (index < len(r.Data.PercentileTitles)) {
+			latencies.Series = append(latencies.Series, ChartSeries{Name : r.Data.PercentileTitles[index], Values : percentileTimes})
+		}
+	}
+	data.TimelineLatencyChart = latencies.SVG()
+
+	errorCategories := LineChart{XTitle : "seconds", YTitle : "errors per second", XStep : timeline.Sampling}
+	for index, category := range timeline.ErrorCategories {
+		errorCategories.Series = append(errorCategories.Series, ChartSeries{Name : category, Values : timeline.ErrorsByCategory[index]})
+	}
+	data.ErrorsChart = errorCategories.SVG()
+
+	if (len(r.Data.SampledTargetRates) > 0) {
+		data.RateChart = LineChart{
+			XTitle : "seconds",
+			YTitle : "req/s",
+			XStep : r.Data.RateSampling,
+			Series : []ChartSeries{
+				{Name : "Target", Values : r.Data.SampledTargetRates},
+				{Name : "Achieved", Values : r.Data.SampledAchievedRates},
+			},
+		}.SVG()
+	}
+}
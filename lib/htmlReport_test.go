@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func TestHTMLReport(t *testing.T) {
+	c.Convey("With the final stats of a test that had status code failures", t, func(){
+		badStatus := *NewStatusCodeError(503)
+		stats := AggregatedStats{
+			StartTime : time.Now().Add(-time.Second * 3),
+			TimeElapsed : time.Second * 3,
+			TotalTestDuration : time.Second * 3,
+			Percentiles : []float64{0.5, 0.99},
+			TotalTimePercentiles : []time.Duration{time.Millisecond * 10, time.Millisecond * 40},
+			TimeToConnectPercentiles : []time.Duration{time.Millisecond, time.Millisecond * 2},
+			TimeToRespondPercentiles : []time.Duration{time.Millisecond * 8, time.Millisecond * 30},
+			TotalRequests : 30,
+			TotalResponses : 30,
+			TotalValidResponses : 28,
+			Harvest : 100,
+			Yield : 93.3,
+			AverageRespThroughput : 10,
+			FailureCounts : map[string]FailureCount{failureKey(badStatus) : {Count : 2, Example : badStatus}},
+		}
+		for second := 0; second < 3; second++ {
+			stats.Buckets = append(stats.Buckets, MetricsBucket{
+				RequestsSent : 10,
+				Responses : 10,
+				Errors : second % 2,
+				ErrorsByCategory : map[string]int{"StatusCode" : second % 2},
+				ResponseBytes : 2048,
+				Percentiles : []time.Duration{time.Millisecond * 10, time.Millisecond * 40},
+			})
+		}
+		reqOpts := DefaultRequestOptions
+		reqOpts.URL = "http://localhost:8080/users?name=<script>"
+
+		dir, err := ioutil.TempDir("", "htmlreport")
+		c.So(err, c.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "report.html")
+
+		c.Convey("A single html file is written with the charts and failures", func(){
+			c.So(WriteHTMLReport(path, "./static", stats, reqOpts), c.ShouldBeNil)
+			output, err := ioutil.ReadFile(path)
+			c.So(err, c.ShouldBeNil)
+			report := string(output)
+
+			c.So(report, c.ShouldContainSubstring, "PASSED: harvest 100.00%")
+			c.So(strings.Count(report, "<svg"), c.ShouldEqual, 5)
+			c.So(report, c.ShouldContainSubstring, "<td>StatusCode</td>")
+			c.So(report, c.ShouldContainSubstring, badStatus.Description())
+			c.So(report, c.ShouldContainSubstring, "data:image/png;base64,")
+
+			c.Convey("Which loads nothing from elsewhere", func(){
+				c.So(report, c.ShouldNotContainSubstring, "<script")
+				c.So(report, c.ShouldNotContainSubstring, "<link rel=\"stylesheet\"")
+				c.So(report, c.ShouldNotContainSubstring, "src=\"http")
+				c.So(report, c.ShouldNotContainSubstring, "keen.io")
+				c.So(report, c.ShouldNotContainSubstring, "name=<script>")
+			})
+		})
+
+		c.Convey("A missing template is an error", func(){
+			c.So(WriteHTMLReport(path, dir, stats, reqOpts), c.ShouldNotBeNil)
+		})
+	})
+
+	c.Convey("Chart axes are rounded up to 1, 2 or 5 times a power of ten", t, func(){
+		c.So(niceCeiling(0), c.ShouldEqual, 1)
+		c.So(niceCeiling(0.0032), c.ShouldAlmostEqual, 0.005)
+		c.So(niceCeiling(17), c.ShouldEqual, 20)
+		c.So(niceCeiling(100), c.ShouldEqual, 100)
+		c.So(niceCeiling(501), c.ShouldEqual, 1000)
+	})
+
+	c.Convey("A chart without values says so rather than drawing empty axes", t, func(){
+		chart := LineChart{Series : []ChartSeries{{Name : "Empty"}}}
+		c.So(string(chart.SVG()), c.ShouldNotContainSubstring, "<svg")
+	})
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//LookupJSONPath finds the value at a simple JSON path such as "$.data.items[0].id" or "data.items.0.id"
+func LookupJSONPath(document interface{}, path string) (value interface{}, err error) {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+
+	value = document
+	for _, key := range strings.Split(path, ".") {
+		if (key == "") { continue }
+
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if (!ok) {
+				return nil, errors.New(fmt.Sprintf("No value found for '%v' in path %v", key, path))
+			}
+			value = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if (err != nil || index < 0 || index >= len(node)) {
+				return nil, errors.New(fmt.Sprintf("No index '%v' found in path %v", key, path))
+			}
+			value = node[index]
+		default:
+			return nil, errors.New(fmt.Sprintf("Cannot look up '%v' in path %v, the value is not an object or array", key, path))
+		}
+	}
+	return value, nil
+}
+
+//ExtractJSONPath parses a JSON payload and returns the value at path as a string,
+//strings are returned as is and any other value is returned as JSON
+func ExtractJSONPath(payload string, path string) (extracted string, err error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+	decoder.UseNumber()
+	var document interface{}
+	err = decoder.Decode(&document)
+	if (err != nil) {
+		return "", errors.New(fmt.Sprintf("The response is not valid JSON, %v", err))
+	}
+
+	value, err := LookupJSONPath(document, path)
+	if (err != nil) {
+		return "", err
+	}
+
+	return jsonValueToString(value)
+}
+
+//jsonValueToString returns strings as is and any other decoded JSON value as JSON
+func jsonValueToString(value interface{}) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	valueBytes, err := json.Marshal(value)
+	return string(valueBytes), err
+}
@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+//failureCategories are the categories of DescriptiveError, each is a test case in the JUnit report whether or not it occurred
+var failureCategories = []string{"RequestExecutionError", "StatusCode", "Validation", "Header", JSONPathAssertionCategory, BodyRegexAssertionCategory,
+	BodySizeAssertionCategory, ContentTypeAssertionCategory, LatencyAssertionCategory, "Extraction", "Script"}
+
+//JUnitTestSuites is the JUnit XML document written by -junit, so thresholds and validation show up alongside other test results in CI
+type JUnitTestSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Suites []JUnitTestSuite `xml:"testsuite"`
+}
+
+type JUnitTestSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Time string `xml:"time,attr"`
+	Timestamp string `xml:"timestamp,attr,omitempty"`
+	Properties []JUnitProperty `xml:"properties>property,omitempty"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+type JUnitProperty struct {
+	Name string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type JUnitTestCase struct {
+	Name string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	Time string `xml:"time,attr"`
+	Failure *JUnitFailure `xml:"failure,omitempty"`
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+//NewJUnitReport has a suite with a test case for each threshold checked by Failure, a suite with a test case for each failure category,
+//and for a capacity search a suite with a test case for each level
+func NewJUnitReport(stats AggregatedStats, reqOpts RequestOptions) JUnitTestSuites {
+	elapsed := fmt.Sprintf("%.3f", stats.TimeElapsed.Seconds())
+	timestamp := ""
+	if (!stats.StartTime.IsZero()) {
+		timestamp = stats.StartTime.Format(time.RFC3339)
+	}
+
+	thresholds := JUnitTestSuite{
+		Name : "deathstar.thresholds",
+		Time : elapsed,
+		Timestamp : timestamp,
+		Properties : []JUnitProperty{
+			{Name : "mode", Value : reqOpts.Mode},
+			{Name : "requests", Value : fmt.Sprintf("%v", stats.TotalRequests)},
+			{Name : "responses", Value : fmt.Sprintf("%v", stats.TotalResponses)},
+			{Name : "wrongStatusResponses", Value : fmt.Sprintf("%v", stats.WrongStatusResponses)},
+			{Name : "rate", Value : fmt.Sprintf("%.2f", stats.Rate)},
+		},
+	}
+	for _, result := range CheckThresholds(stats, reqOpts.Harvest, reqOpts.Yield, reqOpts.Throughput, reqOpts.PercentileLatencies) {
+		testCase := JUnitTestCase{
+			Name : result.Name,
+			ClassName : thresholds.Name,
+			Time : elapsed,
+		}
+		if (result.Passed) {
+			testCase.SystemOut = result.Description
+		} else {
+			testCase.Failure = &JUnitFailure{
+				Message : result.Description,
+				Type : "Threshold",
+			}
+		}
+		thresholds.addTestCase(testCase)
+	}
+
+	validation := JUnitTestSuite{
+		Name : "deathstar.validation",
+		Time : elapsed,
+		Timestamp : timestamp,
+	}
+	for _, category := range failureCategories {
+		descriptions := []string{}
+		count := 0
+		for _, failureCount := range stats.FailureCounts {
+			if (failureCount.Example.Category() == category) {
+				descriptions = append(descriptions, fmt.Sprintf("%v x %v", failureCount.Count, failureCount.Example.Description()))
+				count += failureCount.Count
+			}
+		}
+		sort.Strings(descriptions)
+
+		testCase := JUnitTestCase{
+			Name : category,
+			ClassName : validation.Name,
+			Time : elapsed,
+		}
+		if (count > 0) {
+			testCase.Failure = &JUnitFailure{
+				Message : fmt.Sprintf("%v %v failures out of %v requests", count, category, stats.TotalRequests),
+				Type : category,
+			}
+			for _, description := range descriptions {
+				testCase.Failure.Contents += description + "\n"
+			}
+		}
+		validation.addTestCase(testCase)
+	}
+
+	report := JUnitTestSuites{Suites : []JUnitTestSuite{thresholds, validation}}
+
+	if (len(stats.SearchLevels) > 0) {
+		search := JUnitTestSuite{
+			Name : "deathstar.search",
+			Time : elapsed,
+			Timestamp : timestamp,
+			Properties : []JUnitProperty{{Name : "summary", Value : stats.SearchSummary}},
+		}
+		for _, level := range stats.SearchLevels {
+			testCase := JUnitTestCase{
+				Name : fmt.Sprintf("%.2f req/s", level.Rate),
+				ClassName : search.Name,
+				Time : fmt.Sprintf("%.3f", level.Stats.TimeElapsed.Seconds()),
+			}
+			if (!level.Passed) {
+				testCase.Failure = &JUnitFailure{
+					Message : level.FailureDescription,
+					Type : "Threshold",
+				}
+			}
+			search.addTestCase(testCase)
+		}
+		report.Suites = append(report.Suites, search)
+	}
+
+	return report
+}
+
+func (s *JUnitTestSuite) addTestCase(testCase JUnitTestCase) {
+	s.TestCases = append(s.TestCases, testCase)
+	s.Tests += 1
+	if (testCase.Failure != nil) {
+		s.Failures += 1
+	}
+}
+
+//WriteJUnitReport writes the report as JUnit XML to path
+func WriteJUnitReport(path string, report JUnitTestSuites) error {
+	output, err := xml.MarshalIndent(report, "", "  ")
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not encode the JUnit report, err: %v", err))
+	}
+	output = append([]byte(xml.Header), append(output, '\n')...)
+	err = ioutil.WriteFile(path, output, 0644)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not write the JUnit report to %v, err: %v", path, err))
+	}
+	return nil
+}
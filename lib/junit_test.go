@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	c.Convey("With stats that miss the 99th percentile latency and have status code failures", t, func(){
+		badStatus := *NewStatusCodeError(500)
+		stats := AggregatedStats{
+			Percentiles : []float64{0.5, 0.99},
+			TotalTimePercentiles : []time.Duration{time.Millisecond * 10, time.Second * 2},
+			TotalRequests : 100,
+			TotalResponses : 100,
+			TotalValidResponses : 97,
+			WrongStatusResponses : 3,
+			Harvest : 100,
+			Yield : 97,
+			AverageRespThroughput : 50,
+			FailureCounts : map[string]FailureCount{failureKey(badStatus) : {Count : 3, Example : badStatus}},
+		}
+		reqOpts := DefaultRequestOptions
+		reqOpts.Harvest, reqOpts.Yield, reqOpts.Throughput = 85, 85, 5
+		reqOpts.PercentileLatencies = []float64{0.1, 1}
+
+		report := NewJUnitReport(stats, reqOpts)
+
+		c.Convey("Every threshold is a test case, including the last percentile", func(){
+			thresholds := report.Suites[0]
+			c.So(thresholds.Tests, c.ShouldEqual, 5)
+			c.So(thresholds.Failures, c.ShouldEqual, 1)
+			c.So(thresholds.TestCases[4].Name, c.ShouldEqual, "0.99 percentile latency")
+			c.So(thresholds.TestCases[4].Failure.Message, c.ShouldContainSubstring, "longer than expected latency of 1")
+			c.So(thresholds.Properties[3], c.ShouldResemble, JUnitProperty{Name : "wrongStatusResponses", Value : "3"})
+		})
+
+		c.Convey("Every failure category is a test case, failing with its count", func(){
+			validation := report.Suites[1]
+			c.So(validation.Tests, c.ShouldEqual, len(failureCategories))
+			c.So(validation.Failures, c.ShouldEqual, 1)
+			for _, testCase := range validation.TestCases {
+				if (testCase.Name == badStatus.Category()) {
+					c.So(testCase.Failure.Message, c.ShouldEqual, "3 StatusCode failures out of 100 requests")
+					c.So(testCase.Failure.Contents, c.ShouldContainSubstring, "3 x " + badStatus.Description())
+				}
+			}
+		})
+
+		c.Convey("The report is written as JUnit XML", func(){
+			dir, err := ioutil.TempDir("", "junit")
+			c.So(err, c.ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "results.xml")
+
+			c.So(WriteJUnitReport(path, report), c.ShouldBeNil)
+
+			output, err := ioutil.ReadFile(path)
+			c.So(err, c.ShouldBeNil)
+			read := JUnitTestSuites{}
+			c.So(xml.Unmarshal(output, &read), c.ShouldBeNil)
+			c.So(len(read.Suites), c.ShouldEqual, 2)
+			c.So(read.Suites[0].Name, c.ShouldEqual, "deathstar.thresholds")
+			c.So(read.Suites[1].Failures, c.ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RampStage = "ramp"
+	StepStage = "step"
+	SpikeStage = "spike"
+	HoldStage = "hold"
+	SoakStage = "soak"
+
+	RateTarget = "rps"
+	ConcurrencyTarget = "conc"
+)
+
+//ProfileStage moves the rate or concurrency towards Target over Duration.
+//A ramp changes linearly, a step jumps straight to the target, a spike jumps to the target and back again afterwards,
+//and a hold or soak keeps things as they are.
+type ProfileStage struct {
+	Kind string
+	Target float64
+	TargetType string
+	Duration time.Duration
+}
+
+//LoadProfile is a series of stages the spawner follows over the course of a test,
+//rate starts at 0 and concurrency starts at the -conc pool size.
+type LoadProfile struct {
+	Stages []ProfileStage
+	StartRate float64
+	StartConcurrency int
+}
+
+//ParseLoadProfile reads a profile such as "ramp 200rps 2m, hold 10m, spike 800rps 30s, ramp 0rps 1m".
+//Targets ending in rps are rates and targets ending in conc are executor counts, a bare number is a rate.
+func ParseLoadProfile(profile string, startConcurrency int) (*LoadProfile, error) {
+	loadProfile := &LoadProfile{
+		StartConcurrency : startConcurrency,
+	}
+
+	for _, rawStage := range strings.Split(profile, ",") {
+		fields := strings.Fields(rawStage)
+		if (len(fields) == 0) { continue }
+
+		stage := ProfileStage{Kind : strings.ToLower(fields[0])}
+		var rawDuration string
+		switch stage.Kind {
+		case HoldStage, SoakStage:
+			if (len(fields) != 2) {
+				return nil, errors.New(fmt.Sprintf("The profile stage '%v' should be in the form '%v <duration>'", strings.TrimSpace(rawStage), stage.Kind))
+			}
+			rawDuration = fields[1]
+		case RampStage, StepStage, SpikeStage:
+			if (len(fields) != 3) {
+				return nil, errors.New(fmt.Sprintf("The profile stage '%v' should be in the form '%v <target> <duration>'", strings.TrimSpace(rawStage), stage.Kind))
+			}
+			target, targetType, err := parseProfileTarget(fields[1])
+			if (err != nil) {
+				return nil, err
+			}
+			stage.Target = target
+			stage.TargetType = targetType
+			rawDuration = fields[2]
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown profile stage '%v', expected '%v', '%v', '%v', '%v' or '%v'", fields[0], RampStage, StepStage, SpikeStage, HoldStage, SoakStage))
+		}
+
+		duration, err := time.ParseDuration(rawDuration)
+		if (err != nil || duration < 0) {
+			return nil, errors.New(fmt.Sprintf("The profile stage '%v' has an invalid duration '%v'", strings.TrimSpace(rawStage), rawDuration))
+		}
+		stage.Duration = duration
+
+		loadProfile.Stages = append(loadProfile.Stages, stage)
+	}
+
+	if (len(loadProfile.Stages) == 0) {
+		return nil, errors.New("The load profile doesn't have any stages")
+	}
+	return loadProfile, nil
+}
+
+func parseProfileTarget(rawTarget string) (target float64, targetType string, err error) {
+	targetType = RateTarget
+	if (strings.HasSuffix(rawTarget, ConcurrencyTarget)) {
+		targetType = ConcurrencyTarget
+	}
+	target, err = strconv.ParseFloat(strings.TrimSuffix(rawTarget, targetType), 64)
+	if (err != nil || target < 0) {
+		return 0, "", errors.New(fmt.Sprintf("The profile target '%v' should be a number of req/s such as '200rps' or of executors such as '50conc'", rawTarget))
+	}
+	return target, targetType, nil
+}
+
+func (p *LoadProfile) Duration() (total time.Duration) {
+	for _, stage := range p.Stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+func (p *LoadProfile) HasTargetType(targetType string) bool {
+	for _, stage := range p.Stages {
+		if (stage.TargetType == targetType) {
+			return true
+		}
+	}
+	return false
+}
+
+//At returns the target rate and concurrency the profile has reached after elapsed, past the last stage the final targets are kept
+func (p *LoadProfile) At(elapsed time.Duration) (rate float64, concurrency int) {
+	rate = p.StartRate
+	concurrencyValue := float64(p.StartConcurrency)
+
+	stageStart := time.Duration(0)
+	for _, stage := range p.Stages {
+		current := &rate
+		if (stage.TargetType == ConcurrencyTarget) {
+			current = &concurrencyValue
+		}
+
+		inStage := elapsed < stageStart + stage.Duration
+		switch stage.Kind {
+		case RampStage:
+			if (inStage) {
+				progress := float64(elapsed - stageStart) / float64(stage.Duration)
+				*current += (stage.Target - *current) * progress
+			} else {
+				*current = stage.Target
+			}
+		case StepStage:
+			*current = stage.Target
+		case SpikeStage:
+			if (inStage) {
+				*current = stage.Target
+			}
+		}
+
+		if (inStage) {
+			break
+		}
+		stageStart += stage.Duration
+	}
+
+	return rate, int(concurrencyValue + 0.5)
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"time"
+)
+
+func TestLoadProfile(t *testing.T) {
+	c.Convey("With a ramp, hold, spike and ramp down profile", t, func(){
+		profile, err := ParseLoadProfile("ramp 200rps 2m, hold 10m, spike 800rps 30s, ramp 0rps 1m", 5)
+		c.So(err, c.ShouldBeNil)
+
+		c.Convey("It lasts as long as its stages", func(){
+			c.So(profile.Duration(), c.ShouldEqual, time.Minute * 13 + time.Second * 30)
+		})
+
+		c.Convey("The rate follows the curve", func(){
+			rate, concurrency := profile.At(time.Minute)
+			c.So(rate, c.ShouldEqual, 100)
+			c.So(concurrency, c.ShouldEqual, 5)
+
+			rate, _ = profile.At(time.Minute * 5)
+			c.So(rate, c.ShouldEqual, 200)
+
+			rate, _ = profile.At(time.Minute * 12 + time.Second * 10)
+			c.So(rate, c.ShouldEqual, 800)
+
+			rate, _ = profile.At(time.Minute * 13)
+			c.So(rate, c.ShouldEqual, 100)
+
+			rate, _ = profile.At(time.Hour)
+			c.So(rate, c.ShouldEqual, 0)
+		})
+	})
+
+	c.Convey("Concurrency targets change the pool size", t, func(){
+		profile, err := ParseLoadProfile("step 20conc 1m, ramp 40conc 1m", 5)
+		c.So(err, c.ShouldBeNil)
+		c.So(profile.HasTargetType(RateTarget), c.ShouldBeFalse)
+
+		_, concurrency := profile.At(time.Second)
+		c.So(concurrency, c.ShouldEqual, 20)
+		_, concurrency = profile.At(time.Second * 90)
+		c.So(concurrency, c.ShouldEqual, 30)
+	})
+
+	c.Convey("Shrinking the pool retires idle executors straight away", t, func(){
+		spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), RequestOptions{Concurrency : 3, Requests : []RequestDefinition{{URL : "http://localhost"}}})
+		spawner.SetupExecutorPool()
+		retired := spawner.ExecutorPool[1:]
+		spawner.resizeExecutorPool(1)
+		c.So(len(spawner.ExecutorPool), c.ShouldEqual, 1)
+
+		for _, executor := range retired {
+			select {
+			case <- executor.Done:
+			case <- time.After(time.Second):
+				t.Fatal("A retired executor didn't exit")
+			}
+		}
+		spawner.ExecutorPool[0].Stop()
+		spawner.running.Wait()
+	})
+
+	c.Convey("Unknown stages and bad targets are rejected", t, func(){
+		_, err := ParseLoadProfile("climb 20rps 1m", 5)
+		c.So(err, c.ShouldNotBeNil)
+		_, err = ParseLoadProfile("ramp fast 1m", 5)
+		c.So(err, c.ShouldNotBeNil)
+	})
+}
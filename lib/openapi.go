@@ -0,0 +1,559 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//openAPIMethods are the operations of a path item, in the order they're generated
+var openAPIMethods = []string{"get", "put", "post", "patch", "delete", "head", "options", "trace"}
+
+//maxExampleDepth stops example generation from following recursive schemas forever
+const maxExampleDepth = 8
+
+//OpenAPISpec is the part of an OpenAPI 3 document needed to generate requests, Document keeps all of it for resolving $refs
+type OpenAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Servers []OpenAPIServer `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+
+	Document interface{} `json:"-"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+	Variables map[string]struct {
+		Default string `json:"default"`
+	} `json:"variables"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string `json:"operationId"`
+	Parameters []OpenAPIParameter `json:"parameters"`
+	RequestBody *OpenAPIBody `json:"requestBody"`
+	Responses map[string]OpenAPIBody `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Ref string `json:"$ref"`
+	Name string `json:"name"`
+	In string `json:"in"`
+	Required bool `json:"required"`
+	Example interface{} `json:"example"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+//OpenAPIBody is a request body or a response, both have content by media type
+type OpenAPIBody struct {
+	Ref string `json:"$ref"`
+	Content map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+	Example interface{} `json:"example"`
+	Examples map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"examples"`
+}
+
+//OpenAPIRequest is a line of the generated requests file, with a response schema to write alongside it
+type OpenAPIRequest struct {
+	Label string `json:"label"`
+	Method string `json:"method"`
+	URL string `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body json.RawMessage `json:"body,omitempty"`
+	ResponseCodes StatusCodes `json:"responseCode"`
+	SchemaPath string `json:"schema,omitempty"`
+
+	Schema map[string]interface{} `json:"-"`
+}
+
+//DoOpenAPIImport is the openapi command, it writes a requests file with a request for each operation of a spec,
+//and a JSON schema file for each operation's success response
+func DoOpenAPIImport(args []string, output io.Writer) int {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	server := flags.String("server", "", "The base url to send requests to, defaults to the first server in the spec")
+	requestsPath := flags.String("out", "", "The requests file to write, defaults to printing the requests")
+	schemaDir := flags.String("schemadir", "schemas", "The directory to write a JSON schema to for each operation's response, as referenced by the requests")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: deathstar openapi [options] spec.json")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if (err != nil) {
+		return ExitConfigurationError
+	}
+	if (flags.NArg() != 1) {
+		flags.Usage()
+		return ExitConfigurationError
+	}
+
+	spec, err := ReadOpenAPISpec(flags.Arg(0))
+	if (err == nil) {
+		var requests []OpenAPIRequest
+		requests, err = spec.Requests(*server)
+		if (err == nil) {
+			err = WriteOpenAPIRequests(requests, *schemaDir, *requestsPath, output)
+		}
+	}
+	if (err != nil) {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConfigurationError
+	}
+	return ExitPassed
+}
+
+//ReadOpenAPISpec reads an OpenAPI 3 spec written as JSON
+func ReadOpenAPISpec(path string) (spec OpenAPISpec, err error) {
+	specBytes, err := ioutil.ReadFile(path)
+	if (err != nil) {
+		return spec, errors.New(fmt.Sprintf("Could not read the spec %v, err: %v", path, err))
+	}
+	if (!json.Valid(specBytes)) {
+		return spec, errors.New(fmt.Sprintf("The spec %v is not JSON, YAML specs need converting to JSON first", path))
+	}
+
+	err = json.Unmarshal(specBytes, &spec)
+	if (err == nil) {
+		err = json.Unmarshal(specBytes, &spec.Document)
+	}
+	if (err != nil) {
+		return spec, errors.New(fmt.Sprintf("Could not decode the spec %v, err: %v", path, err))
+	}
+	if (!strings.HasPrefix(spec.OpenAPI, "3.")) {
+		return spec, errors.New(fmt.Sprintf("The spec %v is not OpenAPI 3, only OpenAPI 3 specs can be imported", path))
+	}
+	return spec, nil
+}
+
+//Requests generates a request for each operation, in order of path and method, sent to server or the spec's first server
+func (s OpenAPISpec) Requests(server string) (requests []OpenAPIRequest, err error) {
+	if (server == "") {
+		if (len(s.Servers) == 0) {
+			return nil, errors.New("The spec has no servers, pass -server with the url to send requests to")
+		}
+		server = s.Servers[0].URL
+		for name, variable := range s.Servers[0].Variables {
+			server = strings.Replace(server, "{" + name + "}", variable.Default, -1)
+		}
+	}
+	server = strings.TrimSuffix(server, "/")
+
+	paths := []string{}
+	for path := range s.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		pathItem := s.Paths[path]
+		pathParameters := []OpenAPIParameter{}
+		if (pathItem["parameters"] != nil) {
+			err = json.Unmarshal(pathItem["parameters"], &pathParameters)
+			if (err != nil) {
+				return nil, errors.New(fmt.Sprintf("Could not decode the parameters of %v, err: %v", path, err))
+			}
+		}
+
+		for _, method := range openAPIMethods {
+			if (pathItem[method] == nil) { continue }
+			operation := OpenAPIOperation{}
+			err = json.Unmarshal(pathItem[method], &operation)
+			if (err != nil) {
+				return nil, errors.New(fmt.Sprintf("Could not decode %v %v, err: %v", strings.ToUpper(method), path, err))
+			}
+			request, err := s.request(server, path, method, pathParameters, operation)
+			if (err != nil) {
+				return nil, errors.New(fmt.Sprintf("Could not generate %v %v, err: %v", strings.ToUpper(method), path, err))
+			}
+			requests = append(requests, request)
+		}
+	}
+
+	if (len(requests) == 0) {
+		return nil, errors.New("The spec has no operations")
+	}
+	return requests, nil
+}
+
+func (s OpenAPISpec) request(server string, path string, method string, pathParameters []OpenAPIParameter, operation OpenAPIOperation) (request OpenAPIRequest, err error) {
+	request = OpenAPIRequest{
+		Label : operation.OperationID,
+		Method : strings.ToUpper(method),
+		Headers : make(map[string]string),
+	}
+	if (request.Label == "") {
+		request.Label = fmt.Sprintf("%v %v", request.Method, path)
+	}
+
+	//Parameters of the operation override those of the path with the same name and location
+	parameters := make(map[string]OpenAPIParameter)
+	names := []string{}
+	for _, parameter := range append(pathParameters, operation.Parameters...) {
+		if (parameter.Ref != "") {
+			err = s.resolveInto(parameter.Ref, &parameter)
+			if (err != nil) {
+				return request, err
+			}
+		}
+		key := parameter.In + ":" + parameter.Name
+		if _, ok := parameters[key]; !ok {
+			names = append(names, key)
+		}
+		parameters[key] = parameter
+	}
+	sort.Strings(names)
+
+	query := url.Values{}
+	for _, key := range names {
+		parameter := parameters[key]
+		value, err := jsonValueToString(s.parameterExample(parameter))
+		if (err != nil) {
+			return request, err
+		}
+		switch parameter.In {
+		case "path":
+			path = strings.Replace(path, "{" + parameter.Name + "}", url.PathEscape(value), -1)
+		case "query":
+			if (parameter.Required) {
+				query.Set(parameter.Name, value)
+			}
+		case "header":
+			if (parameter.Required) {
+				request.Headers[parameter.Name] = value
+			}
+		}
+	}
+	request.URL = server + path
+	if (len(query) > 0) {
+		request.URL += "?" + query.Encode()
+	}
+
+	if (operation.RequestBody != nil) {
+		body := *operation.RequestBody
+		if (body.Ref != "") {
+			err = s.resolveInto(body.Ref, &body)
+			if (err != nil) {
+				return request, err
+			}
+		}
+		mediaType, content, ok := jsonContent(body.Content)
+		if (ok) {
+			request.Headers["Content-Type"] = mediaType
+			example := s.mediaTypeExample(content)
+			if (example != nil) {
+				request.Body, err = json.Marshal(example)
+				if (err != nil) {
+					return request, err
+				}
+			}
+		}
+	}
+
+	var schema map[string]interface{}
+	request.ResponseCodes, schema, err = s.successResponses(operation.Responses)
+	if (schema != nil) {
+		request.Schema = s.ResponseSchema(schema)
+	}
+	return request, err
+}
+
+//successResponses are the 2xx codes of the operation, and the JSON schema of the first of them with one
+func (s OpenAPISpec) successResponses(responses map[string]OpenAPIBody) (codes StatusCodes, schema map[string]interface{}, err error) {
+	rawCodes := []string{}
+	for rawCode := range responses {
+		if (strings.HasPrefix(rawCode, "2")) {
+			rawCodes = append(rawCodes, rawCode)
+		}
+	}
+	sort.Strings(rawCodes)
+	if (len(rawCodes) == 0) {
+		codes, _ = ParseStatusCodes("200-299")
+		return codes, nil, nil
+	}
+
+	for _, rawCode := range rawCodes {
+		if (strings.ToUpper(rawCode) == "2XX") {
+			codes = append(codes, StatusCodeRange{Min : 200, Max : 299})
+		} else {
+			code, err := strconv.Atoi(rawCode)
+			if (err != nil) {
+				return nil, nil, errors.New(fmt.Sprintf("Unknown response code '%v'", rawCode))
+			}
+			codes = append(codes, StatusCodeRange{Min : code, Max : code})
+		}
+
+		response := responses[rawCode]
+		if (response.Ref != "") {
+			err = s.resolveInto(response.Ref, &response)
+			if (err != nil) {
+				return nil, nil, err
+			}
+		}
+		_, content, ok := jsonContent(response.Content)
+		if (ok && schema == nil && content.Schema != nil) {
+			schema = content.Schema
+		}
+	}
+	return codes, schema, nil
+}
+
+//jsonContent picks application/json, or another JSON media type, from content
+func jsonContent(content map[string]OpenAPIMediaType) (mediaType string, mediaContent OpenAPIMediaType, ok bool) {
+	if mediaContent, ok = content["application/json"]; ok {
+		return "application/json", mediaContent, true
+	}
+	mediaTypes := []string{}
+	for mediaType := range content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		if (strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "/json")) {
+			return mediaType, content[mediaType], true
+		}
+	}
+	return "", mediaContent, false
+}
+
+func (s OpenAPISpec) parameterExample(parameter OpenAPIParameter) interface{} {
+	if (parameter.Example != nil) {
+		return parameter.Example
+	}
+	example := s.schemaExample(parameter.Schema, 0)
+	if (example == nil) {
+		return "example"
+	}
+	return example
+}
+
+//mediaTypeExample takes the example of the content, the first of its named examples, or one generated from its schema
+func (s OpenAPISpec) mediaTypeExample(content OpenAPIMediaType) interface{} {
+	if (content.Example != nil) {
+		return content.Example
+	}
+	if (len(content.Examples) > 0) {
+		names := []string{}
+		for name := range content.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return content.Examples[names[0]].Value
+	}
+	return s.schemaExample(content.Schema, 0)
+}
+
+//schemaExample uses the example, default or first enum value of a schema, or builds a value of its type
+func (s OpenAPISpec) schemaExample(schema map[string]interface{}, depth int) interface{} {
+	if (schema == nil || depth > maxExampleDepth) {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved := map[string]interface{}{}
+		if (s.resolveInto(ref, &resolved) != nil) {
+			return nil
+		}
+		return s.schemaExample(resolved, depth + 1)
+	}
+	for _, key := range []string{"example", "default"} {
+		if value, ok := schema[key]; ok {
+			return value
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if options, ok := schema[key].([]interface{}); ok && len(options) > 0 {
+			option, _ := options[0].(map[string]interface{})
+			return s.schemaExample(option, depth + 1)
+		}
+	}
+	if parts, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, part := range parts {
+			partSchema, _ := part.(map[string]interface{})
+			if partExample, ok := s.schemaExample(partSchema, depth + 1).(map[string]interface{}); ok {
+				for name, value := range partExample {
+					merged[name] = value
+				}
+			}
+		}
+		return merged
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if properties, ok := schema["properties"].(map[string]interface{}); ok || schemaType == "object" {
+		example := map[string]interface{}{}
+		for name, property := range properties {
+			propertySchema, _ := property.(map[string]interface{})
+			value := s.schemaExample(propertySchema, depth + 1)
+			if (value != nil) {
+				example[name] = value
+			}
+		}
+		return example
+	}
+
+	switch schemaType {
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		item := s.schemaExample(items, depth + 1)
+		if (item == nil) {
+			return []interface{}{}
+		}
+		return []interface{}{item}
+	case "integer", "number":
+		if minimum, ok := schema["minimum"]; ok {
+			return minimum
+		}
+		return 1
+	case "boolean":
+		return true
+	case "string":
+		return stringExample(schema)
+	}
+	return nil
+}
+
+func stringExample(schema map[string]interface{}) string {
+	format, _ := schema["format"].(string)
+	switch format {
+	case "date-time":
+		return "2020-01-01T00:00:00Z"
+	case "date":
+		return "2020-01-01"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "http://example.com"
+	}
+	if minLength, ok := schema["minLength"].(float64); ok && minLength > 7 {
+		return strings.Repeat("x", int(minLength))
+	}
+	return "example"
+}
+
+//resolveInto decodes the part of the spec a local $ref such as #/components/schemas/Item points at into target
+func (s OpenAPISpec) resolveInto(ref string, target interface{}) error {
+	if (!strings.HasPrefix(ref, "#/")) {
+		return errors.New(fmt.Sprintf("Only local $refs can be imported, not '%v'", ref))
+	}
+	value := s.Document
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		key = strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+		node, ok := value.(map[string]interface{})
+		if (!ok || node[key] == nil) {
+			return errors.New(fmt.Sprintf("The $ref '%v' could not be found in the spec", ref))
+		}
+		value = node[key]
+	}
+	valueBytes, err := json.Marshal(value)
+	if (err != nil) {
+		return err
+	}
+	return json.Unmarshal(valueBytes, target)
+}
+
+//ResponseSchema makes the JSON schema of a response standalone, it carries the spec's component schemas so its $refs resolve,
+//and nullable, which OpenAPI 3.0 uses in place of a null type, is turned into one
+func (s OpenAPISpec) ResponseSchema(schema map[string]interface{}) map[string]interface{} {
+	standalone := nullableToType(schema).(map[string]interface{})
+	if components, ok := s.Document.(map[string]interface{})["components"].(map[string]interface{}); ok && components["schemas"] != nil {
+		standalone["components"] = map[string]interface{}{"schemas" : nullableToType(components["schemas"])}
+	}
+	return standalone
+}
+
+func nullableToType(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		converted := map[string]interface{}{}
+		for key, child := range node {
+			converted[key] = nullableToType(child)
+		}
+		if nullable, _ := node["nullable"].(bool); nullable {
+			if schemaType, ok := node["type"].(string); ok {
+				converted["type"] = []interface{}{schemaType, "null"}
+			}
+		}
+		return converted
+	case []interface{}:
+		converted := []interface{}{}
+		for _, child := range node {
+			converted = append(converted, nullableToType(child))
+		}
+		return converted
+	}
+	return value
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+//WriteOpenAPIRequests writes each response schema to schemaDir, checking it compiles, then writes the requests as JSONL
+//to requestsPath, or output when it's empty
+func WriteOpenAPIRequests(requests []OpenAPIRequest, schemaDir string, requestsPath string, output io.Writer) error {
+	lines := bytes.NewBufferString("")
+	written := make(map[string]bool)
+	for _, request := range requests {
+		if (request.Schema != nil) {
+			name := strings.Trim(unsafeFileChars.ReplaceAllString(request.Label, "_"), "_")
+			for written[name] {
+				name += "_"
+			}
+			written[name] = true
+			request.SchemaPath = filepath.Join(schemaDir, name + ".json")
+
+			schemaBytes, err := json.MarshalIndent(request.Schema, "", "  ")
+			if (err != nil) {
+				return err
+			}
+			_, err = CompileSchema(string(schemaBytes))
+			if (err != nil) {
+				return errors.New(fmt.Sprintf("The response schema of %v can't be used, %v", request.Label, err))
+			}
+			err = os.MkdirAll(schemaDir, 0755)
+			if (err == nil) {
+				err = ioutil.WriteFile(request.SchemaPath, schemaBytes, 0644)
+			}
+			if (err != nil) {
+				return errors.New(fmt.Sprintf("Could not write the schema %v, err: %v", request.SchemaPath, err))
+			}
+		}
+
+		line, err := json.Marshal(request)
+		if (err != nil) {
+			return err
+		}
+		lines.Write(append(line, '\n'))
+	}
+
+	if (requestsPath == "") {
+		_, err := output.Write(lines.Bytes())
+		return err
+	}
+	err := ioutil.WriteFile(requestsPath, lines.Bytes(), 0644)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not write the requests file %v, err: %v", requestsPath, err))
+	}
+	fmt.Fprintf(output, "Wrote %v requests to %v\n", len(requests), requestsPath)
+	return nil
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const testOpenAPISpec = `{
+	"openapi": "3.0.3",
+	"servers": [{"url": "http://{host}/v1/", "variables": {"host": {"default": "localhost:8080"}}}],
+	"paths": {
+		"/items": {
+			"get": {
+				"operationId": "listItems",
+				"parameters": [
+					{"name": "limit", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 10}},
+					{"name": "cursor", "in": "query", "schema": {"type": "string"}}
+				],
+				"responses": {
+					"200": {"description": "ok", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}}}}
+				}
+			},
+			"post": {
+				"requestBody": {"$ref": "#/components/requestBodies/NewItem"},
+				"responses": {
+					"201": {"description": "created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+					"202": {"description": "queued"}
+				}
+			}
+		},
+		"/items/{id}": {
+			"parameters": [{"$ref": "#/components/parameters/ItemId"}],
+			"delete": {
+				"operationId": "deleteItem",
+				"parameters": [{"name": "X-Request-Id", "in": "header", "required": true, "example": "abc"}],
+				"responses": {"204": {"description": "deleted"}}
+			}
+		}
+	},
+	"components": {
+		"parameters": {
+			"ItemId": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "example": 42}}
+		},
+		"requestBodies": {
+			"NewItem": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewItem"}}}}
+		},
+		"schemas": {
+			"NewItem": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "tags": {"type": "array", "items": {"type": "string", "enum": ["red", "blue"]}}}},
+			"Item": {"allOf": [{"$ref": "#/components/schemas/NewItem"}, {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}, "note": {"type": "string", "nullable": true}}}]}
+		}
+	}
+}`
+
+func TestOpenAPIImport(t *testing.T) {
+	c.Convey("With an OpenAPI 3 spec", t, func(){
+		dir, err := ioutil.TempDir("", "openapi")
+		c.So(err, c.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		specPath := filepath.Join(dir, "spec.json")
+		c.So(ioutil.WriteFile(specPath, []byte(testOpenAPISpec), 0644), c.ShouldBeNil)
+
+		spec, err := ReadOpenAPISpec(specPath)
+		c.So(err, c.ShouldBeNil)
+		requests, err := spec.Requests("")
+		c.So(err, c.ShouldBeNil)
+
+		c.Convey("A request is generated for each operation with example parameters and bodies", func(){
+			c.So(len(requests), c.ShouldEqual, 3)
+
+			c.So(requests[0].Label, c.ShouldEqual, "listItems")
+			c.So(requests[0].URL, c.ShouldEqual, "http://localhost:8080/v1/items?limit=10")
+			c.So(requests[0].ResponseCodes.String(), c.ShouldEqual, "200")
+
+			c.So(requests[1].Label, c.ShouldEqual, "POST /items")
+			c.So(requests[1].Headers["Content-Type"], c.ShouldEqual, "application/json")
+			c.So(string(requests[1].Body), c.ShouldEqual, `{"name":"example","tags":["red"]}`)
+			c.So(requests[1].ResponseCodes.String(), c.ShouldEqual, "201,202")
+
+			c.So(requests[2].URL, c.ShouldEqual, "http://localhost:8080/v1/items/42")
+			c.So(requests[2].Headers["X-Request-Id"], c.ShouldEqual, "abc")
+			c.So(requests[2].Schema, c.ShouldBeNil)
+		})
+
+		c.Convey("The requests file and response schemas load as request definitions that validate responses", func(){
+			requestsPath := filepath.Join(dir, "requests.jsonl")
+			schemaDir := filepath.Join(dir, "schemas")
+			output := bytes.NewBufferString("")
+			c.So(DoOpenAPIImport([]string{"-out", requestsPath, "-schemadir", schemaDir, "-server", "http://staging", specPath}, output), c.ShouldEqual, ExitPassed)
+			c.So(output.String(), c.ShouldContainSubstring, "Wrote 3 requests to")
+
+			definitions, err := LoadRequestDefinitions(requestsPath, NewPlan("http://localhost").RequestOptions)
+			c.So(err, c.ShouldBeNil)
+			c.So(definitions[0].URL, c.ShouldEqual, "http://staging/items?limit=10")
+			c.So(definitions[1].SchemaPath, c.ShouldEqual, filepath.Join(schemaDir, "POST_items.json"))
+			c.So(definitions[1].ResponseCodes.Contains(202), c.ShouldBeTrue)
+
+			c.So(ValidateSchema(`{"id": 1, "name": "thing", "note": null}`, nil, definitions[1].Schema), c.ShouldBeNil)
+			c.So(ValidateSchema(`{"name": "thing"}`, nil, definitions[1].Schema), c.ShouldNotBeNil)
+			c.So(ValidateSchema(`[{"id": "one", "name": "thing"}]`, nil, definitions[0].Schema), c.ShouldNotBeNil)
+		})
+	})
+
+	c.Convey("Specs that can't be imported are rejected", t, func(){
+		dir, err := ioutil.TempDir("", "openapi")
+		c.So(err, c.ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		yamlPath := filepath.Join(dir, "spec.yaml")
+		c.So(ioutil.WriteFile(yamlPath, []byte("openapi: 3.0.0\n"), 0644), c.ShouldBeNil)
+		_, err = ReadOpenAPISpec(yamlPath)
+		c.So(err.Error(), c.ShouldContainSubstring, "YAML specs need converting to JSON")
+
+		swaggerPath := filepath.Join(dir, "swagger.json")
+		c.So(ioutil.WriteFile(swaggerPath, []byte(`{"swagger": "2.0", "paths": {}}`), 0644), c.ShouldBeNil)
+		c.So(DoOpenAPIImport([]string{swaggerPath}, ioutil.Discard), c.ShouldEqual, ExitConfigurationError)
+	})
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//metricsLatencyBuckets are the upper bounds of the latency histogram buckets, they're fixed so they can be aggregated across runs
+var metricsLatencyBuckets = []time.Duration{
+	time.Millisecond, time.Microsecond * 2500, time.Millisecond * 5, time.Millisecond * 10, time.Millisecond * 25, time.Millisecond * 50,
+	time.Millisecond * 100, time.Millisecond * 250, time.Millisecond * 500, time.Second, time.Millisecond * 2500, time.Second * 5, time.Second * 10,
+}
+
+//MetricsServer serves the live stats of a test at /metrics in the Prometheus text exposition format, so a load test can be graphed next to the service it's testing.
+//The counters and histograms come from the accumulator's summary and the rates and executors from the spawner's latest overall stats.
+type MetricsServer struct {
+	Address string
+	Accumulator *Accumulator
+	CurrentOverallStats func() OverallStats
+
+	server *http.Server
+}
+
+func NewMetricsServer(address string, accumulator *Accumulator, currentOverallStats func() OverallStats) *MetricsServer {
+	metricsServer := &MetricsServer{
+		Address : address,
+		Accumulator : accumulator,
+		CurrentOverallStats : currentOverallStats,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsServer)
+	metricsServer.server = &http.Server{Addr : address, Handler : mux}
+	return metricsServer
+}
+
+func (m *MetricsServer) Start() {
+	go func() {
+		Log("top", fmt.Sprintf("Serving Prometheus metrics at %v/metrics", m.Address))
+		err := m.server.ListenAndServe()
+		if (err != nil && err != http.ErrServerClosed) {
+			Log("top", fmt.Sprintln("Could not serve Prometheus metrics, err: ", err))
+		}
+	}()
+}
+
+func (m *MetricsServer) Stop() {
+	m.server.Close()
+}
+
+func (m *MetricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := bytes.NewBufferString("")
+	WriteMetrics(buf, m.Accumulator.CurrentSummary(), m.CurrentOverallStats())
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+//WriteMetrics writes the summary and overall stats as Prometheus metrics
+func WriteMetrics(w io.Writer, summary *StatsSummary, overall OverallStats) {
+	statusCodes := []int{}
+	for statusCode := range summary.StatusCodes {
+		statusCodes = append(statusCodes, statusCode)
+	}
+	sort.Ints(statusCodes)
+	writeMetricHeader(w, "deathstar_requests_total", "counter", "Requests that have finished by the status code of their response, none when there wasn't a response")
+	for _, statusCode := range statusCodes {
+		status := strconv.Itoa(statusCode)
+		if (statusCode == 0) {
+			status = "none"
+		}
+		fmt.Fprintf(w, "deathstar_requests_total{status=\"%v\"} %v\n", status, summary.StatusCodes[statusCode])
+	}
+
+	failures := make(map[string]int)
+	for _, category := range failureCategories {
+		failures[category] = 0
+	}
+	for _, failureCount := range summary.FailureCounts {
+		failures[failureCount.Example.Category()] += failureCount.Count
+	}
+	categories := []string{}
+	for category := range failures {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	writeMetricHeader(w, "deathstar_failures_total", "counter", "Failures by category, a request can fail more than one way")
+	for _, category := range categories {
+		fmt.Fprintf(w, "deathstar_failures_total{category=\"%v\"} %v\n", escapeMetricLabel(category), failures[category])
+	}
+
+	writeMetric(w, "deathstar_responses_total", "counter", "Requests that got a response", float64(summary.Responses))
+	writeMetric(w, "deathstar_valid_responses_total", "counter", "Requests that didn't fail", float64(summary.ValidResponses))
+	writeMetric(w, "deathstar_response_bytes_total", "counter", "Bytes of response payloads received", float64(summary.ResponseBytes))
+	writeMetric(w, "deathstar_connections_reused_total", "counter", "Requests sent on a kept alive connection", float64(summary.ConnectionsReused))
+
+	writeMetricHeader(w, "deathstar_request_duration_seconds", "histogram", "Latency of the requests that got a response, in total and by phase")
+	writeMetricHistogram(w, "total", summary.TotalTime)
+	for index, phase := range summary.Phases {
+		writeMetricHistogram(w, metricPhaseName(phaseNames[index]), phase)
+	}
+
+	writeMetric(w, "deathstar_requests_issued_total", "counter", "Requests the spawner has issued", float64(overall.RequestsIssued))
+	writeMetric(w, "deathstar_requests_delayed_total", "counter", "Scheduled requests that were sent after their intended time", float64(overall.RequestsDelayed))
+	writeMetric(w, "deathstar_requests_dropped_total", "counter", "Scheduled requests that were dropped as there was no executor", float64(overall.RequestsDropped))
+	writeMetric(w, "deathstar_target_rate", "gauge", "The req/s the test or load profile is aiming for", overall.TargetRate)
+	writeMetric(w, "deathstar_achieved_rate", "gauge", "The req/s issued over the last second", overall.AchievedRate)
+
+	writeMetricHeader(w, "deathstar_executors", "gauge", "Executors in the pool by whether they're executing a request")
+	fmt.Fprintf(w, "deathstar_executors{state=\"busy\"} %v\n", overall.NumBusyExecutors)
+	fmt.Fprintf(w, "deathstar_executors{state=\"available\"} %v\n", overall.NumAvailableExecutors)
+}
+
+func writeMetricHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, metricType)
+}
+
+func writeMetric(w io.Writer, name string, metricType string, help string, value float64) {
+	writeMetricHeader(w, name, metricType, help)
+	fmt.Fprintf(w, "%v %v\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func writeMetricHistogram(w io.Writer, phase string, histogram *LatencyHistogram) {
+	for index, count := range histogram.CumulativeCounts(metricsLatencyBuckets) {
+		fmt.Fprintf(w, "deathstar_request_duration_seconds_bucket{phase=\"%v\",le=\"%v\"} %v\n", phase, strconv.FormatFloat(metricsLatencyBuckets[index].Seconds(), 'g', -1, 64), count)
+	}
+	fmt.Fprintf(w, "deathstar_request_duration_seconds_bucket{phase=\"%v\",le=\"+Inf\"} %v\n", phase, histogram.Count)
+	fmt.Fprintf(w, "deathstar_request_duration_seconds_sum{phase=\"%v\"} %v\n", phase, strconv.FormatFloat(time.Duration(histogram.Sum).Seconds(), 'g', -1, 64))
+	fmt.Fprintf(w, "deathstar_request_duration_seconds_count{phase=\"%v\"} %v\n", phase, histogram.Count)
+}
+
+//metricPhaseName turns a phase name like "Time To First Byte" into a label value like time_to_first_byte
+func metricPhaseName(name string) string {
+	return strings.Replace(strings.ToLower(name), " ", "_", -1)
+}
+
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"errors"
+	"net/http/httptest"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	c.Convey("With an accumulator that has recorded responses and a failed request", t, func(){
+		accumulator := NewAccumulator(100, 0, []float64{0.5}, make(chan ResponseStats), make(chan OverallStats))
+		accumulator.mu.Lock()
+		for _, totalTime := range []time.Duration{time.Millisecond * 3, time.Millisecond * 30, time.Millisecond * 300} {
+			accumulator.Record(ResponseStats{
+				TotalTime : totalTime,
+				StatusCode : 200,
+				RespPayload : "ok",
+				Phases : RequestPhases{TimeToFirstByte : totalTime},
+			})
+		}
+		accumulator.Record(ResponseStats{
+			StatusCode : 503,
+			TotalTime : time.Millisecond * 2,
+			Failures : []DescriptiveError{*NewStatusCodeError(503)},
+		})
+		accumulator.Record(ResponseStats{
+			Failures : []DescriptiveError{*NewRequestExecutionError(errors.New("connection refused"))},
+		})
+		accumulator.mu.Unlock()
+
+		overallStats := OverallStats{TargetRate : 50, AchievedRate : 48.5, RequestsIssued : 6, NumBusyExecutors : 1, NumAvailableExecutors : 9}
+		server := NewMetricsServer(":0", accumulator, func() OverallStats { return overallStats })
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		metrics := recorder.Body.String()
+
+		c.Convey("Requests are counted by status code", func(){
+			c.So(recorder.Header().Get("Content-Type"), c.ShouldStartWith, "text/plain; version=0.0.4")
+			c.So(metrics, c.ShouldContainSubstring, "# TYPE deathstar_requests_total counter\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_requests_total{status=\"none\"} 1\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_requests_total{status=\"200\"} 3\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_requests_total{status=\"503\"} 1\n")
+		})
+
+		c.Convey("Failures are counted by category, including the ones that haven't happened", func(){
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_failures_total{category=\"StatusCode\"} 1\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_failures_total{category=\"RequestExecutionError\"} 1\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_failures_total{category=\"Validation\"} 0\n")
+		})
+
+		c.Convey("Latencies of the requests that got a response are cumulative histograms by phase", func(){
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_bucket{phase=\"total\",le=\"0.001\"} 0\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_bucket{phase=\"total\",le=\"0.005\"} 2\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_bucket{phase=\"total\",le=\"0.05\"} 3\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_bucket{phase=\"total\",le=\"+Inf\"} 4\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_count{phase=\"total\"} 4\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_sum{phase=\"total\"} 0.335\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_count{phase=\"time_to_first_byte\"} 3\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_request_duration_seconds_count{phase=\"dns_lookup\"} 0\n")
+		})
+
+		c.Convey("Rates and executors come from the overall stats", func(){
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_target_rate 50\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_achieved_rate 48.5\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_requests_issued_total 6\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_executors{state=\"busy\"} 1\n")
+			c.So(metrics, c.ShouldContainSubstring, "deathstar_executors{state=\"available\"} 9\n")
+		})
+	})
+}
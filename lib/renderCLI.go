@@ -11,6 +11,7 @@ import (
 	"errors"
 	"sort"
 	"github.com/cheggaaa/pb"
+	"text/tabwriter"
 )
 
 type CLIRenderData struct {
@@ -25,11 +26,18 @@ type CLIRenderData struct {
 	LatestResponseHistogram string
 	LatestProgress string
 
+	//The left pane can be switched between response times and each request phase with tab
+	LatestPhasePercentiles []string
+	LatestPhaseHistograms []string
+
 	LatestFailures []string
 
+	LatestEndpoints string
+
 	LatestSummary string
 
 	LatestTopPercentile string
+	LatestTopResponseTimePercentile string
 }
 
 var title = `
@@ -53,6 +61,8 @@ type RenderCLI struct {
 	Data CLIRenderData
 	Done chan bool
 
+	PhaseIndex int
+
 	IsClosed bool
 }
 
@@ -69,6 +79,9 @@ func (r *RenderCLI)Setup(done chan bool)  {
 		if err := r.GUI.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, r.quitGUI); err != nil {
 			log.Panicln(err)
 		}
+		if err := r.GUI.SetKeybinding("", gocui.KeyTab, gocui.ModNone, r.nextPhase); err != nil {
+			log.Panicln(err)
+		}
 		err = r.GUI.MainLoop()
 		if err != nil && err != gocui.Quit {
 			log.Panicln(err)
@@ -84,10 +97,15 @@ func (r *RenderCLI)Generate(stats AggregatedStats) {
 	r.Data.LatestConnectHistogram, r.Data.LatestTotalHistogram, r.Data.LatestResponseHistogram = r.GenerateHistogram(stats)
 	r.Data.LatestProgress = r.GenerateProgressBar(stats)
 	r.Data.LatestFailures = r.GenerateFailures(stats)
+	r.Data.LatestEndpoints = r.GenerateEndpoints(stats)
+	r.Data.LatestPhasePercentiles, r.Data.LatestPhaseHistograms = r.GeneratePhases(stats)
 
 	if (len(stats.TotalTimePercentiles) > 0) {
 		r.Data.LatestTopPercentile = stats.TotalTimePercentiles[ len(stats.TotalTimePercentiles) -1 ].String()
 	}
+	if (len(stats.ResponseTimePercentiles) > 0) {
+		r.Data.LatestTopResponseTimePercentile = stats.ResponseTimePercentiles[ len(stats.ResponseTimePercentiles) -1 ].String()
+	}
 }
 
 func (r *RenderCLI)Render() {
@@ -111,17 +129,37 @@ func (r *RenderCLI)Quit() {
 func (r *RenderCLI)renderGUI(g *gocui.Gui) error{
 	maxX, maxY := g.Size()
 
-	leftView, err := g.SetView("left", 0, 24, maxX/3, maxY-1)
+	//Only show the endpoint breakdown when there's more than one endpoint to break down
+	latencyTop := 24
+	if (len(r.Data.Latest.Endpoints) > 1) {
+		latencyTop = 24 + len(r.Data.Latest.Endpoints) + 3
+		endpointsView, err := g.SetView("endpoints", 0, 24, maxX-1, latencyTop-1)
+		if err != nil {
+			if err != gocui.ErrorUnkView {
+				return err
+			}
+		}
+		fmt.Fprintln(endpointsView, r.Data.LatestEndpoints)
+	}
+
+	leftView, err := g.SetView("left", 0, latencyTop, maxX/3, maxY-1)
 	if err != nil {
 		if err != gocui.ErrorUnkView {
 			return err
 		}
 	}
-	fmt.Fprintln(leftView, "Response Times")
-	fmt.Fprintln(leftView, r.Data.LatestResponsePercentiles)
-	fmt.Fprintln(leftView, r.Data.LatestResponseHistogram)
+	if (r.PhaseIndex == 0 || r.PhaseIndex > len(r.Data.Latest.Phases)) {
+		fmt.Fprintln(leftView, "Response Times (tab for request phases)")
+		fmt.Fprintln(leftView, r.Data.LatestResponsePercentiles)
+		fmt.Fprintln(leftView, r.Data.LatestResponseHistogram)
+	} else {
+		fmt.Fprintln(leftView, r.Data.Latest.Phases[r.PhaseIndex - 1].Name, "(tab for the next phase)")
+		fmt.Fprintln(leftView, "Connections reused: ", r.Data.Latest.ConnectionsReused)
+		fmt.Fprintln(leftView, r.Data.LatestPhasePercentiles[r.PhaseIndex - 1])
+		fmt.Fprintln(leftView, r.Data.LatestPhaseHistograms[r.PhaseIndex - 1])
+	}
 
-	rightView, err := g.SetView("right", maxX*2/3, 24, maxX-1, maxY-1)
+	rightView, err := g.SetView("right", maxX*2/3, latencyTop, maxX-1, maxY-1)
 	if err != nil {
 		if err != gocui.ErrorUnkView {
 			return err
@@ -131,7 +169,7 @@ func (r *RenderCLI)renderGUI(g *gocui.Gui) error{
 	fmt.Fprintln(rightView, r.Data.LatestTotalPercentiles)
 	fmt.Fprintln(rightView, r.Data.LatestTotalHistogram)
 
-	middleView, err := g.SetView("middle", maxX/3, 24, maxX*2/3, maxY-1)
+	middleView, err := g.SetView("middle", maxX/3, latencyTop, maxX*2/3, maxY-1)
 	if err != nil {
 		if err != gocui.ErrorUnkView {
 			return err
@@ -151,9 +189,21 @@ func (r *RenderCLI)renderGUI(g *gocui.Gui) error{
 	fmt.Fprintln(topLeftView, "Requests to Issue: ", r.ReqOpts.RequestsToIssue)
 	fmt.Fprintln(topLeftView, "Requests Issued: ", r.Data.Latest.TotalRequests)
 	fmt.Fprintln(topLeftView, "Failures: ", r.Data.Latest.Failures)
+	rolling := r.Data.Latest.Rolling
+	if (len(rolling.Percentiles) > 0) {
+		fmt.Fprintf(topLeftView, "Last %v: %.2f req/s, %.2f resp/s, %.2f errors/s, %vth Percentile time: %v\n",
+			rolling.Window.Truncate(time.Second), rolling.RequestRate, rolling.ResponseRate, rolling.ErrorRate, r.Data.Latest.Percentiles[len(r.Data.Latest.Percentiles) - 1] * 100, rolling.Percentiles[len(rolling.Percentiles) - 1])
+	}
+	if (r.ReqOpts.Profile != nil) {
+		fmt.Fprintf(topLeftView, "Target / Achieved Rate: %.2f / %.2f req/s, %v executors\n", r.Data.Latest.TargetRate, r.Data.Latest.AchievedRate, r.Data.Latest.TargetConcurrency)
+	}
+	if (r.ReqOpts.Arrival != ClosedArrival) {
+		fmt.Fprintln(topLeftView, "Delayed / Dropped: ", r.Data.Latest.RequestsDelayed, " / ", r.Data.Latest.RequestsDropped, " (mean delay ", r.Data.Latest.MeanDelay, ")")
+	}
 	fmt.Fprintln(topLeftView, "Maximum Response Time: ", r.Data.Latest.MaxTotalTime)
 	if (len(r.Data.LatestTotalPercentiles) > 0 && len(r.Data.Latest.Percentiles) > 0) {
 		fmt.Fprintln(topLeftView, r.Data.Latest.Percentiles[len(r.Data.Latest.Percentiles) - 1] * 100, "th Percentile time: ",  r.Data.LatestTopPercentile)
+		fmt.Fprintln(topLeftView, r.Data.Latest.Percentiles[len(r.Data.Latest.Percentiles) - 1] * 100, "th Percentile time (from intended send): ",  r.Data.LatestTopResponseTimePercentile)
 	}
 	fmt.Fprintln(topLeftView, "Minimum Response Time: ", r.Data.Latest.MinTotalTime)
 	fmt.Fprintln(topLeftView, "Started at, ", r.Data.Latest.StartTime)
@@ -166,6 +216,9 @@ func (r *RenderCLI)renderGUI(g *gocui.Gui) error{
 			return err
 		}
 	}
+	if (r.Data.Latest.SearchSummary != "") {
+		fmt.Fprintln(topRightView, "Capacity search, ", len(r.Data.Latest.SearchLevels), " levels run: ", r.Data.Latest.SearchSummary)
+	}
 	for _, failure := range r.Data.LatestFailures {
 		fmt.Fprintln(topRightView, failure)
 	}
@@ -197,16 +250,52 @@ func (r *RenderCLI)quitGUI(g *gocui.Gui, v *gocui.View) error{
 	return gocui.Quit
 }
 
+func (r *RenderCLI)nextPhase(g *gocui.Gui, v *gocui.View) error{
+	r.PhaseIndex = (r.PhaseIndex + 1) % (len(r.Data.Latest.Phases) + 1)
+	return r.renderGUI(g)
+}
+
 func (r *RenderCLI) GenerateFailures(stats AggregatedStats) (failuresStrs []string) {
 	for _, failures := range r.Data.Latest.FailureCounts {
-		if (len(failures) > 1) {
-			failuresStrs = append(failuresStrs, fmt.Sprintf("%v Failures: %v", len(failures), failures[0].Error()) )
+		if (failures.Count > 1) {
+			failuresStrs = append(failuresStrs, fmt.Sprintf("%v Failures: %v", failures.Count, failures.Example.Error()) )
 		}
 	}
 	sort.Strings(failuresStrs)
 	return failuresStrs
 }
 
+func (r *RenderCLI) GenerateEndpoints(stats AggregatedStats) string {
+	if (len(stats.Endpoints) == 0) {
+		return ""
+	}
+
+	topPercentileTitle := "Top Percentile"
+	if (len(stats.Percentiles) > 0) {
+		topPercentileTitle = fmt.Sprintf("%vth Percentile", stats.Percentiles[len(stats.Percentiles) - 1] * 100)
+	}
+
+	output := bytes.NewBuffer([]byte{})
+	table := tabwriter.NewWriter(output, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "Endpoint\tRequests\tResponses\tFailures\tHarvest\tYield\tMean\t%v\tMax\t%v (from intended)\n", topPercentileTitle, topPercentileTitle)
+	for _, endpoint := range stats.Endpoints {
+		topPercentile := "-"
+		if (len(endpoint.TotalTimePercentiles) > 0) {
+			topPercentile = endpoint.TotalTimePercentiles[len(endpoint.TotalTimePercentiles) - 1].String()
+		}
+		topResponseTimePercentile := "-"
+		if (len(endpoint.ResponseTimePercentiles) > 0) {
+			topResponseTimePercentile = endpoint.ResponseTimePercentiles[len(endpoint.ResponseTimePercentiles) - 1].String()
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%.2f%%\t%.2f%%\t%v\t%v\t%v\t%v\n",
+			endpoint.Label, endpoint.TotalRequests, endpoint.TotalResponses, endpoint.Failures,
+			endpoint.Harvest, endpoint.Yield, endpoint.MeanTotalTime, topPercentile, endpoint.MaxTotalTime, topResponseTimePercentile)
+	}
+	table.Flush()
+
+	return output.String()
+}
+
 func (r *RenderCLI) GenerateProgressBar(stats AggregatedStats) string {
 	count := int(stats.TotalTestDuration.Nanoseconds())
 	bar := pb.StartNew(count)
@@ -264,6 +353,30 @@ func getHist(data []float64) (output string, err error) {
 	return string(bytes), nil
 }
 
+func (r *RenderCLI) GeneratePhases(stats AggregatedStats) (percentileOutputs []string, histogramOutputs []string) {
+	for _, phase := range stats.Phases {
+		if (len(phase.Latencies) == 0) {
+			percentileOutputs = append(percentileOutputs, "No requests have gone through this phase yet....")
+			histogramOutputs = append(histogramOutputs, "")
+			continue
+		}
+
+		percentileOutput := "Percentiles: \n"
+		for index, percentile := range stats.Percentiles {
+			suffix := "th"
+			if (index == 0) {
+				suffix = "st"
+			}
+			percentileOutput += fmt.Sprintf("%v%v Percentile: %s \n", percentile*100, suffix, phase.Percentiles[index].String())
+		}
+		percentileOutputs = append(percentileOutputs, percentileOutput)
+
+		histogramOutput, _ := getHist(phase.Latencies)
+		histogramOutputs = append(histogramOutputs, "Histogram: \n" + histogramOutput)
+	}
+	return percentileOutputs, histogramOutputs
+}
+
 func (r *RenderCLI) GeneratePercentiles(stats AggregatedStats) (connectOutput, totalOutput, responseOutput string){
 	if (stats.TotalRequests == 0){
 		output := "No requests returned yet...."
@@ -7,6 +7,7 @@ import (
 	socketio     "github.com/googollee/go-socket.io"
 	"encoding/json"
 	"math"
+	"sort"
 )
 
 type RenderHTML struct {
@@ -29,12 +30,16 @@ type RenderData struct {
 	LatestConnectPercentiles []float64
  	LatestTotalPercentiles []float64
  	LatestResponsePercentiles []float64
+	LatestResponseTimePercentiles []float64
 	PercentileTitles []string
 
 	SampledRespThroughputs []float64
 	RespThroughPutSampling float64
 	SampledByteThroughputs []float64
 	ByteThroughPutSampling float64
+	SampledTargetRates []float64
+	SampledAchievedRates []float64
+	RateSampling float64
 
 	SampledConnectionLatencies []float64
 	ConnectionLatencySampling float64
@@ -54,6 +59,7 @@ type RenderData struct {
 	AvgResponseTime string
 	TopPercentileTime string
 	TopPercentileTimeTitle string
+	TopResponseTimePercentileTime string
 	MinResponseTime string
 
 	TimeElapsed string
@@ -66,6 +72,67 @@ type RenderData struct {
 	AvgThroughputResps string
 
 	FailureMap map[string]int
+
+	Endpoints []EndpointRenderData
+
+	SearchLevels []SearchLevelRenderData
+	SearchSummary string
+
+	Phases []PhaseRenderData
+	ConnectionsReused int
+
+	Timeline TimelineRenderData
+}
+
+//TimelineRenderData holds a series per second of the test for each figure, latencies are in seconds
+type TimelineRenderData struct {
+	Sampling float64
+	RequestsSent []float64
+	Responses []float64
+	Errors []float64
+	KbPerSecond []float64
+	ErrorCategories []string
+	ErrorsByCategory [][]float64
+	Percentiles [][]float64
+
+	RequestRate string
+	ResponseRate string
+	ErrorRate string
+	KbRate string
+	TopPercentileTime string
+	Window string
+}
+
+type PhaseRenderData struct {
+	Name string
+	Percentiles []float64
+	MaxTime string
+	SampledLatencies []float64
+	LatencySampling float64
+}
+
+type SearchLevelRenderData struct {
+	Rate string
+	Result string
+	Requests int
+	Harvest string
+	Yield string
+	Throughput string
+	MeanResponseTime string
+	MaxResponseTime string
+	Failure string
+}
+
+type EndpointRenderData struct {
+	Label string
+	Requests int
+	Responses int
+	Failures int
+	Harvest string
+	Yield string
+	MeanResponseTime string
+	MaxResponseTime string
+	TotalPercentiles []string
 }
 
 func NewRenderHTML(reqOpts RequestOptions) *RenderHTML {
@@ -91,7 +158,7 @@ func (r *RenderHTML) Generate(stats AggregatedStats) {
 	r.Data.Latest = stats
 
 	if (r.Data.ReqOpts.IncreaseRateToFailure) {
-		r.Data.ModeDesc = "Rate is increasing until failure"
+		r.Data.ModeDesc = "Searching for the highest rate that passes"
 	} else if (r.Data.ReqOpts.ExecuteSingleRequest){
 		r.Data.ModeDesc = "A single request is being executed"
 	} else {
@@ -99,6 +166,10 @@ func (r *RenderHTML) Generate(stats AggregatedStats) {
 	}
 
 	r.Data.LatestConnectPercentiles, r.Data.LatestTotalPercentiles, r.Data.LatestResponsePercentiles = r.GeneratePercentiles(stats)
+	r.Data.LatestResponseTimePercentiles = []float64{}
+	for _, percentile := range stats.ResponseTimePercentiles {
+		r.Data.LatestResponseTimePercentiles = append(r.Data.LatestResponseTimePercentiles, percentile.Seconds())
+	}
 	r.Data.PercentileTitles = []string{}
 	for _, percentile := range r.Data.Latest.Percentiles {
 		r.Data.PercentileTitles = append(r.Data.PercentileTitles, fmt.Sprintf("%vth ",percentile * 100))
@@ -127,6 +198,9 @@ func (r *RenderHTML) Generate(stats AggregatedStats) {
 	if (len(r.Data.LatestTotalPercentiles) > 0) {
 		r.Data.TopPercentileTime = fmt.Sprintf("%.4f", r.Data.LatestTotalPercentiles[len(r.Data.LatestTotalPercentiles) - 1])
 	}
+	if (len(r.Data.LatestResponseTimePercentiles) > 0) {
+		r.Data.TopResponseTimePercentileTime = fmt.Sprintf("%.4f", r.Data.LatestResponseTimePercentiles[len(r.Data.LatestResponseTimePercentiles) - 1])
+	}
 
 	r.Data.AvgThroughputKbs = fmt.Sprintf("%.4f", r.Data.Latest.AverageByteThroughput / 1000.0)
 	r.Data.AvgThroughputResps = fmt.Sprintf("%.4f", r.Data.Latest.AverageRespThroughput)
@@ -135,14 +209,33 @@ func (r *RenderHTML) Generate(stats AggregatedStats) {
 	r.Data.TotalTime = r.Data.Latest.TotalTestDuration.String()
 	r.Data.FailureMap = make(map[string]int)
 	for _, failures := range r.Data.Latest.FailureCounts {
-		if (len(failures) > 1) {
-			r.Data.FailureMap[failures[0].Error()] = len(failures)
+		if (failures.Count > 1) {
+			r.Data.FailureMap[failures.Example.Error()] = failures.Count
 		}
 	}
 
+	r.Data.Endpoints = r.GenerateEndpoints(stats)
+	r.Data.SearchLevels = r.GenerateSearchLevels(stats)
+	r.Data.Phases = r.GeneratePhases(stats)
+	r.Data.Timeline = r.GenerateTimeline(stats)
+	r.Data.ConnectionsReused = stats.ConnectionsReused
+	r.Data.SearchSummary = stats.SearchSummary
+
 	r.Data.SampledRespThroughputs, r.Data.RespThroughPutSampling = r.SampleData(r.Data.Latest.RespThroughputs)
 	r.Data.SampledByteThroughputs, r.Data.ByteThroughPutSampling = r.SampleData(r.Data.Latest.ByteThroughputs)
 
+	targetRates := []float64{}
+	achievedRates := []float64{}
+	//The rates come from the spawner's overall stats, so there are none to chart until it has reported
+	if (r.Data.Latest.Overall.Count > 0) {
+		for _, bucket := range r.Data.Latest.Buckets {
+			targetRates = append(targetRates, bucket.TargetRate)
+			achievedRates = append(achievedRates, bucket.AchievedRate)
+		}
+	}
+	r.Data.SampledTargetRates, r.Data.RateSampling = r.SampleData(targetRates)
+	r.Data.SampledAchievedRates, _ = r.SampleData(achievedRates)
+
 	rawRespondTimesSecs := []float64{}
 	for _, latency := range r.Data.Latest.TimeToRespond {
 		rawRespondTimesSecs = append(rawRespondTimesSecs, latency / 1000 / 1000 / 1000)
@@ -157,6 +250,124 @@ func (r *RenderHTML) Generate(stats AggregatedStats) {
 
 }
 
+func (r *RenderHTML) GenerateEndpoints(stats AggregatedStats) (endpoints []EndpointRenderData) {
+	for _, endpoint := range stats.Endpoints {
+		endpointData := EndpointRenderData{
+			Label : endpoint.Label,
+			Requests : endpoint.TotalRequests,
+			Responses : endpoint.TotalResponses,
+			Failures : endpoint.Failures,
+			Harvest : fmt.Sprintf("%.2f", endpoint.Harvest),
+			Yield : fmt.Sprintf("%.2f", endpoint.Yield),
+			MeanResponseTime : fmt.Sprintf("%.4f", endpoint.MeanTotalTime.Seconds()),
+			MaxResponseTime : fmt.Sprintf("%.4f", endpoint.MaxTotalTime.Seconds()),
+		}
+		for _, percentile := range endpoint.TotalTimePercentiles {
+			endpointData.TotalPercentiles = append(endpointData.TotalPercentiles, fmt.Sprintf("%.4f", percentile.Seconds()))
+		}
+		endpoints = append(endpoints, endpointData)
+	}
+	return endpoints
+}
+
+func (r *RenderHTML) GeneratePhases(stats AggregatedStats) (phases []PhaseRenderData) {
+	for _, phase := range stats.Phases {
+		phaseData := PhaseRenderData{
+			Name : phase.Name,
+			MaxTime : fmt.Sprintf("%.4f", phase.Max.Seconds()),
+		}
+		for _, percentile := range phase.Percentiles {
+			phaseData.Percentiles = append(phaseData.Percentiles, percentile.Seconds())
+		}
+
+		latenciesSecs := []float64{}
+		for _, latency := range phase.Latencies {
+			latenciesSecs = append(latenciesSecs, latency / 1000 / 1000 / 1000)
+		}
+		phaseData.SampledLatencies, phaseData.LatencySampling = r.SampleData(latenciesSecs)
+
+		phases = append(phases, phaseData)
+	}
+	return phases
+}
+
+func (r *RenderHTML) GenerateSearchLevels(stats AggregatedStats) (levels []SearchLevelRenderData) {
+	for _, level := range stats.SearchLevels {
+		result := "Passed"
+		if (!level.Passed) {
+			result = "Failed"
+		}
+		levels = append(levels, SearchLevelRenderData{
+			Rate : fmt.Sprintf("%.2f", level.Rate),
+			Result : result,
+			Requests : level.Stats.TotalRequests,
+			Harvest : fmt.Sprintf("%.2f", level.Stats.Harvest),
+			Yield : fmt.Sprintf("%.2f", level.Stats.Yield),
+			Throughput : fmt.Sprintf("%.2f", level.Stats.AverageRespThroughput),
+			MeanResponseTime : fmt.Sprintf("%.4f", level.Stats.MeanResponseTime.Seconds()),
+			MaxResponseTime : fmt.Sprintf("%.4f", level.Stats.MaxResponseTime.Seconds()),
+			Failure : level.FailureDescription,
+		})
+	}
+	return levels
+}
+
+func (r *RenderHTML) GenerateTimeline(stats AggregatedStats) (timeline TimelineRenderData) {
+	requestsSent, responses, errors, kbPerSecond := []float64{}, []float64{}, []float64{}, []float64{}
+	categories := []string{}
+	for _, bucket := range stats.Buckets {
+		requestsSent = append(requestsSent, float64(bucket.RequestsSent))
+		responses = append(responses, float64(bucket.Responses))
+		errors = append(errors, float64(bucket.Errors))
+		kbPerSecond = append(kbPerSecond, float64(bucket.ResponseBytes) / 1024)
+		for category := range bucket.ErrorsByCategory {
+			if (!containsString(categories, category)) {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+
+	timeline.RequestsSent, timeline.Sampling = r.SampleData(requestsSent)
+	timeline.Responses, _ = r.SampleData(responses)
+	timeline.Errors, _ = r.SampleData(errors)
+	timeline.KbPerSecond, _ = r.SampleData(kbPerSecond)
+
+	timeline.ErrorCategories = categories
+	for _, category := range categories {
+		categoryErrors := []float64{}
+		for _, bucket := range stats.Buckets {
+			categoryErrors = append(categoryErrors, float64(bucket.ErrorsByCategory[category]))
+		}
+		sampledErrors, _ := r.SampleData(categoryErrors)
+		timeline.ErrorsByCategory = append(timeline.ErrorsByCategory, sampledErrors)
+	}
+
+	for index := range stats.Percentiles {
+		percentileTimes := []float64{}
+		for _, bucket := range stats.Buckets {
+			percentileTime := 0.0
+			if (index < len(bucket.Percentiles)) {
+				percentileTime = bucket.Percentiles[index].Seconds()
+			}
+			percentileTimes = append(percentileTimes, percentileTime)
+		}
+		sampledTimes, _ := r.SampleData(percentileTimes)
+		timeline.Percentiles = append(timeline.Percentiles, sampledTimes)
+	}
+
+	rolling := stats.Rolling
+	timeline.Window = rolling.Window.Truncate(time.Second).String()
+	timeline.RequestRate = fmt.Sprintf("%.2f", rolling.RequestRate)
+	timeline.ResponseRate = fmt.Sprintf("%.2f", rolling.ResponseRate)
+	timeline.ErrorRate = fmt.Sprintf("%.2f", rolling.ErrorRate)
+	timeline.KbRate = fmt.Sprintf("%.2f", rolling.ByteRate / 1024)
+	if (len(rolling.Percentiles) > 0) {
+		timeline.TopPercentileTime = fmt.Sprintf("%.4f", rolling.Percentiles[len(rolling.Percentiles) - 1].Seconds())
+	}
+	return timeline
+}
+
 const MAX_DATA_SIZE = 250.0
 
 func (r *RenderHTML) SampleData(data []float64) (sampledData []float64, sampling float64) {
@@ -196,29 +407,9 @@ func (r *RenderHTML) GeneratePercentiles(stats AggregatedStats) (connectOutput,
 	return connectOutput, totalOutput, responseOutput
 }
 
+//Render has nothing to do, the socket server sends the latest data to the dashboard every DataSendFrequency
+//and the static report is written once the test has finished by RenderReport
 func (r *RenderHTML) Render() {
-//	htmlTempl := template.New("testResults")
-//	templateBytes, err := ioutil.ReadFile("./lib/static/template.html")
-//	if (err != nil) {
-//		fmt.Printf("err %v \n",err)
-//	}
-//	htmlTempl.Parse(string(templateBytes))
-//
-//	buf := bytes.NewBufferString("")
-//	err = htmlTempl.ExecuteTemplate(buf, "testResults", r.Data)
-//	if (err != nil) {
-//		fmt.Printf("err %v \n",err)
-//	}
-//
-//	outputBytes, err := ioutil.ReadAll(buf)
-//	if (err != nil) {
-//		fmt.Printf("err %v \n",err)
-//	}
-//
-//	ioutil.WriteFile("./output.html", outputBytes, 0644)
-//
-//
-//	Log("reporter","HTML output rendered")
 }
 
 func (re *RenderHTML)frontendClient (so socketio.Socket) {
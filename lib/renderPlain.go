@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const plainProgressFrequency = time.Second * 5
+
+//RenderPlain prints a line of progress every plainProgressFrequency and a summary when the test finishes,
+//for running headless in CI where there's no terminal to draw on and no browser to serve
+type RenderPlain struct {
+	ReqOpts RequestOptions
+	Done chan bool
+	Output io.Writer
+
+	Latest AggregatedStats
+	LastPrinted time.Time
+	LastLine string
+}
+
+func NewRenderPlain(reqOpts RequestOptions) *RenderPlain {
+	return &RenderPlain{
+		ReqOpts : reqOpts,
+		Output : os.Stdout,
+	}
+}
+
+func (r *RenderPlain) Setup(done chan bool) {
+	r.Done = done
+}
+
+func (r *RenderPlain) Generate(stats AggregatedStats) {
+	r.Latest = stats
+}
+
+func (r *RenderPlain) Render() {
+	if (r.Latest.TotalRequests == 0 || time.Since(r.LastPrinted) < plainProgressFrequency) {
+		return
+	}
+	r.print(r.Progress(r.Latest))
+}
+
+func (r *RenderPlain) Quit() {
+	if (r.Progress(r.Latest) != r.LastLine) {
+		r.print(r.Progress(r.Latest))
+	}
+	fmt.Fprintln(r.Output, r.Summary(r.Latest))
+}
+
+func (r *RenderPlain) print(line string) {
+	r.LastPrinted = time.Now()
+	r.LastLine = line
+	fmt.Fprintln(r.Output, line)
+}
+
+//Progress is a single line of the latest figures
+func (r *RenderPlain) Progress(stats AggregatedStats) string {
+	progress := fmt.Sprintf("[%v] %v requests issued, %v responses, %v failures, %.2f resp/s, harvest %.2f%%, yield %.2f%%",
+		stats.TimeElapsed.Truncate(time.Second), stats.TotalRequests, stats.TotalResponses, stats.Failures, stats.LatestRespThroughput, stats.Harvest, stats.Yield)
+	if (len(stats.Percentiles) > 0 && len(stats.TotalTimePercentiles) == len(stats.Percentiles)) {
+		progress += fmt.Sprintf(", p%v %v", stats.Percentiles[len(stats.Percentiles) - 1] * 100, stats.TotalTimePercentiles[len(stats.TotalTimePercentiles) - 1])
+	}
+	if (stats.SearchSummary != "") {
+		progress += fmt.Sprintf(", %v search levels run", len(stats.SearchLevels))
+	}
+	return progress
+}
+
+//Summary is the verdict of the test against its thresholds, or the table of levels for a capacity search
+func (r *RenderPlain) Summary(stats AggregatedStats) string {
+	if (stats.SearchSummary != "") {
+		return SearchReport(stats.SearchLevels, stats.SearchSummary)
+	}
+	if (stats.TotalRequests == 0) {
+		return "FAILED: No requests were analysed"
+	}
+	if (stats.OverallFailure) {
+		return fmt.Sprintf("FAILED: %v", stats.OverallFailureDescription)
+	}
+	return fmt.Sprintf("PASSED: harvest %.2f%%, yield %.2f%%, %.2f resp/s", stats.Harvest, stats.Yield, stats.AverageRespThroughput)
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"bytes"
+	"strings"
+)
+
+func TestRenderPlain(t *testing.T) {
+	c.Convey("With a plain renderer writing to a buffer", t, func(){
+		output := bytes.NewBuffer([]byte{})
+		renderer := NewRenderPlain(DefaultRequestOptions)
+		renderer.Output = output
+
+		c.Convey("Quitting prints the final progress once followed by the verdict", func(){
+			renderer.Generate(AggregatedStats{TotalRequests : 10, TotalResponses : 10, TotalValidResponses : 10, Harvest : 100, Yield : 100})
+			renderer.Render()
+			renderer.Quit()
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			c.So(len(lines), c.ShouldEqual, 2)
+			c.So(lines[0], c.ShouldContainSubstring, "10 requests issued")
+			c.So(lines[1], c.ShouldStartWith, "PASSED")
+		})
+
+		c.Convey("A threshold breach is reported as a failure", func(){
+			renderer.Generate(AggregatedStats{TotalRequests : 10, OverallFailure : true, OverallFailureDescription : "Harvest of 0 is below expected harvest of 85"})
+			renderer.Quit()
+			c.So(output.String(), c.ShouldContainSubstring, "FAILED: Harvest of 0 is below expected harvest of 85")
+		})
+
+		c.Convey("A capacity search ends with the table of its levels and the summary", func(){
+			renderer.Generate(AggregatedStats{
+				TotalRequests : 10,
+				SearchLevels : []SearchLevel{{Rate : 100, Passed : true}, {Rate : 200, FailureDescription : "Harvest of 50 is below expected harvest of 85"}},
+				SearchSummary : "This service sustains 100.00 req/s",
+			})
+			renderer.Quit()
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			c.So(len(lines), c.ShouldEqual, 5)
+			c.So(lines[1], c.ShouldStartWith, "Rate")
+			c.So(lines[2], c.ShouldStartWith, "100.00  passed")
+			c.So(lines[3], c.ShouldContainSubstring, "Harvest of 50 is below expected harvest of 85")
+			c.So(lines[4], c.ShouldEqual, "This service sustains 100.00 req/s")
+		})
+	})
+}
@@ -0,0 +1,343 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//The line formats RenderPush can send metrics in
+const (
+	StatsDFormat = "statsd"
+	GraphiteFormat = "graphite"
+	InfluxFormat = "influx"
+)
+
+//pushTimeout is how long a push waits to connect to the metrics sink, and then to write to it, before the push is skipped
+const pushTimeout = time.Second * 5
+
+//PushMetric is a single named figure of the latest stats
+type PushMetric struct {
+	Name string
+	Value float64
+}
+
+//PushFormat turns the metrics pushed at a time into lines of a protocol, tags are sent with every metric
+type PushFormat interface {
+	Lines(prefix string, metrics []PushMetric, tags map[string]string, at time.Time) []string
+}
+
+//RenderPush sends the figures of the rolling window to a StatsD, Graphite or InfluxDB listener every Interval,
+//for environments where metrics are pushed rather than scraped.
+//The lines are sent from a goroutine of their own so a slow sink never holds up the reporter, and with it the analyser.
+type RenderPush struct {
+	Done chan bool
+
+	Network string
+	Address string
+	Format PushFormat
+	Prefix string
+	Tags map[string]string
+	Interval time.Duration
+	//Timeout bounds connecting and writing each push, and how long Quit waits for the final one
+	Timeout time.Duration
+
+	Latest AggregatedStats
+	LastPushed time.Time
+
+	//pending holds the latest lines waiting to be sent, lines a slow sink hasn't taken yet are replaced by newer ones
+	pending chan []string
+	quit chan bool
+	sending sync.WaitGroup
+
+	conn net.Conn
+}
+
+func NewRenderPush(outOpts OutputOptions) *RenderPush {
+	network, address, _ := ParsePushAddress(outOpts.PushAddress)
+	format, _ := NewPushFormat(outOpts.PushFormat)
+	renderer := &RenderPush{
+		Network : network,
+		Address : address,
+		Format : format,
+		Prefix : outOpts.PushPrefix,
+		Tags : outOpts.PushTags,
+		Interval : outOpts.PushInterval,
+		Timeout : pushTimeout,
+		pending : make(chan []string, 1),
+		quit : make(chan bool),
+	}
+	renderer.Start()
+	return renderer
+}
+
+//ParsePushAddress splits an address like udp://localhost:8125 into its network and host
+func ParsePushAddress(rawAddress string) (network string, address string, err error) {
+	pushURL, err := url.Parse(rawAddress)
+	if (err != nil || (pushURL.Scheme != "udp" && pushURL.Scheme != "tcp") || pushURL.Host == "") {
+		return "", "", errors.New(fmt.Sprintf("Unknown push address '%v', expected udp://host:port or tcp://host:port", rawAddress))
+	}
+	return pushURL.Scheme, pushURL.Host, nil
+}
+
+func NewPushFormat(name string) (format PushFormat, err error) {
+	switch name {
+	case StatsDFormat:
+		return StatsDPushFormat{}, nil
+	case GraphiteFormat:
+		return GraphitePushFormat{}, nil
+	case InfluxFormat:
+		return InfluxPushFormat{}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown push format '%v', expected '%v', '%v' or '%v'", name, StatsDFormat, GraphiteFormat, InfluxFormat))
+}
+
+//ParsePushTags reads tags written as name=value,name=value
+func ParsePushTags(rawTags string) (tags map[string]string, err error) {
+	tags = make(map[string]string)
+	for _, rawTag := range strings.Split(rawTags, ",") {
+		if (rawTag == "") { continue }
+		tag := strings.SplitN(rawTag, "=", 2)
+		if (len(tag) != 2 || tag[0] == "" || tag[1] == "") {
+			return tags, errors.New(fmt.Sprintf("There was an error parsing push tag '%v', expected name=value", rawTag))
+		}
+		tags[tag[0]] = tag[1]
+	}
+	return tags, nil
+}
+
+func (r *RenderPush) Setup(done chan bool) {
+	r.Done = done
+}
+
+//Start sends the lines handed over by Push until Quit, then sends any that are still pending and closes the connection
+func (r *RenderPush) Start() {
+	r.sending.Add(1)
+	go func() {
+		defer r.sending.Done()
+		for {
+			select {
+			case lines := <- r.pending:
+				r.sendOrLog(lines)
+			case <- r.quit:
+				select {
+				case lines := <- r.pending:
+					r.sendOrLog(lines)
+				default:
+				}
+				if (r.conn != nil) {
+					r.conn.Close()
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (r *RenderPush) Generate(stats AggregatedStats) {
+	r.Latest = stats
+}
+
+func (r *RenderPush) Render() {
+	if (r.Latest.TotalRequests == 0 || time.Since(r.LastPushed) < r.Interval) {
+		return
+	}
+	r.Push(time.Now())
+}
+
+//Quit pushes the final stats, so the last partial interval isn't lost, waiting no longer than Timeout for them to be sent
+func (r *RenderPush) Quit() {
+	if (r.Latest.TotalRequests > 0) {
+		r.Push(time.Now())
+	}
+	close(r.quit)
+
+	sent := make(chan bool)
+	go func() {
+		r.sending.Wait()
+		close(sent)
+	}()
+	select {
+	case <- sent:
+	case <- time.After(r.Timeout):
+		Log("reporter", fmt.Sprintln("Gave up waiting for the final metrics to be pushed to ", r.Address))
+	}
+}
+
+//Push hands the lines of the latest stats to be sent, replacing any that haven't been sent yet as they're out of date
+func (r *RenderPush) Push(at time.Time) {
+	r.LastPushed = at
+	lines := r.Format.Lines(r.Prefix, PushMetrics(r.Latest), r.Tags, at)
+	select {
+	case <- r.pending:
+	default:
+	}
+	r.pending <- lines
+}
+
+//sendOrLog sends the lines, a failed push is logged and the connection redialled next time
+func (r *RenderPush) sendOrLog(lines []string) {
+	err := r.send(lines)
+	if (err != nil) {
+		Log("reporter", fmt.Sprintln("Could not push metrics to ", r.Address, ", err: ", err))
+		if (r.conn != nil) {
+			r.conn.Close()
+			r.conn = nil
+		}
+	}
+}
+
+//send writes a datagram for each line over UDP, so none are too large to arrive, and all the lines at once over TCP
+func (r *RenderPush) send(lines []string) (err error) {
+	if (r.conn == nil) {
+		r.conn, err = net.DialTimeout(r.Network, r.Address, r.Timeout)
+		if (err != nil) {
+			return err
+		}
+	}
+	err = r.conn.SetWriteDeadline(time.Now().Add(r.Timeout))
+	if (err != nil) {
+		return err
+	}
+
+	if (r.Network == "udp") {
+		for _, line := range lines {
+			_, err = r.conn.Write([]byte(line + "\n"))
+			if (err != nil) {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err = r.conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	return err
+}
+
+//PushMetrics picks out the figures of the rolling window along with the totals, rates and executors of the test so far.
+//Latencies are in milliseconds.
+func PushMetrics(stats AggregatedStats) (metrics []PushMetric) {
+	rolling := stats.Rolling
+	metrics = append(metrics,
+		PushMetric{Name : "requests_per_second", Value : rolling.RequestRate},
+		PushMetric{Name : "responses_per_second", Value : rolling.ResponseRate},
+		PushMetric{Name : "errors_per_second", Value : rolling.ErrorRate},
+		PushMetric{Name : "bytes_per_second", Value : rolling.ByteRate},
+		PushMetric{Name : "latency_mean_ms", Value : milliseconds(rolling.MeanTime)},
+		PushMetric{Name : "latency_max_ms", Value : milliseconds(rolling.MaxTime)},
+	)
+	for index, percentile := range stats.Percentiles {
+		if (index < len(rolling.Percentiles)) {
+			metrics = append(metrics, PushMetric{Name : "latency_" + percentileMetricName(percentile) + "_ms", Value : milliseconds(rolling.Percentiles[index])})
+		}
+	}
+
+	categories := []string{}
+	for category := range rolling.ErrorsByCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		metrics = append(metrics, PushMetric{Name : "errors." + strings.ToLower(category), Value : float64(rolling.ErrorsByCategory[category])})
+	}
+
+	metrics = append(metrics,
+		PushMetric{Name : "requests_total", Value : float64(stats.TotalRequests)},
+		PushMetric{Name : "responses_total", Value : float64(stats.TotalResponses)},
+		PushMetric{Name : "failures_total", Value : float64(stats.Failures)},
+		PushMetric{Name : "harvest", Value : stats.Harvest},
+		PushMetric{Name : "yield", Value : stats.Yield},
+	)
+
+	if (stats.Overall.Count > 0) {
+		overall := stats.Overall.Latest
+		metrics = append(metrics,
+			PushMetric{Name : "target_rate", Value : overall.TargetRate},
+			PushMetric{Name : "achieved_rate", Value : overall.AchievedRate},
+			PushMetric{Name : "executors_busy", Value : float64(overall.NumBusyExecutors)},
+			PushMetric{Name : "executors_available", Value : float64(overall.NumAvailableExecutors)},
+		)
+	}
+
+	//None of the protocols accept NaN or infinite values
+	finiteMetrics := []PushMetric{}
+	for _, metric := range metrics {
+		if (!math.IsNaN(metric.Value) && !math.IsInf(metric.Value, 0)) {
+			finiteMetrics = append(finiteMetrics, metric)
+		}
+	}
+	return finiteMetrics
+}
+
+//percentileMetricName turns a percentile like 0.999 into p99_9
+func percentileMetricName(percentile float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(math.Round(percentile * 1000000) / 10000, 'f', -1, 64), ".", "_", -1)
+}
+
+func formatPushValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func sortedTagNames(tags map[string]string) (names []string) {
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//StatsDPushFormat sends every metric as a gauge, as they're already aggregated, with tags in the DogStatsD style
+type StatsDPushFormat struct {}
+
+func (f StatsDPushFormat) Lines(prefix string, metrics []PushMetric, tags map[string]string, at time.Time) (lines []string) {
+	tagSuffix := ""
+	if (len(tags) > 0) {
+		tagPairs := []string{}
+		for _, name := range sortedTagNames(tags) {
+			tagPairs = append(tagPairs, name + ":" + tags[name])
+		}
+		tagSuffix = "|#" + strings.Join(tagPairs, ",")
+	}
+	for _, metric := range metrics {
+		lines = append(lines, fmt.Sprintf("%v.%v:%v|g%v", prefix, metric.Name, formatPushValue(metric.Value), tagSuffix))
+	}
+	return lines
+}
+
+//GraphitePushFormat sends the plaintext protocol, with tags in the name as Graphite 1.1 expects
+type GraphitePushFormat struct {}
+
+func (f GraphitePushFormat) Lines(prefix string, metrics []PushMetric, tags map[string]string, at time.Time) (lines []string) {
+	tagSuffix := ""
+	for _, name := range sortedTagNames(tags) {
+		tagSuffix += ";" + name + "=" + tags[name]
+	}
+	for _, metric := range metrics {
+		lines = append(lines, fmt.Sprintf("%v.%v%v %v %v", prefix, metric.Name, tagSuffix, formatPushValue(metric.Value), at.Unix()))
+	}
+	return lines
+}
+
+//InfluxPushFormat sends a single line protocol point with a field for each metric, measured as the prefix
+type InfluxPushFormat struct {}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func (f InfluxPushFormat) Lines(prefix string, metrics []PushMetric, tags map[string]string, at time.Time) (lines []string) {
+	line := influxEscaper.Replace(prefix)
+	for _, name := range sortedTagNames(tags) {
+		line += "," + influxEscaper.Replace(name) + "=" + influxEscaper.Replace(tags[name])
+	}
+	fields := []string{}
+	for _, metric := range metrics {
+		fields = append(fields, influxEscaper.Replace(metric.Name) + "=" + formatPushValue(metric.Value))
+	}
+	line += " " + strings.Join(fields, ",") + " " + strconv.FormatInt(at.UnixNano(), 10)
+	return []string{line}
+}
@@ -0,0 +1,179 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"bufio"
+	"net"
+	"strings"
+	"time"
+)
+
+func TestRenderPush(t *testing.T) {
+	stats := AggregatedStats{
+		TotalRequests : 120,
+		TotalResponses : 118,
+		Failures : 2,
+		Harvest : 98.3,
+		Yield : 100,
+		Percentiles : []float64{0.5, 0.999},
+		Rolling : RollingStats{
+			RequestRate : 12,
+			ResponseRate : 11.8,
+			ErrorRate : 0.2,
+			Percentiles : []time.Duration{time.Millisecond * 20, time.Microsecond * 95500},
+			ErrorsByCategory : map[string]int{"StatusCode" : 2},
+		},
+		Overall : OverallSummary{Count : 1, Latest : OverallStats{TargetRate : 12, AchievedRate : 11.9, NumBusyExecutors : 3, NumAvailableExecutors : 7}},
+	}
+	tags := map[string]string{"test" : "checkout", "env" : "staging"}
+	at := time.Unix(1500000000, 0)
+
+	c.Convey("The latest stats are picked out as metrics with latencies in milliseconds", t, func(){
+		metrics := PushMetrics(stats)
+		c.So(metrics[0], c.ShouldResemble, PushMetric{Name : "requests_per_second", Value : 12})
+		c.So(metrics, c.ShouldContain, PushMetric{Name : "latency_p99_9_ms", Value : 95.5})
+		c.So(metrics, c.ShouldContain, PushMetric{Name : "errors.statuscode", Value : 2})
+		c.So(metrics, c.ShouldContain, PushMetric{Name : "executors_busy", Value : 3})
+	})
+
+	c.Convey("Each format writes the tags with every metric", t, func(){
+		metrics := []PushMetric{{Name : "requests_per_second", Value : 12}, {Name : "latency_p50_ms", Value : 20}}
+
+		c.So(StatsDPushFormat{}.Lines("deathstar", metrics, tags, at), c.ShouldResemble, []string{
+			"deathstar.requests_per_second:12|g|#env:staging,test:checkout",
+			"deathstar.latency_p50_ms:20|g|#env:staging,test:checkout",
+		})
+		c.So(GraphitePushFormat{}.Lines("deathstar", metrics, tags, at), c.ShouldResemble, []string{
+			"deathstar.requests_per_second;env=staging;test=checkout 12 1500000000",
+			"deathstar.latency_p50_ms;env=staging;test=checkout 20 1500000000",
+		})
+		c.So(InfluxPushFormat{}.Lines("deathstar", metrics, map[string]string{"test" : "check out"}, at), c.ShouldResemble, []string{
+			`deathstar,test=check\ out requests_per_second=12,latency_p50_ms=20 1500000000000000000`,
+		})
+	})
+
+	c.Convey("Metrics are pushed to a StatsD listener over UDP", t, func(){
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		c.So(err, c.ShouldBeNil)
+		defer listener.Close()
+
+		renderer := NewRenderPush(OutputOptions{
+			PushAddress : "udp://" + listener.LocalAddr().String(),
+			PushFormat : StatsDFormat,
+			PushPrefix : "deathstar",
+			PushTags : tags,
+			PushInterval : time.Hour,
+		})
+		defer renderer.Quit()
+		renderer.Generate(stats)
+		renderer.Render()
+		renderer.Render()
+
+		received := []string{}
+		buf := make([]byte, 1500)
+		listener.SetReadDeadline(time.Now().Add(time.Millisecond * 300))
+		for {
+			n, _, err := listener.ReadFrom(buf)
+			if (err != nil) {
+				break
+			}
+			received = append(received, string(buf[:n]))
+		}
+		c.So(len(received), c.ShouldEqual, len(PushMetrics(stats)))
+		c.So(received[0], c.ShouldEqual, "deathstar.requests_per_second:12|g|#env:staging,test:checkout\n")
+	})
+
+	c.Convey("Metrics are pushed to a Graphite listener over TCP when the test finishes", t, func(){
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, c.ShouldBeNil)
+		defer listener.Close()
+
+		lines := make(chan string, 100)
+		go func() {
+			conn, err := listener.Accept()
+			if (err != nil) {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+
+		renderer := NewRenderPush(OutputOptions{
+			PushAddress : "tcp://" + listener.Addr().String(),
+			PushFormat : GraphiteFormat,
+			PushPrefix : "loadtest",
+			PushInterval : time.Hour,
+		})
+		renderer.Generate(stats)
+		renderer.Quit()
+
+		received := []string{}
+		for line := range lines {
+			received = append(received, line)
+		}
+		c.So(len(received), c.ShouldEqual, len(PushMetrics(stats)))
+		c.So(strings.HasPrefix(received[0], "loadtest.requests_per_second 12 "), c.ShouldBeTrue)
+	})
+
+	c.Convey("A sink that never reads holds up neither rendering nor quitting", t, func(){
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, c.ShouldBeNil)
+		defer listener.Close()
+
+		accepted := make(chan net.Conn, 10)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if (err != nil) {
+					return
+				}
+				conn.(*net.TCPConn).SetReadBuffer(1024)
+				accepted <- conn
+			}
+		}()
+		defer func() {
+			for {
+				select {
+				case conn := <- accepted:
+					conn.Close()
+				default:
+					return
+				}
+			}
+		}()
+
+		//Every line is far larger than the socket buffers, so a write blocks until its deadline
+		renderer := NewRenderPush(OutputOptions{
+			PushAddress : "tcp://" + listener.Addr().String(),
+			PushFormat : GraphiteFormat,
+			PushPrefix : strings.Repeat("slow", 1024 * 128),
+		})
+		renderer.Timeout = time.Second
+		renderer.Generate(stats)
+
+		started := time.Now()
+		renderer.Render()
+		renderer.Render()
+		c.So(time.Since(started), c.ShouldBeLessThan, renderer.Timeout)
+
+		started = time.Now()
+		renderer.Quit()
+		c.So(time.Since(started), c.ShouldBeLessThan, renderer.Timeout + time.Millisecond * 500)
+	})
+
+	c.Convey("Push options are checked", t, func(){
+		_, _, err := ParsePushAddress("localhost:8125")
+		c.So(err, c.ShouldNotBeNil)
+		_, err = NewPushFormat("carbon")
+		c.So(err, c.ShouldNotBeNil)
+		_, err = ParsePushTags("test=checkout,env")
+		c.So(err, c.ShouldNotBeNil)
+		parsed, err := ParsePushTags("test=checkout,env=staging")
+		c.So(err, c.ShouldBeNil)
+		c.So(parsed, c.ShouldResemble, tags)
+	})
+}
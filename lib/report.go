@@ -0,0 +1,363 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+//ReportVersion is bumped whenever a field of the report is renamed, removed or changes meaning, adding fields doesn't change it
+const ReportVersion = 1
+
+//Report is the document written by -out when the test finishes, a stable view of the final AggregatedStats for CI.
+//Durations are in milliseconds, and raw response stats are never included.
+type Report struct {
+	Version int `json:"version"`
+	GeneratedAt time.Time `json:"generatedAt"`
+
+	Options ReportOptions `json:"options"`
+	Verdict ReportVerdict `json:"verdict"`
+
+	StartTime time.Time `json:"startTime"`
+	ElapsedMs float64 `json:"elapsedMs"`
+	TotalDurationMs float64 `json:"totalDurationMs"`
+
+	Requests ReportRequests `json:"requests"`
+	Throughput ReportThroughput `json:"throughput"`
+
+	Latency ReportLatency `json:"latency"`
+	Phases []ReportPhase `json:"phases"`
+	ConnectionsReused int `json:"connectionsReused"`
+
+	Failures []ReportFailure `json:"failures"`
+	Endpoints []ReportEndpoint `json:"endpoints"`
+	Search *ReportSearch `json:"search,omitempty"`
+
+	TimeSeries []ReportBucket `json:"timeSeries"`
+}
+
+type ReportOptions struct {
+	Mode string `json:"mode"`
+	URL string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+	RequestsFile string `json:"requestsFile,omitempty"`
+	Requests []string `json:"requests"`
+
+	Rate float64 `json:"rate"`
+	Concurrency int `json:"concurrency"`
+	MaxConcurrency int `json:"maxConcurrency"`
+	Arrival string `json:"arrival"`
+	Overflow string `json:"overflow"`
+	Profile string `json:"profile,omitempty"`
+	RequestsToIssue int `json:"requestsToIssue"`
+	MaxExecutionMs float64 `json:"maxExecutionMs"`
+	WarmUpMs float64 `json:"warmUpMs"`
+	KeepAlive bool `json:"keepAlive"`
+
+	Thresholds ReportThresholds `json:"thresholds"`
+}
+
+type ReportThresholds struct {
+	Harvest float64 `json:"harvest"`
+	Yield float64 `json:"yield"`
+	Throughput float64 `json:"throughput"`
+	PercentileLatenciesMs []ReportPercentile `json:"percentileLatenciesMs"`
+}
+
+type ReportVerdict struct {
+	Passed bool `json:"passed"`
+	Failure string `json:"failure,omitempty"`
+}
+
+type ReportRequests struct {
+	Issued int `json:"issued"`
+	Responses int `json:"responses"`
+	ValidResponses int `json:"validResponses"`
+	WrongStatusResponses int `json:"wrongStatusResponses"`
+	Failures int `json:"failures"`
+	Scheduled int `json:"scheduled"`
+	Delayed int `json:"delayed"`
+	Dropped int `json:"dropped"`
+	MeanDelayMs float64 `json:"meanDelayMs"`
+	Harvest float64 `json:"harvest"`
+	Yield float64 `json:"yield"`
+}
+
+type ReportThroughput struct {
+	Rate float64 `json:"rate"`
+	TargetRate float64 `json:"targetRate"`
+	AchievedRate float64 `json:"achievedRate"`
+	MeanResponsesPerSec float64 `json:"meanResponsesPerSec"`
+	MeanBytesPerSec float64 `json:"meanBytesPerSec"`
+	LatestResponsesPerSec float64 `json:"latestResponsesPerSec"`
+	LatestBytesPerSec float64 `json:"latestBytesPerSec"`
+}
+
+//ReportLatency holds the service time (Total, from when each request was sent) and response time (from when it was meant to be sent)
+type ReportLatency struct {
+	Total ReportDistribution `json:"total"`
+	TimeToConnect ReportDistribution `json:"timeToConnect"`
+	TimeToRespond ReportDistribution `json:"timeToRespond"`
+	ResponseTime ReportDistribution `json:"responseTime"`
+}
+
+type ReportDistribution struct {
+	Percentiles []ReportPercentile `json:"percentiles"`
+	MinMs float64 `json:"minMs,omitempty"`
+	MeanMs float64 `json:"meanMs,omitempty"`
+	MaxMs float64 `json:"maxMs"`
+}
+
+type ReportPercentile struct {
+	Percentile float64 `json:"percentile"`
+	Ms float64 `json:"ms"`
+}
+
+type ReportPhase struct {
+	Name string `json:"name"`
+	Latency ReportDistribution `json:"latency"`
+}
+
+type ReportFailure struct {
+	Description string `json:"description"`
+	Category string `json:"category"`
+	Count int `json:"count"`
+}
+
+type ReportEndpoint struct {
+	Label string `json:"label"`
+	Requests int `json:"requests"`
+	Responses int `json:"responses"`
+	ValidResponses int `json:"validResponses"`
+	Failures int `json:"failures"`
+	Harvest float64 `json:"harvest"`
+	Yield float64 `json:"yield"`
+	Latency ReportDistribution `json:"latency"`
+	ResponseTime ReportDistribution `json:"responseTime"`
+}
+
+type ReportSearch struct {
+	Summary string `json:"summary"`
+	Levels []ReportSearchLevel `json:"levels"`
+}
+
+type ReportSearchLevel struct {
+	Rate float64 `json:"rate"`
+	Passed bool `json:"passed"`
+	Failure string `json:"failure,omitempty"`
+	Requests int `json:"requests"`
+	Harvest float64 `json:"harvest"`
+	Yield float64 `json:"yield"`
+	ResponsesPerSec float64 `json:"responsesPerSec"`
+	ResponseTime ReportDistribution `json:"responseTime"`
+}
+
+type ReportBucket struct {
+	Start time.Time `json:"start"`
+	RequestsSent int `json:"requestsSent"`
+	Responses int `json:"responses"`
+	Errors int `json:"errors"`
+	ErrorsByCategory map[string]int `json:"errorsByCategory"`
+	ResponseBytes int `json:"responseBytes"`
+	Latency ReportDistribution `json:"latency"`
+}
+
+func NewReport(stats AggregatedStats, reqOpts RequestOptions) Report {
+	report := Report{
+		Version : ReportVersion,
+		GeneratedAt : time.Now(),
+		Options : NewReportOptions(reqOpts),
+		Verdict : ReportVerdict{
+			Passed : !stats.OverallFailure,
+			Failure : stats.OverallFailureDescription,
+		},
+
+		StartTime : stats.StartTime,
+		ElapsedMs : milliseconds(stats.TimeElapsed),
+		TotalDurationMs : milliseconds(stats.TotalTestDuration),
+
+		Requests : ReportRequests{
+			Issued : stats.TotalRequests,
+			Responses : stats.TotalResponses,
+			ValidResponses : stats.TotalValidResponses,
+			WrongStatusResponses : stats.WrongStatusResponses,
+			Failures : stats.Failures,
+			Scheduled : stats.RequestsScheduled,
+			Delayed : stats.RequestsDelayed,
+			Dropped : stats.RequestsDropped,
+			MeanDelayMs : milliseconds(stats.MeanDelay),
+			Harvest : stats.Harvest,
+			Yield : stats.Yield,
+		},
+		Throughput : ReportThroughput{
+			Rate : stats.Rate,
+			TargetRate : stats.TargetRate,
+			AchievedRate : stats.AchievedRate,
+			MeanResponsesPerSec : stats.AverageRespThroughput,
+			MeanBytesPerSec : stats.AverageByteThroughput,
+			LatestResponsesPerSec : stats.LatestRespThroughput,
+			LatestBytesPerSec : stats.LatestByteThroughput,
+		},
+
+		Latency : ReportLatency{
+			Total : reportDistribution(stats.Percentiles, stats.TotalTimePercentiles, stats.MinTotalTime, stats.MeanTotalTime, stats.MaxTotalTime),
+			TimeToConnect : reportDistribution(stats.Percentiles, stats.TimeToConnectPercentiles, 0, 0, stats.MaxTimeToConnect),
+			TimeToRespond : reportDistribution(stats.Percentiles, stats.TimeToRespondPercentiles, 0, 0, stats.MaxTimeToRespond),
+			ResponseTime : reportDistribution(stats.Percentiles, stats.ResponseTimePercentiles, 0, stats.MeanResponseTime, stats.MaxResponseTime),
+		},
+		ConnectionsReused : stats.ConnectionsReused,
+
+		Phases : []ReportPhase{},
+		Failures : []ReportFailure{},
+		Endpoints : []ReportEndpoint{},
+		TimeSeries : []ReportBucket{},
+	}
+
+	for _, phase := range stats.Phases {
+		report.Phases = append(report.Phases, ReportPhase{
+			Name : phase.Name,
+			Latency : reportDistribution(stats.Percentiles, phase.Percentiles, 0, 0, phase.Max),
+		})
+	}
+
+	for _, failureCount := range stats.FailureCounts {
+		report.Failures = append(report.Failures, ReportFailure{
+			Description : failureCount.Example.Description(),
+			Category : failureCount.Example.Category(),
+			Count : failureCount.Count,
+		})
+	}
+	sort.Slice(report.Failures, func(i, j int) bool {
+		if (report.Failures[i].Count != report.Failures[j].Count) {
+			return report.Failures[i].Count > report.Failures[j].Count
+		}
+		return report.Failures[i].Description < report.Failures[j].Description
+	})
+
+	for _, endpoint := range stats.Endpoints {
+		report.Endpoints = append(report.Endpoints, ReportEndpoint{
+			Label : endpoint.Label,
+			Requests : endpoint.TotalRequests,
+			Responses : endpoint.TotalResponses,
+			ValidResponses : endpoint.TotalValidResponses,
+			Failures : endpoint.Failures,
+			Harvest : endpoint.Harvest,
+			Yield : endpoint.Yield,
+			Latency : reportDistribution(stats.Percentiles, endpoint.TotalTimePercentiles, endpoint.MinTotalTime, endpoint.MeanTotalTime, endpoint.MaxTotalTime),
+			ResponseTime : reportDistribution(stats.Percentiles, endpoint.ResponseTimePercentiles, 0, 0, endpoint.MaxResponseTime),
+		})
+	}
+
+	if (stats.SearchSummary != "") {
+		report.Search = &ReportSearch{
+			Summary : stats.SearchSummary,
+			Levels : []ReportSearchLevel{},
+		}
+		for _, level := range stats.SearchLevels {
+			report.Search.Levels = append(report.Search.Levels, ReportSearchLevel{
+				Rate : level.Rate,
+				Passed : level.Passed,
+				Failure : level.FailureDescription,
+				Requests : level.Stats.TotalRequests,
+				Harvest : level.Stats.Harvest,
+				Yield : level.Stats.Yield,
+				ResponsesPerSec : level.Stats.AverageRespThroughput,
+				ResponseTime : reportDistribution(level.Stats.Percentiles, level.Stats.ResponseTimePercentiles, 0, level.Stats.MeanResponseTime, level.Stats.MaxResponseTime),
+			})
+		}
+	}
+
+	for _, bucket := range stats.Buckets {
+		report.TimeSeries = append(report.TimeSeries, ReportBucket{
+			Start : bucket.Start,
+			RequestsSent : bucket.RequestsSent,
+			Responses : bucket.Responses,
+			Errors : bucket.Errors,
+			ErrorsByCategory : bucket.ErrorsByCategory,
+			ResponseBytes : bucket.ResponseBytes,
+			Latency : reportDistribution(stats.Percentiles, bucket.Percentiles, 0, bucket.MeanTime, bucket.MaxTime),
+		})
+	}
+
+	return report
+}
+
+func NewReportOptions(reqOpts RequestOptions) ReportOptions {
+	options := ReportOptions{
+		Mode : reqOpts.Mode,
+		RequestsFile : reqOpts.RequestsFile,
+		Requests : []string{},
+
+		Rate : reqOpts.Rate,
+		Concurrency : reqOpts.Concurrency,
+		MaxConcurrency : reqOpts.MaxConcurrency,
+		Arrival : reqOpts.Arrival,
+		Overflow : reqOpts.Overflow,
+		Profile : reqOpts.ProfileSpec,
+		RequestsToIssue : reqOpts.RequestsToIssue,
+		MaxExecutionMs : milliseconds(reqOpts.MaxExecutionTime),
+		WarmUpMs : milliseconds(reqOpts.WarmUpTime),
+		KeepAlive : reqOpts.EnableKeepAlive,
+
+		Thresholds : ReportThresholds{
+			Harvest : reqOpts.Harvest,
+			Yield : reqOpts.Yield,
+			Throughput : reqOpts.Throughput,
+			PercentileLatenciesMs : []ReportPercentile{},
+		},
+	}
+	if (reqOpts.RequestsFile == "") {
+		options.URL, options.Method = reqOpts.URL, reqOpts.Method
+	}
+	for _, definition := range reqOpts.Requests {
+		options.Requests = append(options.Requests, definition.Labels()...)
+	}
+	//-percentiles latencies are in seconds
+	for index, latency := range reqOpts.PercentileLatencies {
+		if (index < len(reqOpts.Percentiles)) {
+			options.Thresholds.PercentileLatenciesMs = append(options.Thresholds.PercentileLatenciesMs, ReportPercentile{
+				Percentile : reqOpts.Percentiles[index],
+				Ms : latency * 1000,
+			})
+		}
+	}
+	return options
+}
+
+func reportDistribution(percentiles []float64, durations []time.Duration, min time.Duration, mean time.Duration, max time.Duration) ReportDistribution {
+	distribution := ReportDistribution{
+		Percentiles : []ReportPercentile{},
+		MinMs : milliseconds(min),
+		MeanMs : milliseconds(mean),
+		MaxMs : milliseconds(max),
+	}
+	for index, duration := range durations {
+		if (index < len(percentiles)) {
+			distribution.Percentiles = append(distribution.Percentiles, ReportPercentile{
+				Percentile : percentiles[index],
+				Ms : milliseconds(duration),
+			})
+		}
+	}
+	return distribution
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+//WriteReport writes the report as indented JSON to path
+func WriteReport(path string, report Report) error {
+	output, err := json.MarshalIndent(report, "", "  ")
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not encode the report, err: %v", err))
+	}
+	err = ioutil.WriteFile(path, append(output, '\n'), 0644)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Could not write the report to %v, err: %v", path, err))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	c.Convey("With the final stats of a test that kept raw samples", t, func(){
+		refused := *NewRequestExecutionError(errors.New("refused"))
+		notFound := *NewStatusCodeError(404)
+		stats := AggregatedStats{
+			RawStats : []ResponseStats{{Label : "raw", ReqPayload : "secret"}},
+			Percentiles : []float64{0.5, 0.99},
+			TotalTimePercentiles : []time.Duration{time.Millisecond * 10, time.Millisecond * 50},
+			MaxTotalTime : time.Millisecond * 80,
+			TotalRequests : 10,
+			TotalResponses : 8,
+			TotalValidResponses : 7,
+			WrongStatusResponses : 1,
+			Failures : 3,
+			FailureCounts : map[string]FailureCount{failureKey(refused) : {Count : 2, Example : refused}, failureKey(notFound) : {Count : 1, Example : notFound}},
+			OverallFailure : true,
+			OverallFailureDescription : "Harvest of 80 is below expected harvest of 85",
+			Buckets : []MetricsBucket{{RequestsSent : 10, Responses : 8, Errors : 2, Percentiles : []time.Duration{time.Millisecond * 10, time.Millisecond * 50}}},
+		}
+		reqOpts := DefaultRequestOptions
+		reqOpts.PercentileLatencies = []float64{0.1, 0.5}
+
+		report := NewReport(stats, reqOpts)
+
+		c.Convey("The report carries the verdict, latencies, failures and time series", func(){
+			c.So(report.Version, c.ShouldEqual, ReportVersion)
+			c.So(report.Verdict.Passed, c.ShouldBeFalse)
+			c.So(report.Verdict.Failure, c.ShouldEqual, stats.OverallFailureDescription)
+			c.So(report.Latency.Total.Percentiles[1], c.ShouldResemble, ReportPercentile{Percentile : 0.99, Ms : 50})
+			c.So(report.Latency.Total.MaxMs, c.ShouldEqual, 80)
+			c.So(report.Failures[0].Count, c.ShouldEqual, 2)
+			c.So(report.Failures[0].Category, c.ShouldEqual, refused.Category())
+			c.So(report.Options.Thresholds.PercentileLatenciesMs[1].Ms, c.ShouldEqual, 500)
+			c.So(len(report.TimeSeries), c.ShouldEqual, 1)
+		})
+
+		c.Convey("The written report is JSON without the raw samples", func(){
+			dir, err := ioutil.TempDir("", "report")
+			c.So(err, c.ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "report.json")
+			c.So(WriteReport(path, report), c.ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(path)
+			c.So(err, c.ShouldBeNil)
+			c.So(string(contents), c.ShouldNotContainSubstring, "secret")
+
+			written := Report{}
+			c.So(json.Unmarshal(contents, &written), c.ShouldBeNil)
+			c.So(written.Requests.Issued, c.ShouldEqual, 10)
+			c.So(written.Requests.WrongStatusResponses, c.ShouldEqual, 1)
+			c.So(written.Verdict.Passed, c.ShouldBeFalse)
+		})
+	})
+}
@@ -9,6 +9,8 @@ type Reporter struct {
 	Done chan bool
 	RenderHTML bool
 	RenderCLI bool
+	RenderPlain bool
+	RenderPush bool
 
 	mu *sync.Mutex
 	LatestData AggregatedStats
@@ -33,23 +35,37 @@ func NewReporter(dataChan chan AggregatedStats, opts OutputOptions, reqOpts Requ
 		Done : make(chan bool),
 		RenderHTML : opts.ShowHTML,
 		RenderCLI : opts.ShowCLI,
+		RenderPlain : opts.Headless,
+		RenderPush : opts.PushAddress != "",
 	}
 
-	//TODO: add support for multiple renderers at one time
 	if reporter.RenderHTML {
 		renderer := NewRenderHTML(reqOpts)
 		renderer.Setup(reporter.Done)
 		reporter.Renderers = append(reporter.Renderers, renderer)
-		reporter.Start()
 	}
 
 	if reporter.RenderCLI {
 		renderer := NewRenderCLI(reqOpts)
 		renderer.Setup(reporter.Done)
 		reporter.Renderers = append(reporter.Renderers, renderer)
-		reporter.Start()
 	}
 
+	if reporter.RenderPlain {
+		renderer := NewRenderPlain(reqOpts)
+		renderer.Setup(reporter.Done)
+		reporter.Renderers = append(reporter.Renderers, renderer)
+	}
+
+	if reporter.RenderPush {
+		renderer := NewRenderPush(opts)
+		renderer.Setup(reporter.Done)
+		reporter.Renderers = append(reporter.Renderers, renderer)
+	}
+
+	//The analyser blocks until its stats are received, so they're read even when nothing renders them
+	reporter.Start()
+
 	return reporter
 }
 
@@ -73,7 +89,11 @@ func (r *Reporter) chanSetup() {
 	}
 }
 
-func (r *Reporter) Cleanup() {
+//Cleanup renders the final stats, which are passed in rather than read from DataChan so they can't be overtaken by an earlier analysis
+func (r *Reporter) Cleanup(stats AggregatedStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.LatestData = stats
 	for _, renderer := range r.Renderers {
 		renderer.Generate(r.LatestData)
 		renderer.Render()
@@ -81,9 +101,7 @@ func (r *Reporter) Cleanup() {
 }
 
 func (r *Reporter) Stop() {
-	if (r.RenderCLI) {
-		for _, renderer := range r.Renderers {
-			renderer.Quit()
-		}
+	for _, renderer := range r.Renderers {
+		renderer.Quit()
 	}
 }
@@ -1,36 +1,71 @@
 package lib
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"time"
 	"net"
 	"bytes"
+	"math/rand"
+	"net/http/httptrace"
 	"net/http/httputil"
 )
 
 type RequestRecorder struct {
-	ConnectionTime time.Duration
-	RequestTime time.Duration
-	TotalTime time.Duration
 	RequestOptions RequestOptions
 	Client *http.Client
 	Transport *http.Transport
+	Scripts *ScriptRunner
+	Templates *TemplateRunner
+
+	//Context cancels the requests issued, when it's nil they can't be cancelled
+	Context context.Context
 }
 
 func NewRequestRecorder (reqOpts RequestOptions) *RequestRecorder {
 	recorder := &RequestRecorder{
 		RequestOptions : reqOpts,
+		Scripts : NewScriptRunner(),
+		Templates : NewTemplateRunner("", nil),
 	}
 	recorder.Client = recorder.createHttpClient()
+	recorder.Scripts.Timeout = reqOpts.Timeout
 	return recorder
 }
 
-func (r *RequestRecorder) PerformRequest() (respStats ResponseStats, err error){
+//Close releases the lua states of the recorder's scripts and closes its idle connections, the recorder can't be used after
+func (r *RequestRecorder) Close() {
+	r.Scripts.Close()
+	if (r.Transport != nil) {
+		r.Transport.CloseIdleConnections()
+	}
+}
+
+func (r *RequestRecorder) context() context.Context {
+	if (r.Context == nil) {
+		return context.Background()
+	}
+	return r.Context
+}
+
+//PerformRequest issues a single request, vars fill in any placeholders and receive any values extracted from the response
+func (r *RequestRecorder) PerformRequest(definition *RequestDefinition, vars map[string]string) (respStats ResponseStats, err error){
 
 	startTime := time.Now()
 
-	req, err := r.constructRequest()
+	req, err := r.constructRequest(definition, vars)
+	if (err != nil) {
+		failure, ok := err.(DescriptiveError)
+		if (!ok) {
+			failure = *NewRequestExecutionError(err)
+		}
+		return ResponseStats {
+			StartTime: startTime,
+			FinishTime: time.Now(),
+			Failures : []DescriptiveError{failure},
+		}, err
+	}
 
 	if (r.RequestOptions.EnableKeepAlive) {
 		req.Header.Add("Connection", "keep-alive")
@@ -38,37 +73,32 @@ func (r *RequestRecorder) PerformRequest() (respStats ResponseStats, err error){
 		req.Close = true
 	}
 
-	for headerName, headerValue := range r.RequestOptions.Headers {
-		req.Header.Add(headerName, headerValue)
-	}
+	phases := &phaseRecorder{}
+	req = req.WithContext(httptrace.WithClientTrace(r.context(), phases.trace()))
 
-	if (err != nil) {
-		return ResponseStats {
-			TimeToConnect: r.ConnectionTime,
-			TimeToRespond: r.RequestTime,
-			TotalTime: r.TotalTime,
-			StartTime: startTime,
-			FinishTime: time.Now(),
-			Failures : []DescriptiveError{*NewRequestExecutionError(err)},
-		}, err
-	}
+	//Don't count time spent in templates or scripts against the request
+	startTime = time.Now()
 
 	resp, err := r.issueRequest(req)
+	if (err == nil) {
+		err = r.readResponseBody(resp)
+	}
+	finishTime := time.Now()
+	totalTime := finishTime.Sub(startTime)
+	respPhases := phases.finish(finishTime)
+
 	if (err != nil) {
 		req.Body.Close()
 		return ResponseStats {
-			TimeToConnect: r.ConnectionTime,
-			TimeToRespond: r.RequestTime,
-			TotalTime: r.TotalTime,
+			TimeToConnect: respPhases.Connect(),
+			TimeToRespond: totalTime - respPhases.Connect(),
+			TotalTime: totalTime,
+			Phases: respPhases,
 			StartTime: startTime,
-			FinishTime: time.Now(),
+			FinishTime: finishTime,
 			Failures : []DescriptiveError{*NewRequestExecutionError(err)},
 		}, err
 	}
-	finishTime := time.Now()
-
-	r.TotalTime = time.Since(startTime)
-	r.RequestTime = r.TotalTime - r.ConnectionTime
 
 	reqBody, respBody, _ := r.isolatePayloads(req, resp)
 
@@ -79,25 +109,42 @@ func (r *RequestRecorder) PerformRequest() (respStats ResponseStats, err error){
 		failures = append(failures, respHeaderError)
 	}
 
-	statusFailure := ValidateStatusCode(r.RequestOptions.ResponseCode, resp)
+	statusFailure := ValidateStatusCode(definition.ResponseCodes, resp)
 	if (statusFailure != nil) {
 		failures = append(failures, statusFailure)
 	}
 
-	if (r.RequestOptions.JSONSchema != ""){
-		err = ValidateSchema(respBody, resp, r.RequestOptions.JSONSchema)
+	if (definition.Schema != nil && r.sampleValidation()){
+		err = ValidateSchema(respBody, resp, definition.Schema)
 		if (err != nil) {
 			descriptiveErr, _ := err.(DescriptiveError)
 			failures = append(failures, descriptiveErr)
 		}
 	}
 
+	if (!definition.Assert.Empty()) {
+		failures = append(failures, definition.Assert.Check(respBody, resp, totalTime)...)
+	}
+
+	if (len(definition.Extract) > 0) {
+		failures = append(failures, ExtractValues(definition.Extract, respBody, resp, vars)...)
+	}
+
+	if (definition.Script != nil) {
+		scriptFailure := r.Scripts.After(definition.Script, req, reqBody, resp, respBody, totalTime, vars)
+		if (scriptFailure != nil) {
+			failures = append(failures, scriptFailure)
+		}
+	}
+
 	return ResponseStats {
-		TimeToConnect: r.ConnectionTime,
-		TimeToRespond: r.RequestTime,
-		TotalTime: r.TotalTime,
+		TimeToConnect: respPhases.Connect(),
+		TimeToRespond: totalTime - respPhases.Connect(),
+		TotalTime: totalTime,
+		Phases: respPhases,
 		StartTime: startTime,
 		FinishTime: finishTime,
+		StatusCode: resp.StatusCode,
 
 		Failures : failures,
 
@@ -106,51 +153,77 @@ func (r *RequestRecorder) PerformRequest() (respStats ResponseStats, err error){
 	}, err
 }
 
-func (r *RequestRecorder) constructRequest() (req *http.Request, err error) {
-	return http.NewRequest(r.RequestOptions.Method, r.RequestOptions.URL, bytes.NewReader(r.RequestOptions.Payload))
+//sampleValidation picks the ValidationRate fraction of responses to validate against the schema
+func (r *RequestRecorder) sampleValidation() bool {
+	return r.RequestOptions.ValidationRate >= 1 || (r.RequestOptions.ValidationRate > 0 && rand.Float64() < r.RequestOptions.ValidationRate)
+}
+
+func (r *RequestRecorder) constructRequest(definition *RequestDefinition, vars map[string]string) (req *http.Request, err error) {
+	request := &ScriptRequest{
+		Method : definition.Method,
+		URL : definition.URL,
+		Headers : definition.Headers,
+		Payload : definition.Payload,
+	}
+	if (definition.Template != nil) {
+		request.URL, request.Headers, request.Payload, err = r.Templates.Render(definition, vars)
+		if (err != nil) {
+			return nil, err
+		}
+	}
+
+	if (definition.Script != nil) {
+		scriptFailure := r.Scripts.Before(definition.Script, request, vars)
+		if (scriptFailure != nil) {
+			return nil, scriptFailure
+		}
+	}
+
+	req, err = http.NewRequest(request.Method, request.URL, bytes.NewReader(request.Payload))
+	if (err != nil) {
+		return nil, err
+	}
+
+	for headerName, headerValue := range request.Headers {
+		req.Header.Add(headerName, headerValue)
+	}
+	return req, nil
 }
 
 func (r *RequestRecorder) createHttpClient() (*http.Client) {
-	client := http.DefaultClient
+	client := &http.Client{}
+	dialer := &net.Dialer{
+		Timeout:   r.RequestOptions.Timeout,
+		KeepAlive: r.RequestOptions.KeepAlive,
+	}
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DisableKeepAlives : !r.RequestOptions.EnableKeepAlive,
 		DisableCompression : true,
 		MaxIdleConnsPerHost : 2,
-		Dial: r.DialWithTimeRecorder,
+		DialContext: dialer.DialContext,
 		TLSHandshakeTimeout: r.RequestOptions.TLSHandshakeTimeout,
 	}
 
 	client.Timeout = r.RequestOptions.Timeout
 	client.Transport = transport
+	r.Transport = transport
 
 	return client
 }
 
-func (r *RequestRecorder) DialWithTimeRecorder(network, address string) (conn net.Conn, err error) {
-	dialer := &net.Dialer{
-		Timeout:   r.RequestOptions.Timeout,
-		KeepAlive: r.RequestOptions.KeepAlive,
-	}
-
-	now := time.Now()
-
-	conn, err = dialer.Dial(network, address)
-
-	if (err != nil) {
-		Log("temp", "dialer err? ",err)
-		return conn, err
-	}
-
-	r.ConnectionTime = time.Since(now)
-
-	return conn, err
-}
-
 func (r *RequestRecorder) issueRequest(req *http.Request)(resp *http.Response, err error) {
 	return r.Client.Do(req)
 }
 
+//readResponseBody reads the whole body so its transfer is timed with the request, the body is left in memory to be read again
+func (r *RequestRecorder) readResponseBody(resp *http.Response) error {
+	respPayloadBytes, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respPayloadBytes))
+	return err
+}
+
 func (r *RequestRecorder) isolatePayloads (req *http.Request, resp *http.Response) (reqPayload string, respPayload string, err error) {
 
 	respDump, err := httputil.DumpResponse(resp, true)
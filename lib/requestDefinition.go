@@ -0,0 +1,387 @@
+package lib
+
+import (
+	"github.com/xeipuuv/gojsonschema"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+//RequestDefinition describes one request that executors can issue, it's loaded from a line of a requests JSONL file
+type RequestDefinition struct {
+	Label string `json:"label"`
+	Method string `json:"method"`
+	URL string `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body json.RawMessage `json:"body"`
+	//ResponseCodes are the status codes that pass, written as 201, "200-299,304" or [200, 204]
+	ResponseCodes StatusCodes `json:"responseCode"`
+	SchemaPath string `json:"schema"`
+	//Weight is 1 when it's left out of the requests file, a weight of 0 disables the request
+	Weight float64 `json:"weight"`
+
+	//Extract and Steps are used for chains, a definition with steps issues each of them in turn as one virtual user
+	Extract []Extraction `json:"extract"`
+	Steps []RequestDefinition `json:"steps"`
+
+	//ScriptPath is a Lua script with before and after hooks for the request
+	ScriptPath string `json:"script"`
+
+	//Assert holds the checks on the response beyond its status code and schema
+	Assert Assertions `json:"assert"`
+
+	Payload []byte `json:"-"`
+	JSONSchema string `json:"-"`
+	Schema *gojsonschema.Schema `json:"-"`
+	Template *RequestTemplate `json:"-"`
+	Script *Script `json:"-"`
+}
+
+const (
+	RoundRobinSelection = "roundrobin"
+	WeightedSelection = "weighted"
+)
+
+var DefaultSelection = RoundRobinSelection
+
+//LoadRequestDefinitions reads a JSONL file where each line describes a request,
+//anything not set on a line is taken from the command line options
+func LoadRequestDefinitions(location string, reqOpts RequestOptions) (definitions []RequestDefinition, err error) {
+	file, err := os.Open(location)
+	if (err != nil) {
+		return definitions, errors.New(fmt.Sprintf("Could not load requests file at %v err: %v", location, err))
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") { continue }
+
+		definition := RequestDefinition{Weight : 1}
+		err = json.Unmarshal([]byte(line), &definition)
+		if (err != nil) {
+			return definitions, errors.New(fmt.Sprintf("Could not parse request on line %v of %v err: %v", lineNum, location, err))
+		}
+
+		err = definition.applyDefaults(reqOpts)
+		if (err != nil) {
+			return definitions, errors.New(fmt.Sprintf("Invalid request on line %v of %v err: %v", lineNum, location, err))
+		}
+
+		definitions = append(definitions, definition)
+	}
+	if err = scanner.Err(); err != nil {
+		return definitions, errors.New(fmt.Sprintf("Could not read requests file at %v err: %v", location, err))
+	}
+
+	if (len(definitions) == 0) {
+		return definitions, errors.New(fmt.Sprintf("No requests were found in %v", location))
+	}
+
+	enabled := false
+	for _, definition := range definitions {
+		enabled = enabled || definition.Weight > 0
+	}
+	if (!enabled) {
+		return definitions, errors.New(fmt.Sprintf("Every request in %v has a weight of 0, at least one must be enabled", location))
+	}
+
+	labels := make(map[string]bool)
+	for _, definition := range definitions {
+		for _, label := range definition.Labels() {
+			if (labels[label]) {
+				return definitions, errors.New(fmt.Sprintf("The label '%v' is used by more than one request in %v", label, location))
+			}
+			labels[label] = true
+		}
+	}
+	return definitions, nil
+}
+
+//DefaultRequestDefinition builds the single request described by the -url, -method and related options
+func DefaultRequestDefinition(reqOpts RequestOptions) (definition RequestDefinition, err error) {
+	definition = RequestDefinition{
+		Method : reqOpts.Method,
+		URL : reqOpts.URL,
+		Headers : reqOpts.Headers,
+		ResponseCodes : reqOpts.ResponseCodes,
+		Weight : 1,
+		Label : fmt.Sprintf("%v %v", reqOpts.Method, reqOpts.URL),
+		Payload : reqOpts.Payload,
+		JSONSchema : reqOpts.JSONSchema,
+		Schema : reqOpts.Schema,
+		Script : reqOpts.Script,
+		Assert : reqOpts.Assertions,
+	}
+	err = definition.compileSchema()
+	if (err != nil) {
+		return definition, err
+	}
+	err = definition.Assert.compile()
+	if (err != nil) {
+		return definition, err
+	}
+	definition.Template, err = CompileRequestTemplate(&definition)
+	return definition, err
+}
+
+func (d *RequestDefinition) applyDefaults(reqOpts RequestOptions) error {
+	if (len(d.Steps) > 0) {
+		return d.applyChainDefaults(reqOpts)
+	}
+
+	if (d.URL == "") {
+		return errors.New("a url is required")
+	}
+	if (d.Method == "") {
+		d.Method = "GET"
+	}
+	d.Method = strings.ToUpper(d.Method)
+
+	if (d.Label == "") {
+		d.Label = fmt.Sprintf("%v %v", d.Method, d.URL)
+	}
+
+	if (len(d.ResponseCodes) == 0) {
+		d.ResponseCodes = reqOpts.ResponseCodes
+	}
+
+	if (d.Weight < 0) {
+		return errors.New(fmt.Sprintf("weight must not be negative, got %v", d.Weight))
+	}
+
+	//Headers from the command line apply to every request, unless the request overrides them
+	headers := make(map[string]string)
+	for headerName, headerValue := range reqOpts.Headers {
+		headers[headerName] = headerValue
+	}
+	for headerName, headerValue := range d.Headers {
+		headers[headerName] = headerValue
+	}
+	d.Headers = headers
+
+	payload, err := decodeBody(d.Body)
+	if (err != nil) {
+		return err
+	}
+	d.Payload = payload
+
+	if (d.SchemaPath != "") {
+		jsonSchema, err := ioutil.ReadFile(d.SchemaPath)
+		if (err != nil) {
+			return errors.New(fmt.Sprintf("Could not load schema file at %v err: %v", d.SchemaPath, err))
+		}
+		d.JSONSchema = string(jsonSchema)
+	} else {
+		d.JSONSchema, d.Schema = reqOpts.JSONSchema, reqOpts.Schema
+	}
+	err = d.compileSchema()
+	if (err != nil) {
+		return err
+	}
+
+	if (d.ScriptPath != "") {
+		d.Script, err = LoadScript(d.ScriptPath)
+		if (err != nil) {
+			return err
+		}
+	} else {
+		d.Script = reqOpts.Script
+	}
+
+	if (d.Assert.Empty()) {
+		d.Assert = reqOpts.Assertions
+	}
+	err = d.Assert.compile()
+	if (err != nil) {
+		return err
+	}
+
+	for index := range d.Extract {
+		err = d.Extract[index].compile()
+		if (err != nil) {
+			return err
+		}
+	}
+
+	d.Template, err = CompileRequestTemplate(d)
+	if (err != nil) {
+		return err
+	}
+
+	return nil
+}
+
+//applyChainDefaults sets up each step of a chain, steps share the chain's headers and are labelled "chain > step"
+func (d *RequestDefinition) applyChainDefaults(reqOpts RequestOptions) error {
+	if (d.Weight < 0) {
+		return errors.New(fmt.Sprintf("weight must not be negative, got %v", d.Weight))
+	}
+
+	stepOpts := reqOpts
+	stepOpts.Headers = make(map[string]string)
+	for headerName, headerValue := range reqOpts.Headers {
+		stepOpts.Headers[headerName] = headerValue
+	}
+	for headerName, headerValue := range d.Headers {
+		stepOpts.Headers[headerName] = headerValue
+	}
+
+	stepLabels := []string{}
+	for index := range d.Steps {
+		if (len(d.Steps[index].Steps) > 0) {
+			return errors.New(fmt.Sprintf("step %v is a chain, chains can't be nested", index + 1))
+		}
+		err := d.Steps[index].applyDefaults(stepOpts)
+		if (err != nil) {
+			return errors.New(fmt.Sprintf("step %v: %v", index + 1, err))
+		}
+		stepLabels = append(stepLabels, d.Steps[index].Label)
+	}
+
+	if (d.Label == "") {
+		d.Label = strings.Join(stepLabels, " -> ")
+	}
+	for index := range d.Steps {
+		d.Steps[index].Label = fmt.Sprintf("%v > %v", d.Label, d.Steps[index].Label)
+	}
+	return nil
+}
+
+//compileSchema compiles the definition's own schema, one shared from the options is already compiled
+func (d *RequestDefinition) compileSchema() (err error) {
+	if (d.JSONSchema == "" || d.Schema != nil) {
+		return nil
+	}
+	d.Schema, err = CompileSchema(d.JSONSchema)
+	return err
+}
+
+//IsChain is true when the definition issues several steps rather than a single request
+func (d *RequestDefinition) IsChain() bool {
+	return len(d.Steps) > 0
+}
+
+//Labels returns the label of the definition, followed by the label of each of its steps
+func (d *RequestDefinition) Labels() []string {
+	labels := []string{d.Label}
+	for _, step := range d.Steps {
+		labels = append(labels, step.Label)
+	}
+	return labels
+}
+
+//decodeBody allows a body to be written as a JSON string (sent as is) or as any other JSON value (sent as JSON)
+func decodeBody(body json.RawMessage) (payload []byte, err error) {
+	if (len(body) == 0 || string(body) == "null") {
+		return []byte{}, nil
+	}
+	if (body[0] == '"') {
+		var bodyStr string
+		err = json.Unmarshal(body, &bodyStr)
+		if (err != nil) {
+			return payload, err
+		}
+		return []byte(bodyStr), nil
+	}
+	return []byte(body), nil
+}
+
+//RequestSelector hands out request definitions to the spawner, either in turn or in proportion to their weights.
+//Weighted selection is a smooth weighted round robin, so every window of total weight requests matches the mix exactly.
+//Definitions with a weight of 0 are never handed out by either strategy, unless none of the definitions have a weight.
+type RequestSelector struct {
+	mu sync.Mutex
+	Definitions []RequestDefinition
+	Strategy string
+
+	//enabled holds the index of each definition that can be handed out
+	enabled []int
+	next int
+	currentWeights []float64
+	totalWeight float64
+	issued map[string]int
+}
+
+func NewRequestSelector(definitions []RequestDefinition, strategy string) *RequestSelector {
+	selector := &RequestSelector{
+		Definitions : definitions,
+		Strategy : strategy,
+		currentWeights : make([]float64, len(definitions)),
+		issued : make(map[string]int),
+	}
+	for index, definition := range definitions {
+		selector.totalWeight += definition.Weight
+		if (definition.Weight > 0) {
+			selector.enabled = append(selector.enabled, index)
+		}
+	}
+	//Definitions built in code rather than loaded from a file can leave every weight at 0, they're all handed out in turn
+	if (len(selector.enabled) == 0) {
+		for index := range definitions {
+			selector.enabled = append(selector.enabled, index)
+		}
+	}
+	return selector
+}
+
+func ValidSelection(strategy string) bool {
+	return strategy == RoundRobinSelection || strategy == WeightedSelection
+}
+
+func (s *RequestSelector) Next() *RequestDefinition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if (len(s.Definitions) == 0) {
+		return nil
+	}
+
+	var definition *RequestDefinition
+	if (s.Strategy == WeightedSelection && s.totalWeight > 0) {
+		best := s.enabled[0]
+		for _, index := range s.enabled {
+			s.currentWeights[index] += s.Definitions[index].Weight
+			if (s.currentWeights[index] > s.currentWeights[best]) {
+				best = index
+			}
+		}
+		s.currentWeights[best] -= s.totalWeight
+		definition = &s.Definitions[best]
+	} else {
+		definition = &s.Definitions[s.enabled[s.next]]
+		s.next = (s.next + 1) % len(s.enabled)
+	}
+
+	s.issued[definition.Label] += 1
+	return definition
+}
+
+//Drop takes back a definition that was handed out but never issued
+func (s *RequestSelector) Drop(definition *RequestDefinition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.issued[definition.Label] -= 1
+}
+
+//Issued returns a copy of how many of each request has been handed out, keyed by label
+func (s *RequestSelector) Issued() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued := make(map[string]int)
+	for label, count := range s.issued {
+		issued[label] = count
+	}
+	return issued
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//writeTempFile writes contents to a file called name in a new temp dir, the caller removes the dir
+func writeTempFile(t *testing.T, name string, contents string) string {
+	dir, err := ioutil.TempDir("", "deathstar")
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	location := filepath.Join(dir, name)
+	err = ioutil.WriteFile(location, []byte(contents), 0644)
+	if (err != nil) {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestLoadRequestDefinitions(t *testing.T) {
+	c.Convey("With a requests file", t, func(){
+		location := writeTempFile(t, "requests.jsonl", `
+{"method": "get", "url": "http://fake.com/items"}
+{"method": "POST", "url": "http://fake.com/items", "headers": {"Accept": "json"}, "body": {"name": "thing"}, "responseCode": 201, "weight": 3}
+
+{"method": "DELETE", "url": "http://fake.com/items/1", "body": "raw"}
+`)
+		defer os.RemoveAll(filepath.Dir(location))
+
+		reqOpts := RequestOptions{
+			ResponseCodes : OnlyStatusCode(200),
+			Headers : map[string]string{"Accept": "*", "X-Test": "yes"},
+		}
+
+		c.Convey("Each line becomes a request definition, with defaults from the options", func(){
+			definitions, err := LoadRequestDefinitions(location, reqOpts)
+			c.So(err, c.ShouldBeNil)
+			c.So(len(definitions), c.ShouldEqual, 3)
+
+			c.So(definitions[0].Method, c.ShouldEqual, "GET")
+			c.So(definitions[0].ResponseCodes, c.ShouldResemble, OnlyStatusCode(200))
+			c.So(definitions[0].Weight, c.ShouldEqual, 1)
+
+			c.So(definitions[1].ResponseCodes, c.ShouldResemble, OnlyStatusCode(201))
+			c.So(definitions[1].Weight, c.ShouldEqual, 3)
+			c.So(definitions[1].Headers["Accept"], c.ShouldEqual, "json")
+			c.So(definitions[1].Headers["X-Test"], c.ShouldEqual, "yes")
+			c.So(string(definitions[1].Payload), c.ShouldEqual, `{"name": "thing"}`)
+
+			c.So(string(definitions[2].Payload), c.ShouldEqual, "raw")
+		})
+	})
+
+	c.Convey("A weight of 0 disables a request, unless it would disable them all", t, func(){
+		location := writeTempFile(t, "requests.jsonl", `
+{"url": "http://fake.com/on"}
+{"url": "http://fake.com/off", "weight": 0}
+`)
+		defer os.RemoveAll(filepath.Dir(location))
+
+		definitions, err := LoadRequestDefinitions(location, RequestOptions{})
+		c.So(err, c.ShouldBeNil)
+		c.So(definitions[1].Weight, c.ShouldEqual, 0)
+
+		for _, strategy := range []string{RoundRobinSelection, WeightedSelection} {
+			selector := NewRequestSelector(definitions, strategy)
+			for i := 0; i < 4; i++ {
+				c.So(selector.Next().URL, c.ShouldEqual, "http://fake.com/on")
+			}
+		}
+
+		disabled := writeTempFile(t, "requests.jsonl", `{"url": "http://fake.com/off", "weight": 0}`)
+		defer os.RemoveAll(filepath.Dir(disabled))
+		_, err = LoadRequestDefinitions(disabled, RequestOptions{})
+		c.So(err, c.ShouldNotBeNil)
+	})
+
+	c.Convey("A request without a url is rejected", t, func(){
+		location := writeTempFile(t, "requests.jsonl", `{"method": "GET"}`)
+		defer os.RemoveAll(filepath.Dir(location))
+
+		_, err := LoadRequestDefinitions(location, RequestOptions{})
+		c.So(err, c.ShouldNotBeNil)
+	})
+}
+
+func TestRequestSelector(t *testing.T) {
+	c.Convey("With several request definitions", t, func(){
+		definitions := []RequestDefinition{
+			{Label : "http://fake.com/a", URL : "http://fake.com/a", Weight : 1},
+			{Label : "http://fake.com/b", URL : "http://fake.com/b", Weight : 1},
+			{Label : "http://fake.com/c", URL : "http://fake.com/c", Weight : 1},
+		}
+
+		c.Convey("Round robin selection hands them out in turn", func(){
+			selector := NewRequestSelector(definitions, RoundRobinSelection)
+			urls := []string{}
+			for i := 0; i < 4; i++ {
+				urls = append(urls, selector.Next().URL)
+			}
+			c.So(urls, c.ShouldResemble, []string{"http://fake.com/a", "http://fake.com/b", "http://fake.com/c", "http://fake.com/a"})
+		})
+
+		c.Convey("Weighted selection hands them out in proportion to their weights", func(){
+			definitions[0].Weight = 7
+			definitions[1].Weight = 2
+			definitions[2].Weight = 1
+			selector := NewRequestSelector(definitions, WeightedSelection)
+			for i := 0; i < 100; i++ {
+				selector.Next()
+			}
+			issued := selector.Issued()
+			c.So(issued["http://fake.com/a"], c.ShouldEqual, 70)
+			c.So(issued["http://fake.com/b"], c.ShouldEqual, 20)
+			c.So(issued["http://fake.com/c"], c.ShouldEqual, 10)
+		})
+
+		c.Convey("Weighted selection never picks a request without weight", func(){
+			definitions[1].Weight = 0
+			selector := NewRequestSelector(definitions, WeightedSelection)
+			for i := 0; i < 100; i++ {
+				c.So(selector.Next().URL, c.ShouldNotEqual, "http://fake.com/b")
+			}
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"net/http"
+	"net/url"
 	"errors"
 )
 
@@ -28,8 +29,13 @@ func (e RequestExecutionError) Error() string {
 	return e.err.Error()
 }
 
+//Description leaves out the url a request failed on, which can change every request
 func (e RequestExecutionError) Description() string {
-	return fmt.Sprintf("An error occurred executing the request %v", e.err.Error())
+	err := e.err
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	return fmt.Sprintf("An error occurred executing the request %v", err.Error())
 }
 
 func (e RequestExecutionError) Category() string {
@@ -60,7 +66,7 @@ func (e StatusCodeError) Error() string {
 }
 
 func (e StatusCodeError) Description() string {
-	return "An invalid status code was returned"
+	return fmt.Sprintf("An invalid status code was returned, %v", e.StatusCode)
 }
 
 func (e StatusCodeError) Category() string {
@@ -68,8 +74,8 @@ func (e StatusCodeError) Category() string {
 }
 
 
-func ValidateStatusCode(expectedStatusCode int, resp *http.Response) (err DescriptiveError)  {
-	if (resp.StatusCode != expectedStatusCode) {
+func ValidateStatusCode(expectedStatusCodes StatusCodes, resp *http.Response) (err DescriptiveError)  {
+	if (!expectedStatusCodes.Contains(resp.StatusCode)) {
 		return *NewStatusCodeError(resp.StatusCode)
 	}
 	return nil
@@ -109,10 +115,18 @@ func NewValidationError (res *gojsonschema.Result) *ValidationError{
 	}
 }
 
-func ValidateSchema(respPayload string, resp *http.Response, schema string) (err error) {
+//CompileSchema parses a JSON schema once, the compiled schema can be shared by every executor
+func CompileSchema(schema string) (*gojsonschema.Schema, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not compile the schema, err: %v", err))
+	}
+	return compiled, nil
+}
+
+func ValidateSchema(respPayload string, resp *http.Response, schema *gojsonschema.Schema) (err error) {
 	responseLoader := gojsonschema.NewStringLoader(respPayload)
-	schemaLoader := gojsonschema.NewStringLoader(schema)
-	res, err := gojsonschema.Validate(schemaLoader, responseLoader)
+	res, err := schema.Validate(responseLoader)
 	if (err != nil) {
 		return *NewRequestExecutionError(err)
 	}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := `{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}`
+
+	c.Convey("A schema is compiled once and shared by concurrent validations", t, func(){
+		compiled, err := CompileSchema(schema)
+		c.So(err, c.ShouldBeNil)
+
+		var wg sync.WaitGroup
+		results := make([]error, 20)
+		for index := range results {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				payload := `{"id": 12}`
+				if (index % 2 == 1) {
+					payload = `{"id": "twelve"}`
+				}
+				results[index] = ValidateSchema(payload, nil, compiled)
+			}(index)
+		}
+		wg.Wait()
+
+		for index, err := range results {
+			if (index % 2 == 1) {
+				c.So(err, c.ShouldHaveSameTypeAs, ValidationError{})
+			} else {
+				c.So(err, c.ShouldBeNil)
+			}
+		}
+	})
+
+	c.Convey("An invalid schema fails when it's compiled rather than on every response", t, func(){
+		_, err := CompileSchema(`{"type": 12}`)
+		c.So(err, c.ShouldNotBeNil)
+
+		plan := NewPlan("http://localhost")
+		plan.RequestOptions.JSONSchema = `{"type": 12}`
+		_, err = PrepareRequestOptions(plan.RequestOptions)
+		c.So(err, c.ShouldNotBeNil)
+	})
+
+	c.Convey("Only the sampled fraction of responses are validated", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, `{"id": "twelve"}`)
+		}))
+		defer server.Close()
+
+		plan := NewPlan(server.URL)
+		plan.RequestOptions.JSONSchema = schema
+		for validation, expectedFailures := range map[string]int{"all" : 10, "none" : 0} {
+			plan.RequestOptions.Validation = validation
+			reqOpts, err := PrepareRequestOptions(plan.RequestOptions)
+			c.So(err, c.ShouldBeNil)
+
+			recorder := NewRequestRecorder(reqOpts)
+			failures := 0
+			for i := 0; i < 10; i++ {
+				stats, _ := recorder.PerformRequest(&reqOpts.Requests[0], map[string]string{})
+				failures += len(stats.Failures)
+			}
+			c.So(failures, c.ShouldEqual, expectedFailures)
+		}
+
+		plan.RequestOptions.Validation = "half"
+		_, err := PrepareRequestOptions(plan.RequestOptions)
+		c.So(err, c.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,225 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+//RequestTemplate holds the compiled templates for the parts of a request that use {{ }} placeholders,
+//parts without placeholders are left nil and sent as they are.
+//Along with {{.name}} for values extracted in a chain, templates can use the data generators in templateFuncs.
+type RequestTemplate struct {
+	URL *template.Template
+	Headers map[string]*template.Template
+	Body *template.Template
+}
+
+//CompileRequestTemplate compiles the url, headers and body of a definition once, so rendering a request is cheap.
+//It returns nil if the definition doesn't use any placeholders.
+func CompileRequestTemplate(definition *RequestDefinition) (requestTemplate *RequestTemplate, err error) {
+	compiled := &RequestTemplate{
+		Headers : make(map[string]*template.Template),
+	}
+	usesTemplates := false
+
+	compiled.URL, err = compileTemplate("url", definition.URL)
+	if (err != nil) {
+		return nil, err
+	}
+	usesTemplates = usesTemplates || compiled.URL != nil
+
+	for headerName, headerValue := range definition.Headers {
+		headerTemplate, err := compileTemplate("header " + headerName, headerValue)
+		if (err != nil) {
+			return nil, err
+		}
+		if (headerTemplate != nil) {
+			compiled.Headers[headerName] = headerTemplate
+			usesTemplates = true
+		}
+	}
+
+	compiled.Body, err = compileTemplate("body", string(definition.Payload))
+	if (err != nil) {
+		return nil, err
+	}
+	usesTemplates = usesTemplates || compiled.Body != nil
+
+	if (!usesTemplates) {
+		return nil, nil
+	}
+	return compiled, nil
+}
+
+func compileTemplate(name string, text string) (*template.Template, error) {
+	if (!strings.Contains(text, "{{")) {
+		return nil, nil
+	}
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs(&templateContext{})).Parse(text)
+}
+
+//templateContext holds what a template knows about the request being rendered
+type templateContext struct {
+	ExecutorId string
+	Seq uint64
+}
+
+//templateFuncs are the data generators available in every template.
+//seq and executorId read from ctx, so each executor binds them to its own context.
+func templateFuncs(ctx *templateContext) template.FuncMap {
+	return template.FuncMap{
+		"uuid" : newUUID,
+		"randInt" : randInt,
+		"randString" : randString,
+		"now" : func() string { return time.Now().Format(time.RFC3339) },
+		"nowUnix" : func() int64 { return time.Now().Unix() },
+		"seq" : func() uint64 { return ctx.Seq },
+		"executorId" : func() string { return ctx.ExecutorId },
+	}
+}
+
+func newUUID() (string, error) {
+	uuid := make([]byte, 16)
+	_, err := rand.Read(uuid)
+	if (err != nil) {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+//randInt returns a random number between min and max, inclusive
+func randInt(min int, max int) (int, error) {
+	if (max < min) {
+		return 0, errors.New(fmt.Sprintf("randInt max %v is less than min %v", max, min))
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max - min + 1)))
+	if (err != nil) {
+		return 0, err
+	}
+	return min + int(n.Int64()), nil
+}
+
+const randStringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randString(length int) string {
+	chars := make([]byte, length)
+	for index := range chars {
+		chars[index] = randStringChars[mathrand.Intn(len(randStringChars))]
+	}
+	return string(chars)
+}
+
+//TemplateRunner renders request templates for one executor.
+//Templates are compiled once at startup, the runner clones each one the first time it's used to bind seq and executorId.
+type TemplateRunner struct {
+	context *templateContext
+	sequence *uint64
+	clones map[*RequestTemplate]*RequestTemplate
+}
+
+//NewTemplateRunner creates a runner for an executor, sequence is shared between executors so seq is unique across the run
+func NewTemplateRunner(executorId string, sequence *uint64) *TemplateRunner {
+	if (sequence == nil) {
+		sequence = new(uint64)
+	}
+	return &TemplateRunner{
+		context : &templateContext{ExecutorId : executorId},
+		sequence : sequence,
+		clones : make(map[*RequestTemplate]*RequestTemplate),
+	}
+}
+
+func (t *TemplateRunner) Render(definition *RequestDefinition, vars map[string]string) (url string, headers map[string]string, payload []byte, err error) {
+	clone, ok := t.clones[definition.Template]
+	if (!ok) {
+		clone, err = definition.Template.bind(templateFuncs(t.context))
+		if (err != nil) {
+			return
+		}
+		t.clones[definition.Template] = clone
+	}
+
+	t.context.Seq = atomic.AddUint64(t.sequence, 1)
+	return clone.Render(definition, vars)
+}
+
+func (t *RequestTemplate) bind(funcs template.FuncMap) (bound *RequestTemplate, err error) {
+	bound = &RequestTemplate{
+		Headers : make(map[string]*template.Template),
+	}
+	if (t.URL != nil) {
+		bound.URL, err = t.URL.Clone()
+		if (err != nil) {
+			return nil, err
+		}
+		bound.URL.Funcs(funcs)
+	}
+	for headerName, headerTemplate := range t.Headers {
+		headerClone, err := headerTemplate.Clone()
+		if (err != nil) {
+			return nil, err
+		}
+		bound.Headers[headerName] = headerClone.Funcs(funcs)
+	}
+	if (t.Body != nil) {
+		bound.Body, err = t.Body.Clone()
+		if (err != nil) {
+			return nil, err
+		}
+		bound.Body.Funcs(funcs)
+	}
+	return bound, nil
+}
+
+func executeTemplate(compiled *template.Template, vars map[string]string) (string, error) {
+	buf := bytes.NewBufferString("")
+	err := compiled.Execute(buf, vars)
+	return buf.String(), err
+}
+
+//Render fills in the placeholders of a definition with vars
+func (t *RequestTemplate) Render(definition *RequestDefinition, vars map[string]string) (url string, headers map[string]string, payload []byte, err error) {
+	url = definition.URL
+	if (t.URL != nil) {
+		url, err = executeTemplate(t.URL, vars)
+		if (err != nil) {
+			return
+		}
+	}
+
+	headers = definition.Headers
+	if (len(t.Headers) > 0) {
+		headers = make(map[string]string)
+		for headerName, headerValue := range definition.Headers {
+			headers[headerName] = headerValue
+		}
+		for headerName, headerTemplate := range t.Headers {
+			headers[headerName], err = executeTemplate(headerTemplate, vars)
+			if (err != nil) {
+				return
+			}
+		}
+	}
+
+	payload = definition.Payload
+	if (t.Body != nil) {
+		var body string
+		body, err = executeTemplate(t.Body, vars)
+		if (err != nil) {
+			return
+		}
+		payload = []byte(body)
+	}
+
+	return url, headers, payload, nil
+}
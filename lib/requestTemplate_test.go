@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"regexp"
+)
+
+func TestTemplateRunner(t *testing.T) {
+	c.Convey("With a templated request definition", t, func(){
+		definition := RequestDefinition{
+			URL : "http://fake.com/items/{{randInt 1 3}}?seq={{seq}}&again={{seq}}",
+			Headers : map[string]string{"X-Executor": "{{executorId}}", "Accept": "json"},
+			Payload : []byte(`{"id": "{{uuid}}", "name": "{{.name}}"}`),
+		}
+		compiled, err := CompileRequestTemplate(&definition)
+		c.So(err, c.ShouldBeNil)
+		definition.Template = compiled
+
+		sequence := uint64(0)
+		runner := NewTemplateRunner("7", &sequence)
+
+		c.Convey("Each render fills in the data generators and vars", func(){
+			url, headers, payload, err := runner.Render(&definition, map[string]string{"name": "thing"})
+			c.So(err, c.ShouldBeNil)
+			c.So(url, c.ShouldStartWith, "http://fake.com/items/")
+			c.So(url, c.ShouldEndWith, "?seq=1&again=1")
+			c.So(headers["X-Executor"], c.ShouldEqual, "7")
+			c.So(headers["Accept"], c.ShouldEqual, "json")
+			c.So(regexp.MustCompile(`^{"id": "[0-9a-f-]{36}", "name": "thing"}$`).MatchString(string(payload)), c.ShouldBeTrue)
+
+			url, _, _, _ = runner.Render(&definition, map[string]string{"name": "thing"})
+			c.So(url, c.ShouldEndWith, "?seq=2&again=2")
+		})
+
+		c.Convey("The sequence is shared between runners", func(){
+			otherRunner := NewTemplateRunner("8", &sequence)
+			runner.Render(&definition, map[string]string{"name": "thing"})
+			url, headers, _, _ := otherRunner.Render(&definition, map[string]string{"name": "thing"})
+			c.So(url, c.ShouldEndWith, "?seq=2&again=2")
+			c.So(headers["X-Executor"], c.ShouldEqual, "8")
+		})
+
+		c.Convey("A missing var is an error", func(){
+			_, _, _, err := runner.Render(&definition, map[string]string{})
+			c.So(err, c.ShouldNotBeNil)
+		})
+	})
+
+	c.Convey("A definition without placeholders has no template", t, func(){
+		compiled, err := CompileRequestTemplate(&RequestDefinition{URL : "http://fake.com"})
+		c.So(err, c.ShouldBeNil)
+		c.So(compiled, c.ShouldBeNil)
+	})
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+//RequestPhases breaks the time a request took down into its phases, a phase the request didn't go through is zero,
+//for example a reused connection has no DNS lookup, TCP connect or TLS handshake.
+//TimeToFirstByte is measured from the request being written, so the phases don't overlap.
+type RequestPhases struct {
+	DNSLookup time.Duration
+	TCPConnect time.Duration
+	TLSHandshake time.Duration
+	TimeToFirstByte time.Duration
+	Transfer time.Duration
+
+	ConnectionReused bool
+}
+
+//Connect is the time spent setting up the connection
+func (p RequestPhases) Connect() time.Duration {
+	return p.DNSLookup + p.TCPConnect + p.TLSHandshake
+}
+
+//Add sums the phases of the steps of a chain, the chain only counts as reusing connections if every step did
+func (p RequestPhases) Add(other RequestPhases) RequestPhases {
+	return RequestPhases{
+		DNSLookup : p.DNSLookup + other.DNSLookup,
+		TCPConnect : p.TCPConnect + other.TCPConnect,
+		TLSHandshake : p.TLSHandshake + other.TLSHandshake,
+		TimeToFirstByte : p.TimeToFirstByte + other.TimeToFirstByte,
+		Transfer : p.Transfer + other.Transfer,
+		ConnectionReused : p.ConnectionReused && other.ConnectionReused,
+	}
+}
+
+//phaseRecorder collects the timings of a single request from httptrace callbacks.
+//The transport can call them from its own goroutines, so they're guarded by mu.
+type phaseRecorder struct {
+	mu sync.Mutex
+	phases RequestPhases
+
+	dnsStart time.Time
+	connectStart time.Time
+	tlsStart time.Time
+	wroteRequest time.Time
+	firstByte time.Time
+}
+
+func (p *phaseRecorder) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart : func(httptrace.DNSStartInfo) {
+			p.mu.Lock()
+			p.dnsStart = time.Now()
+			p.mu.Unlock()
+		},
+		DNSDone : func(httptrace.DNSDoneInfo) {
+			p.mu.Lock()
+			p.phases.DNSLookup = time.Since(p.dnsStart)
+			p.mu.Unlock()
+		},
+		ConnectStart : func(network, addr string) {
+			p.mu.Lock()
+			p.connectStart = time.Now()
+			p.mu.Unlock()
+		},
+		ConnectDone : func(network, addr string, err error) {
+			p.mu.Lock()
+			p.phases.TCPConnect = time.Since(p.connectStart)
+			p.mu.Unlock()
+		},
+		TLSHandshakeStart : func() {
+			p.mu.Lock()
+			p.tlsStart = time.Now()
+			p.mu.Unlock()
+		},
+		TLSHandshakeDone : func(tls.ConnectionState, error) {
+			p.mu.Lock()
+			p.phases.TLSHandshake = time.Since(p.tlsStart)
+			p.mu.Unlock()
+		},
+		GotConn : func(info httptrace.GotConnInfo) {
+			p.mu.Lock()
+			p.phases.ConnectionReused = info.Reused
+			p.mu.Unlock()
+		},
+		WroteRequest : func(httptrace.WroteRequestInfo) {
+			p.mu.Lock()
+			p.wroteRequest = time.Now()
+			p.mu.Unlock()
+		},
+		GotFirstResponseByte : func() {
+			p.mu.Lock()
+			p.firstByte = time.Now()
+			if (!p.wroteRequest.IsZero()) {
+				p.phases.TimeToFirstByte = p.firstByte.Sub(p.wroteRequest)
+			}
+			p.mu.Unlock()
+		},
+	}
+}
+
+//finish records the body transfer as ending at finishTime and returns the phases
+func (p *phaseRecorder) finish(finishTime time.Time) RequestPhases {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if (!p.firstByte.IsZero()) {
+		p.phases.Transfer = finishTime.Sub(p.firstByte)
+	}
+	return p.phases
+}
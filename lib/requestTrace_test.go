@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func TestRequestPhases(t *testing.T) {
+	c.Convey("With a server that takes a while to respond", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(time.Millisecond * 20)
+			fmt.Fprint(w, "ok")
+		}))
+		defer server.Close()
+
+		reqOpts := RequestOptions{
+			Timeout : time.Second,
+			EnableKeepAlive : true,
+		}
+		definition := RequestDefinition{URL : server.URL, ResponseCodes : OnlyStatusCode(200)}
+		c.So(definition.applyDefaults(reqOpts), c.ShouldBeNil)
+		recorder := NewRequestRecorder(reqOpts)
+
+		c.Convey("Each request records its own phases", func(){
+			first, err := recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(err, c.ShouldBeNil)
+			c.So(first.Phases.ConnectionReused, c.ShouldBeFalse)
+			c.So(first.Phases.TCPConnect, c.ShouldBeGreaterThan, 0)
+			c.So(first.Phases.TimeToFirstByte, c.ShouldBeGreaterThanOrEqualTo, time.Millisecond * 20)
+			c.So(first.TimeToConnect, c.ShouldEqual, first.Phases.Connect())
+
+			second, err := recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(err, c.ShouldBeNil)
+			c.So(second.Phases.ConnectionReused, c.ShouldBeTrue)
+			c.So(second.Phases.TCPConnect, c.ShouldEqual, 0)
+			c.So(second.TimeToConnect, c.ShouldEqual, 0)
+		})
+	})
+}
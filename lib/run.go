@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+//Plan is a test to run in process, with the options the flags would otherwise set.
+//The zero OutputOptions render nothing and write no reports, set them to add the cli, html, metrics or report files.
+type Plan struct {
+	RequestOptions RequestOptions
+	OutputOptions OutputOptions
+}
+
+//Result is how a test run in process finished
+type Result struct {
+	//Stats are the final aggregated stats of the whole test
+	Stats AggregatedStats
+	//Passed is true when the test met its thresholds, or a capacity search found a rate that did
+	Passed bool
+	//Aborted is true when the context was cancelled or a renderer quit before the test finished
+	Aborted bool
+	//ExitCode is the code the command line would exit with
+	ExitCode int
+	//SearchReport is the table of levels when a capacity search ran to the end
+	SearchReport string
+
+	requestOptions RequestOptions
+}
+
+//Report is the JSON report of the result, as -out writes it
+func (r *Result) Report() Report {
+	return NewReport(r.Stats, r.requestOptions)
+}
+
+//NewPlan is a plan for a scale test of a single GET of url, with the default rate, thresholds and timings and no schema validation
+func NewPlan(url string) Plan {
+	reqOpts := DefaultRequestOptions
+	reqOpts.URL = url
+	//The default schema is a path for the -schema flag, here it's the schema itself
+	reqOpts.JSONSchema = ""
+	return Plan{RequestOptions : reqOpts}
+}
+
+//Run executes the plan in process until it finishes or ctx is cancelled, then returns the final stats without exiting.
+//An error is returned when the plan's options are invalid, in which case nothing ran.
+//When ctx is cancelled the result holds the stats up to that point and the error is ctx.Err().
+func Run(ctx context.Context, plan Plan) (*Result, error) {
+	reqOpts, err := PrepareRequestOptions(plan.RequestOptions)
+	if (err != nil) {
+		return nil, err
+	}
+	err = ctx.Err()
+	if (err != nil) {
+		return nil, err
+	}
+
+	choreographer := NewChoreographer(reqOpts, plan.OutputOptions)
+	result := choreographer.Run(ctx)
+	if (result.Aborted && ctx.Err() != nil) {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+//PrepareRequestOptions checks the options and fills in what the flags would have: each duration left at zero comes from its
+//Secs or Ms field, or the default, the profile, samples and validation are parsed, the schema is compiled once,
+//and the script, feeder and requests are loaded when they haven't been already
+func PrepareRequestOptions(reqOpts RequestOptions) (RequestOptions, error) {
+	var err error
+	if (reqOpts.Selection == "") {
+		reqOpts.Selection = DefaultSelection
+	}
+	if (!ValidSelection(reqOpts.Selection)) {
+		return reqOpts, errors.New(fmt.Sprintf("Unknown selection '%v', expected '%v' or '%v'", reqOpts.Selection, RoundRobinSelection, WeightedSelection))
+	}
+
+	if (reqOpts.Arrival == "") {
+		reqOpts.Arrival = DefaultRequestOptions.Arrival
+	}
+	if (!ValidArrival(reqOpts.Arrival)) {
+		return reqOpts, errors.New(fmt.Sprintf("Unknown arrival '%v', expected '%v', '%v' or '%v'", reqOpts.Arrival, ClosedArrival, ConstantArrival, PoissonArrival))
+	}
+
+	if (reqOpts.Overflow == "") {
+		reqOpts.Overflow = DefaultRequestOptions.Overflow
+	}
+	if (!ValidOverflow(reqOpts.Overflow)) {
+		return reqOpts, errors.New(fmt.Sprintf("Unknown overflow '%v', expected '%v' or '%v'", reqOpts.Overflow, DelayOverflow, DropOverflow))
+	}
+
+	if (reqOpts.Search == "") {
+		reqOpts.Search = DefaultRequestOptions.Search
+	}
+	if (!ValidSearch(reqOpts.Search)) {
+		return reqOpts, errors.New(fmt.Sprintf("Unknown search '%v', expected '%v' or '%v'", reqOpts.Search, StepSearch, BinarySearch))
+	}
+
+	if (reqOpts.Concurrency == 0) {
+		reqOpts.Concurrency = DefaultRequestOptions.Concurrency
+	}
+	if (reqOpts.MaxConcurrency < reqOpts.Concurrency) {
+		reqOpts.MaxConcurrency = reqOpts.Concurrency
+	}
+	if (len(reqOpts.Percentiles) == 0) {
+		reqOpts.Percentiles = DefaultRequestOptions.Percentiles
+	}
+	if (len(reqOpts.ResponseCodes) == 0) {
+		reqOpts.ResponseCodes = DefaultRequestOptions.ResponseCodes
+	}
+
+	//A profile runs for its own duration, following its rates as an open model, unless the time or requests to issue are set
+	if (reqOpts.ProfileSpec != "" && reqOpts.Profile == nil) {
+		reqOpts.Profile, err = ParseLoadProfile(reqOpts.ProfileSpec, reqOpts.Concurrency)
+		if (err != nil) {
+			return reqOpts, err
+		}
+	}
+	if (reqOpts.Profile != nil) {
+		if (reqOpts.MaxExecutionTime == 0 && reqOpts.MaxExecutionSecs == 0) {
+			reqOpts.MaxExecutionSecs = int(math.Ceil(reqOpts.Profile.Duration().Seconds()))
+		}
+		if (reqOpts.RequestsToIssue == 0) {
+			reqOpts.RequestsToIssue = math.MaxInt32
+		}
+		if (reqOpts.Profile.HasTargetType(RateTarget) && reqOpts.Arrival == ClosedArrival) {
+			reqOpts.Arrival = ConstantArrival
+		}
+	}
+	if (reqOpts.RequestsToIssue == 0) {
+		reqOpts.RequestsToIssue = DefaultRequestOptions.RequestsToIssue
+	}
+
+	if (reqOpts.Samples == "") {
+		reqOpts.Samples = DefaultRequestOptions.Samples
+	}
+	reqOpts.SampleRate, err = parseSamples("samples", reqOpts.Samples)
+	if (err != nil) {
+		return reqOpts, err
+	}
+	if (reqOpts.Validation == "") {
+		reqOpts.Validation = DefaultRequestOptions.Validation
+	}
+	reqOpts.ValidationRate, err = parseSamples("validate", reqOpts.Validation)
+	if (err != nil) {
+		return reqOpts, err
+	}
+	if (reqOpts.JSONSchema != "" && reqOpts.Schema == nil) {
+		reqOpts.Schema, err = CompileSchema(reqOpts.JSONSchema)
+		if (err != nil) {
+			return reqOpts, err
+		}
+	}
+
+	reqOpts.MaxExecutionTime = durationOrDefault(reqOpts.MaxExecutionTime, reqOpts.MaxExecutionSecs, DefaultRequestOptions.MaxExecutionSecs, time.Second)
+	reqOpts.WarmUpTime = durationOrDefault(reqOpts.WarmUpTime, reqOpts.WarmUpSecs, 0, time.Second)
+	reqOpts.AnalaysisFreqTime = durationOrDefault(reqOpts.AnalaysisFreqTime, reqOpts.AnalaysisFreqMs, DefaultRequestOptions.AnalaysisFreqMs, time.Millisecond)
+	reqOpts.RenderFrequency = durationOrDefault(reqOpts.RenderFrequency, reqOpts.RenderFrequencyMs, DefaultRequestOptions.RenderFrequencyMs, time.Millisecond)
+	if (reqOpts.Timeout == 0) {
+		reqOpts.Timeout = DefaultRequestOptions.Timeout
+	}
+	if (reqOpts.KeepAlive == 0) {
+		reqOpts.KeepAlive = DefaultRequestOptions.KeepAlive
+	}
+	if (reqOpts.TLSHandshakeTimeout == 0) {
+		reqOpts.TLSHandshakeTimeout = DefaultRequestOptions.TLSHandshakeTimeout
+	}
+
+	if (reqOpts.ScriptPath != "" && reqOpts.Script == nil) {
+		reqOpts.Script, err = LoadScript(reqOpts.ScriptPath)
+		if (err != nil) {
+			return reqOpts, err
+		}
+	}
+
+	if (reqOpts.FeederFile != "" && reqOpts.Feeder == nil) {
+		if (reqOpts.FeederStrategy == "") {
+			reqOpts.FeederStrategy = SequentialFeeder
+		}
+		if (reqOpts.FeederExhausted == "") {
+			reqOpts.FeederExhausted = WrapWhenExhausted
+		}
+		reqOpts.Feeder, err = LoadFeeder(reqOpts.FeederFile, reqOpts.FeederStrategy, reqOpts.FeederExhausted)
+		if (err != nil) {
+			return reqOpts, err
+		}
+	}
+	if (reqOpts.Feeder != nil) {
+		err = reqOpts.Feeder.CheckExecutors(maxExecutors(reqOpts))
+		if (err != nil) {
+			return reqOpts, err
+		}
+	}
+
+	if (len(reqOpts.Requests) == 0) {
+		if (reqOpts.RequestsFile != "") {
+			reqOpts.Requests, err = LoadRequestDefinitions(reqOpts.RequestsFile, reqOpts)
+			if (err != nil) {
+				return reqOpts, err
+			}
+		} else {
+			definition, err := DefaultRequestDefinition(reqOpts)
+			if (err != nil) {
+				return reqOpts, err
+			}
+			reqOpts.Requests = []RequestDefinition{definition}
+		}
+	}
+
+	return reqOpts, nil
+}
+
+//maxExecutors is the largest the executor pool can get, the closed model keeps it at Concurrency unless the profile changes it
+func maxExecutors(reqOpts RequestOptions) int {
+	executors := reqOpts.Concurrency
+	if (reqOpts.Arrival != ClosedArrival) {
+		executors = reqOpts.MaxConcurrency
+	}
+	if (reqOpts.Profile != nil) {
+		for _, stage := range reqOpts.Profile.Stages {
+			if (stage.TargetType == ConcurrencyTarget && int(stage.Target) > executors) {
+				executors = int(stage.Target)
+			}
+		}
+	}
+	return executors
+}
+
+//durationOrDefault keeps a duration that's been set, otherwise it's count units, or defaultCount units when count is zero too
+func durationOrDefault(duration time.Duration, count int, defaultCount int, unit time.Duration) time.Duration {
+	if (duration != 0) {
+		return duration
+	}
+	if (count == 0) {
+		count = defaultCount
+	}
+	return time.Duration(count) * unit
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	c.Convey("With a server under test", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, `{"ok": true}`)
+		}))
+		defer server.Close()
+
+		plan := NewPlan(server.URL)
+		plan.RequestOptions.RequestsToIssue = 20
+		plan.RequestOptions.WarmUpSecs = 0
+		plan.RequestOptions.Throughput = 0
+
+		c.Convey("A plan runs in process and returns the final stats", func(){
+			result, err := Run(context.Background(), plan)
+			c.So(err, c.ShouldBeNil)
+			c.So(result.Passed, c.ShouldBeTrue)
+			c.So(result.ExitCode, c.ShouldEqual, ExitPassed)
+			c.So(result.Stats.TotalRequests, c.ShouldEqual, 20)
+			c.So(result.Stats.TotalValidResponses, c.ShouldEqual, 20)
+			c.So(result.Report().Requests.Issued, c.ShouldEqual, 20)
+		})
+
+		c.Convey("Cancelling the context stops the test with the stats so far", func(){
+			plan.RequestOptions.RequestsToIssue = 1000000
+			plan.RequestOptions.Rate = 50
+			plan.RequestOptions.Arrival = ConstantArrival
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 700)
+			defer cancel()
+
+			started := time.Now()
+			result, err := Run(ctx, plan)
+			c.So(err == context.DeadlineExceeded, c.ShouldBeTrue)
+			c.So(time.Since(started), c.ShouldBeLessThan, time.Second * 5)
+			c.So(result.Aborted, c.ShouldBeTrue)
+			c.So(result.ExitCode, c.ShouldEqual, ExitAborted)
+			c.So(result.Stats.TotalRequests, c.ShouldBeGreaterThan, 0)
+		})
+
+		c.Convey("Options left unset expect the default status code", func(){
+			result, err := Run(context.Background(), Plan{RequestOptions : RequestOptions{URL : server.URL, RequestsToIssue : 10}})
+			c.So(err, c.ShouldBeNil)
+			c.So(result.Stats.TotalValidResponses, c.ShouldEqual, 10)
+			c.So(result.Stats.FailureCounts, c.ShouldBeEmpty)
+		})
+
+		c.Convey("Samples are parsed into the rate raw stats are kept at", func(){
+			result, err := Run(context.Background(), Plan{RequestOptions : RequestOptions{URL : server.URL, RequestsToIssue : 10, Samples : "all"}})
+			c.So(err, c.ShouldBeNil)
+			c.So(len(result.Stats.RawStats), c.ShouldEqual, 10)
+
+			_, err = Run(context.Background(), Plan{RequestOptions : RequestOptions{URL : server.URL, Samples : "some"}})
+			c.So(err, c.ShouldNotBeNil)
+		})
+
+		c.Convey("A rate profile runs for its own duration as an open model", func(){
+			started := time.Now()
+			result, err := Run(context.Background(), Plan{RequestOptions : RequestOptions{URL : server.URL, ProfileSpec : "step 20rps 1s"}})
+			c.So(err, c.ShouldBeNil)
+			c.So(time.Since(started), c.ShouldBeLessThan, time.Second * 3)
+			c.So(result.Stats.TotalRequests, c.ShouldBeBetween, 10, 30)
+			c.So(result.Stats.TargetRate, c.ShouldEqual, 20)
+		})
+
+		c.Convey("No goroutine is left running once a test has finished or been cancelled", func(){
+			before := runtime.NumGoroutine()
+			_, err := Run(context.Background(), plan)
+			c.So(err, c.ShouldBeNil)
+
+			plan.RequestOptions.RequestsToIssue = 1000000
+			plan.RequestOptions.ProfileSpec = "ramp 100rps 10s"
+			plan.RequestOptions.MaxConcurrency = 20
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 500)
+			defer cancel()
+			_, err = Run(ctx, plan)
+			c.So(err == context.DeadlineExceeded, c.ShouldBeTrue)
+
+			//The server's side of the closed connections can take a moment to exit
+			deadline := time.Now().Add(time.Second)
+			for (runtime.NumGoroutine() > before && time.Now().Before(deadline)) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			c.So(runtime.NumGoroutine(), c.ShouldBeLessThanOrEqualTo, before)
+		})
+
+		c.Convey("Invalid options are returned as an error without running", func(){
+			plan.RequestOptions.Arrival = "burst"
+			result, err := Run(context.Background(), plan)
+			c.So(err, c.ShouldNotBeNil)
+			c.So(result, c.ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+//receiveRequests reads requests off the spawner's channel until none arrive for quiet
+func receiveRequests(spawner *Spawner, quiet time.Duration, received func(request ScheduledRequest)) {
+	for {
+		select {
+		case request, open := <- spawner.RequestChan:
+			if (!open) { return }
+			received(request)
+		case <- time.After(quiet):
+			return
+		}
+	}
+}
+
+func TestClosedLoop(t *testing.T) {
+	c.Convey("Requests an executor skips are issued again, so the closed loop still issues RequestsToIssue", t, func(){
+		reqOpts := RequestOptions{RequestsToIssue : 5, Arrival : ClosedArrival, Requests : []RequestDefinition{{Label : "login", URL : "http://localhost"}}}
+		spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+		spawner.StartTime = time.Now()
+		spawner.StartRequests()
+
+		received := 0
+		receiveRequests(spawner, time.Millisecond * 200, func(request ScheduledRequest) {
+			received += 1
+			if (received <= 2) {
+				spawner.unissue(request.Definition)
+			}
+		})
+		spawner.background.Wait()
+
+		issued, _ := spawner.IssuedAndDropped()
+		c.So(received, c.ShouldEqual, 7)
+		c.So(issued, c.ShouldEqual, 5)
+		c.So(spawner.Selector.Issued()["login"], c.ShouldEqual, 5)
+	})
+}
+
+func TestScheduledRequests(t *testing.T) {
+	c.Convey("With an open model spawner and no executors of its own", t, func(){
+		reqOpts := RequestOptions{
+			RequestsToIssue : 10,
+			MaxExecutionTime : time.Minute,
+			Rate : 100,
+			Arrival : ConstantArrival,
+			Overflow : DelayOverflow,
+			Requests : []RequestDefinition{{Label : "items", URL : "http://localhost"}},
+		}
+
+		c.Convey("Constant arrivals are evenly spaced at the rate and sent on time", func(){
+			spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+			spawner.Start()
+			intended := []time.Time{}
+			receiveRequests(spawner, time.Millisecond * 300, func(request ScheduledRequest) {
+				intended = append(intended, request.IntendedTime)
+			})
+			spawner.Stop()
+
+			c.So(len(intended), c.ShouldEqual, 10)
+			for index := 1; index < len(intended); index++ {
+				c.So(intended[index].Sub(intended[index - 1]), c.ShouldEqual, time.Millisecond * 10)
+			}
+			overall := spawner.CurrentOverallStats()
+			c.So(overall.RequestsIssued, c.ShouldEqual, 10)
+			c.So(overall.RequestsScheduled, c.ShouldEqual, 10)
+			//A busy machine can fire a timer late now and then, but evenly spaced arrivals with a free receiver aren't delayed as a rule
+			c.So(overall.RequestsDelayed, c.ShouldBeLessThanOrEqualTo, 2)
+		})
+
+		c.Convey("Poisson arrivals vary but keep the mean rate", func(){
+			reqOpts.Arrival = PoissonArrival
+			reqOpts.Rate = 500
+			reqOpts.RequestsToIssue = 200
+			spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+			spawner.Start()
+			intended := []time.Time{}
+			receiveRequests(spawner, time.Millisecond * 300, func(request ScheduledRequest) {
+				intended = append(intended, request.IntendedTime)
+			})
+			spawner.Stop()
+
+			c.So(len(intended), c.ShouldEqual, 200)
+			gaps := map[time.Duration]bool{}
+			for index := 1; index < len(intended); index++ {
+				gaps[intended[index].Sub(intended[index - 1])] = true
+			}
+			meanGap := intended[len(intended) - 1].Sub(intended[0]) / time.Duration(len(intended) - 1)
+			c.So(meanGap, c.ShouldBeBetween, time.Microsecond * 1500, time.Microsecond * 2500)
+			c.So(len(gaps), c.ShouldBeGreaterThan, 100)
+		})
+
+		c.Convey("With nothing to take them and drop overflow every arrival is dropped", func(){
+			reqOpts.Overflow = DropOverflow
+			reqOpts.RequestsToIssue = 1000000
+			spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+			spawner.Start()
+			time.Sleep(time.Millisecond * 300)
+			spawner.Stop()
+
+			overall := spawner.CurrentOverallStats()
+			c.So(overall.RequestsScheduled, c.ShouldBeGreaterThanOrEqualTo, 10)
+			c.So(overall.RequestsDropped, c.ShouldEqual, overall.RequestsScheduled)
+			c.So(overall.RequestsIssued, c.ShouldEqual, 0)
+			c.So(spawner.Selector.Issued()["items"], c.ShouldEqual, 0)
+		})
+
+		c.Convey("With delay overflow the arrivals queued behind a blocked one are delayed too", func(){
+			reqOpts.RequestsToIssue = 30
+			spawner := NewSpawner(make(chan ResponseStats), make(chan OverallStats), reqOpts)
+			spawner.Start()
+			time.Sleep(time.Millisecond * 150)
+			received := 0
+			receiveRequests(spawner, time.Millisecond * 300, func(request ScheduledRequest) {
+				received += 1
+			})
+			spawner.Stop()
+
+			overall := spawner.CurrentOverallStats()
+			c.So(received, c.ShouldEqual, 30)
+			c.So(overall.RequestsIssued, c.ShouldEqual, 30)
+			c.So(overall.RequestsDropped, c.ShouldEqual, 0)
+			c.So(overall.RequestsDelayed, c.ShouldBeGreaterThanOrEqualTo, 10)
+			c.So(overall.RequestsDelayed, c.ShouldBeLessThan, 30)
+			c.So(overall.TotalDelay, c.ShouldBeGreaterThan, time.Millisecond * 100)
+		})
+	})
+
+	c.Convey("When the executors can't keep up the pool grows to MaxConcurrency and then requests are delayed", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(time.Millisecond * 100)
+		}))
+		defer server.Close()
+
+		reqOpts := RequestOptions{
+			URL : server.URL,
+			Method : "GET",
+			ResponseCodes : OnlyStatusCode(200),
+			Timeout : time.Second,
+			RequestsToIssue : 1000000,
+			MaxExecutionTime : time.Minute,
+			Rate : 50,
+			Arrival : ConstantArrival,
+			Overflow : DelayOverflow,
+			Concurrency : 1,
+			MaxConcurrency : 3,
+		}
+		definition, err := DefaultRequestDefinition(reqOpts)
+		c.So(err, c.ShouldBeNil)
+		reqOpts.Requests = []RequestDefinition{definition}
+
+		statsChan := make(chan ResponseStats)
+		go func() {
+			for _ = range statsChan {}
+		}()
+		spawner := NewSpawner(statsChan, make(chan OverallStats), reqOpts)
+		spawner.Start()
+		time.Sleep(time.Millisecond * 500)
+		overall := spawner.CurrentOverallStats()
+		spawner.Stop()
+		close(statsChan)
+
+		c.So(overall.NumExecutors, c.ShouldEqual, 3)
+		c.So(overall.RequestsDelayed, c.ShouldBeGreaterThan, 0)
+		c.So(overall.RequestsDropped, c.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,302 @@
+package lib
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+//Script is a Lua script compiled once at startup, each executor runs it in its own Lua state.
+//The script can define before(request) to change a request before it's sent,
+//and after(request, response) to make assertions, returning false and a message or raising an error fails the request.
+//Both can read and write the global vars table, which holds the chain's extracted values.
+type Script struct {
+	Location string
+	proto *lua.FunctionProto
+}
+
+//ScriptRequest is the part of a request a before hook can change
+type ScriptRequest struct {
+	Method string
+	URL string
+	Headers map[string]string
+	Payload []byte
+}
+
+func LoadScript(location string) (script *Script, err error) {
+	file, err := os.Open(location)
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not load script at %v err: %v", location, err))
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(file, location)
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not parse script at %v err: %v", location, err))
+	}
+	proto, err := lua.Compile(chunk, location)
+	if (err != nil) {
+		return nil, errors.New(fmt.Sprintf("Could not compile script at %v err: %v", location, err))
+	}
+
+	return &Script{
+		Location : location,
+		proto : proto,
+	}, nil
+}
+
+type ScriptError struct {
+	DisplayableError
+	Location string
+	Hook string
+	err error
+}
+
+func NewScriptError(location string, hook string, err error) *ScriptError {
+	return &ScriptError{
+		Location : location,
+		Hook : hook,
+		err : err,
+		DisplayableError: DisplayableError{category : "Script",},
+	}
+}
+
+func (e ScriptError) Error() string {
+	return fmt.Sprintf("Script %v failed in %v, %v", e.Location, e.Hook, e.err.Error())
+}
+
+func (e ScriptError) Description() string {
+	return "A script run before or after the request failed"
+}
+
+func (e ScriptError) Category() string {
+	return e.category
+}
+
+//defaultScriptTimeout is how long a hook can run when the runner isn't given a Timeout
+const defaultScriptTimeout = time.Second * 10
+
+//ScriptRunner holds the Lua states for one executor, Lua states can't be shared between goroutines
+type ScriptRunner struct {
+	//Context cancels any hook that's running when it's done, and each hook, including the script's setup, is stopped after Timeout.
+	//A hook that's stopped fails the request with a ScriptError.
+	Context context.Context
+	Timeout time.Duration
+
+	states map[*Script]*lua.LState
+}
+
+func NewScriptRunner() *ScriptRunner {
+	return &ScriptRunner{
+		states : make(map[*Script]*lua.LState),
+	}
+}
+
+func (s *ScriptRunner) state(script *Script) (*lua.LState, error) {
+	if state, ok := s.states[script]; ok {
+		return state, nil
+	}
+
+	state := lua.NewState()
+	registerScriptHelpers(state)
+	state.Push(state.NewFunctionFromProto(script.proto))
+	ctx, cancel := s.limit(state)
+	err := state.PCall(0, lua.MultRet, nil)
+	cancel()
+	if (err != nil) {
+		state.Close()
+		return nil, s.stoppedError(ctx, err)
+	}
+
+	s.states[script] = state
+	return state, nil
+}
+
+//limit makes the state stop running once Context is done or Timeout has passed, cancel must be called once the state has returned
+func (s *ScriptRunner) limit(state *lua.LState) (ctx context.Context, cancel func()) {
+	parent := s.Context
+	if (parent == nil) {
+		parent = context.Background()
+	}
+	ctx, cancelTimeout := context.WithTimeout(parent, s.timeout())
+	state.SetContext(ctx)
+	return ctx, func() {
+		state.RemoveContext()
+		cancelTimeout()
+	}
+}
+
+func (s *ScriptRunner) timeout() time.Duration {
+	if (s.Timeout <= 0) {
+		return defaultScriptTimeout
+	}
+	return s.Timeout
+}
+
+//stoppedError explains an error from a state that was stopped by limit, other errors are returned as they are
+func (s *ScriptRunner) stoppedError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return errors.New(fmt.Sprintf("it didn't finish within %v", s.timeout()))
+	case context.Canceled:
+		return errors.New("it was cancelled as the test stopped")
+	}
+	return err
+}
+
+//Close closes the Lua states, the runner can't be used afterwards
+func (s *ScriptRunner) Close() {
+	for script, state := range s.states {
+		state.Close()
+		delete(s.states, script)
+	}
+}
+
+//Before runs the script's before hook, if it has one, letting it change the request and vars
+func (s *ScriptRunner) Before(script *Script, request *ScriptRequest, vars map[string]string) (err DescriptiveError) {
+	state, stateErr := s.state(script)
+	if (stateErr != nil) {
+		return *NewScriptError(script.Location, "setup", stateErr)
+	}
+
+	hook := state.GetGlobal("before")
+	if (hook.Type() != lua.LTFunction) {
+		return nil
+	}
+
+	requestTable := state.NewTable()
+	requestTable.RawSetString("method", lua.LString(request.Method))
+	requestTable.RawSetString("url", lua.LString(request.URL))
+	requestTable.RawSetString("headers", stringMapToTable(state, request.Headers))
+	requestTable.RawSetString("body", lua.LString(string(request.Payload)))
+
+	failure := s.call(state, script, "before", hook, vars, requestTable)
+	if (failure != nil) {
+		return failure
+	}
+
+	request.Method = lua.LVAsString(requestTable.RawGetString("method"))
+	request.URL = lua.LVAsString(requestTable.RawGetString("url"))
+	request.Payload = []byte(lua.LVAsString(requestTable.RawGetString("body")))
+	if headersTable, ok := requestTable.RawGetString("headers").(*lua.LTable); ok {
+		request.Headers = tableToStringMap(headersTable)
+	}
+	return nil
+}
+
+//After runs the script's after hook, if it has one, with the response so it can make assertions and set vars
+func (s *ScriptRunner) After(script *Script, request *http.Request, reqPayload string, resp *http.Response, respPayload string, totalTime time.Duration, vars map[string]string) (err DescriptiveError) {
+	state, stateErr := s.state(script)
+	if (stateErr != nil) {
+		return *NewScriptError(script.Location, "setup", stateErr)
+	}
+
+	hook := state.GetGlobal("after")
+	if (hook.Type() != lua.LTFunction) {
+		return nil
+	}
+
+	requestTable := state.NewTable()
+	requestTable.RawSetString("method", lua.LString(request.Method))
+	requestTable.RawSetString("url", lua.LString(request.URL.String()))
+	requestTable.RawSetString("headers", headerToTable(state, request.Header))
+	requestTable.RawSetString("body", lua.LString(reqPayload))
+
+	responseTable := state.NewTable()
+	responseTable.RawSetString("status", lua.LNumber(resp.StatusCode))
+	responseTable.RawSetString("headers", headerToTable(state, resp.Header))
+	responseTable.RawSetString("body", lua.LString(respPayload))
+	responseTable.RawSetString("time", lua.LNumber(totalTime.Seconds()))
+
+	return s.call(state, script, "after", hook, vars, requestTable, responseTable)
+}
+
+func (s *ScriptRunner) call(state *lua.LState, script *Script, hookName string, hook lua.LValue, vars map[string]string, args ...lua.LValue) (err DescriptiveError) {
+	varsTable := stringMapToTable(state, vars)
+	state.SetGlobal("vars", varsTable)
+
+	ctx, cancel := s.limit(state)
+	callErr := state.CallByParam(lua.P{
+		Fn : hook,
+		NRet : 2,
+		Protect : true,
+	}, args...)
+	cancel()
+	if (callErr != nil) {
+		if (ctx.Err() != nil) {
+			//A hook stopped part way can leave the state's globals half updated, so the next request starts from a new state
+			state.Close()
+			delete(s.states, script)
+		}
+		return *NewScriptError(script.Location, hookName, s.stoppedError(ctx, callErr))
+	}
+
+	ok := state.Get(-2)
+	msg := state.Get(-1)
+	state.Pop(2)
+
+	varsTable.ForEach(func(key lua.LValue, value lua.LValue) {
+		vars[lua.LVAsString(key)] = lua.LVAsString(value)
+	})
+
+	if (ok == lua.LFalse) {
+		return *NewScriptError(script.Location, hookName, errors.New(lua.LVAsString(msg)))
+	}
+	return nil
+}
+
+//registerScriptHelpers adds functions scripts commonly need to sign requests
+func registerScriptHelpers(state *lua.LState) {
+	state.SetGlobal("hmac_sha256", state.NewFunction(func(L *lua.LState) int {
+		mac := hmac.New(sha256.New, []byte(L.CheckString(1)))
+		mac.Write([]byte(L.CheckString(2)))
+		L.Push(lua.LString(hex.EncodeToString(mac.Sum(nil))))
+		return 1
+	}))
+	state.SetGlobal("sha256", state.NewFunction(func(L *lua.LState) int {
+		sum := sha256.Sum256([]byte(L.CheckString(1)))
+		L.Push(lua.LString(hex.EncodeToString(sum[:])))
+		return 1
+	}))
+	state.SetGlobal("base64", state.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(base64.StdEncoding.EncodeToString([]byte(L.CheckString(1)))))
+		return 1
+	}))
+	state.SetGlobal("now", state.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(time.Now().Unix()))
+		return 1
+	}))
+}
+
+func stringMapToTable(state *lua.LState, values map[string]string) *lua.LTable {
+	table := state.NewTable()
+	for key, value := range values {
+		table.RawSetString(key, lua.LString(value))
+	}
+	return table
+}
+
+func headerToTable(state *lua.LState, header http.Header) *lua.LTable {
+	table := state.NewTable()
+	for key := range header {
+		table.RawSetString(key, lua.LString(header.Get(key)))
+	}
+	return table
+}
+
+func tableToStringMap(table *lua.LTable) map[string]string {
+	values := make(map[string]string)
+	table.ForEach(func(key lua.LValue, value lua.LValue) {
+		values[lua.LVAsString(key)] = lua.LVAsString(value)
+	})
+	return values
+}
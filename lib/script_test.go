@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const signingScript = `
+function before(request)
+	request.headers["X-Signature"] = hmac_sha256("key", request.body)
+end
+
+function after(request, response)
+	vars["seen"] = response.body
+	if response.status ~= 200 then
+		return false, "unexpected status " .. response.status
+	end
+end
+`
+
+func TestScriptHooks(t *testing.T) {
+	c.Convey("With a server that checks a signature", t, func(){
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if (req.Header.Get("X-Signature") == "") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, "signed")
+		}))
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "deathstar")
+		c.So(err, c.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		location := filepath.Join(dir, "sign.lua")
+		c.So(ioutil.WriteFile(location, []byte(signingScript), 0644), c.ShouldBeNil)
+
+		reqOpts := RequestOptions{
+			Timeout : time.Second,
+		}
+		definition := RequestDefinition{
+			Method : "POST",
+			URL : server.URL,
+			Body : []byte(`"payload"`),
+			ResponseCodes : OnlyStatusCode(200),
+			ScriptPath : location,
+		}
+		c.So(definition.applyDefaults(reqOpts), c.ShouldBeNil)
+		recorder := NewRequestRecorder(reqOpts)
+
+		c.Convey("The before hook can sign the request and the after hook can set vars", func(){
+			vars := make(map[string]string)
+			stats, _ := recorder.PerformRequest(&definition, vars)
+			c.So(stats.Failure(), c.ShouldBeFalse)
+			c.So(vars["seen"], c.ShouldEqual, "signed")
+		})
+
+		c.Convey("An assertion failing in the after hook is a script failure", func(){
+			definition.ResponseCodes = OnlyStatusCode(403)
+			definition.Script, err = LoadScript(location)
+			c.So(err, c.ShouldBeNil)
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			})
+
+			stats, _ := recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(stats.Failure(), c.ShouldBeTrue)
+			c.So(stats.Failures[0].Category(), c.ShouldEqual, "Script")
+			c.So(ContainsResponse(stats), c.ShouldBeTrue)
+		})
+
+		c.Convey("A hook that never returns is stopped after the timeout, or when the context is cancelled", func(){
+			looping := filepath.Join(dir, "loop.lua")
+			c.So(ioutil.WriteFile(looping, []byte("function before(request)\n\twhile true do end\nend\n"), 0644), c.ShouldBeNil)
+			definition.Script, err = LoadScript(looping)
+			c.So(err, c.ShouldBeNil)
+			recorder.Scripts.Timeout = time.Millisecond * 100
+
+			started := time.Now()
+			stats, _ := recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(time.Since(started), c.ShouldBeLessThan, time.Second)
+			c.So(stats.Failures[0].Category(), c.ShouldEqual, "Script")
+			c.So(stats.Failures[0].Error(), c.ShouldContainSubstring, "didn't finish within 100ms")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			recorder.Scripts.Context = ctx
+			recorder.Scripts.Timeout = time.Minute
+			time.AfterFunc(time.Millisecond * 100, cancel)
+			stats, _ = recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(stats.Failures[0].Error(), c.ShouldContainSubstring, "cancelled")
+		})
+
+		c.Convey("Closing the runner closes its Lua states", func(){
+			recorder.PerformRequest(&definition, make(map[string]string))
+			c.So(len(recorder.Scripts.states), c.ShouldEqual, 1)
+			recorder.Scripts.Close()
+			c.So(recorder.Scripts.states, c.ShouldBeEmpty)
+		})
+	})
+}
@@ -1,11 +1,13 @@
 package lib
 
 import (
+	"context"
 	"time"
 	"fmt"
 	"net/http"
 	"sync"
 	"runtime"
+	"math/rand"
 )
 
 //Spawner is responsible for initiating requests on a channel at a specific rate
@@ -18,33 +20,84 @@ type Spawner struct {
 	ReqLimitMode string
 	Concurrency int
 
+	//Arrival, MaxConcurrency and Overflow control open model scheduling, see StartScheduledRequests
+	Arrival string
+	MaxConcurrency int
+	Overflow string
+
+	//Profile changes the rate and concurrency over the course of the test, see followProfile
+	Profile *LoadProfile
+	ProfileTicker *time.Ticker
+	TargetRate float64
+	TargetConcurrency int
+
 	ExecutorPool []*Executor
-	Ticker *time.Ticker
 	OverallTicker *time.Ticker
 	TimeoutTimer *time.Timer
 	StartTime time.Time
-	StopTime time.Time
 
-	RequestChan chan bool
+	Selector *RequestSelector
+
+	RequestChan chan ScheduledRequest
 	StatsChan chan ResponseStats
 	OverallStatsChan chan OverallStats
 	Done chan bool
 
 	Started bool
-	Stopped bool
 	CustomClient *http.Client
 
-	mu sync.Mutex
+	//Context is handed to every executor, cancelling it cancels the requests in flight
+	Context context.Context
+
+	//quit is closed when the spawner stops, to end the goroutines in background that schedule requests and send stats
+	quit chan bool
+	background sync.WaitGroup
+	stopOnce sync.Once
+
+	//scheduleMu guards Stopped, StopTime and the counts of requests, as the scheduler, executors and analysis all use them
+	scheduleMu sync.Mutex
+	Stopped bool
+	StopTime time.Time
 	RequestsIssued int
+	RequestsScheduled int
+	RequestsDelayed int
+	RequestsDropped int
+	TotalDelay time.Duration
+
+	rateSamples []rateSample
+
+	poolMu sync.Mutex
+	executorsAdded int
+	//running counts the executors that haven't exited, including those retired from the pool that are finishing a request
+	running sync.WaitGroup
+
+	TemplateSequence uint64
+}
+
+//ScheduledRequest is a request handed to an executor along with the time the spawner meant it to be sent
+type ScheduledRequest struct {
+	Definition *RequestDefinition
+	IntendedTime time.Time
 }
 
 type ResponseStats struct {
+	Label string
+
+	//Steps holds the stats for each step issued when the request was a chain
+	Steps []ResponseStats
+
+	//IntendedTime is when the spawner meant the request to be sent, it's zero for the steps of a chain
+	IntendedTime time.Time
 	StartTime time.Time
 	FinishTime time.Time
 
 	TimeToConnect time.Duration
 	TimeToRespond time.Duration
 	TotalTime time.Duration
+	Phases RequestPhases
+
+	//StatusCode of the response, 0 when there wasn't one, or of the last step issued for a chain
+	StatusCode int
 
 	Failures []DescriptiveError
 
@@ -52,6 +105,27 @@ type ResponseStats struct {
 	RespPayload string
 }
 
+//ResponseBytes is the size of the response payload, or of every step's response payload for a chain
+func (r *ResponseStats) ResponseBytes() int {
+	if (len(r.Steps) == 0) {
+		return len([]byte(r.RespPayload))
+	}
+	total := 0
+	for _, step := range r.Steps {
+		total += len([]byte(step.RespPayload))
+	}
+	return total
+}
+
+//ResponseTime is the latency measured from the intended send time rather than the actual one,
+//so time spent waiting for a busy executor is counted. TotalTime is the service time.
+func (r *ResponseStats) ResponseTime() time.Duration {
+	if (r.IntendedTime.IsZero() || r.IntendedTime.After(r.StartTime)) {
+		return r.TotalTime
+	}
+	return r.TotalTime + r.StartTime.Sub(r.IntendedTime)
+}
+
 func (r *ResponseStats) Failure() bool {
 	if (len(r.Failures) > 0) {
 		return true
@@ -62,25 +136,63 @@ func (r *ResponseStats) Failure() bool {
 type OverallStats struct {
 	Rate float64
 
+	//TargetRate is the rate the load profile asked for and AchievedRate the rate requests were issued at over the last second
+	TargetRate float64
+	AchievedRate float64
+	TargetConcurrency int
+
 	StartTime time.Time
 	TotalTestDuration time.Duration
 	TimeElapsed time.Duration
 	TimeWaitingOnFinalReqs time.Duration
 
 	RequestsIssued int
+	RequestsIssuedByLabel map[string]int
+
+	//Open model scheduling, requests that were scheduled but were sent late or dropped, see recordIssued
+	RequestsScheduled int
+	RequestsDelayed int
+	RequestsDropped int
+	TotalDelay time.Duration
 
 	NumExecutors int
 	NumBusyExecutors int
 	NumAvailableExecutors int
 }
 
-const tickerSecFrequency = 1
 const overallStatsTickerFrequency = 100
+const achievedRateWindow = time.Second
+//scheduleTolerance is how late a scheduled request can be sent and still be on time, as timers fire a little after they're due
+const scheduleTolerance = time.Millisecond * 5
+
+type rateSample struct {
+	Time time.Time
+	RequestsIssued int
+}
+
+const (
+	ClosedArrival = "closed"
+	ConstantArrival = "constant"
+	PoissonArrival = "poisson"
+
+	DelayOverflow = "delay"
+	DropOverflow = "drop"
+)
+
+func ValidArrival(arrival string) bool {
+	return arrival == ClosedArrival || arrival == ConstantArrival || arrival == PoissonArrival
+}
+
+func ValidOverflow(overflow string) bool {
+	return overflow == DelayOverflow || overflow == DropOverflow
+}
 
 func NewSpawner(responseStatsChan chan ResponseStats, overallStatsChan chan OverallStats, reqOpts RequestOptions) *Spawner {
 	return &Spawner{
-		RequestChan : make(chan bool),
+		RequestChan : make(chan ScheduledRequest),
+		Selector : NewRequestSelector(reqOpts.Requests, reqOpts.Selection),
 		Done : make(chan bool),
+		quit : make(chan bool),
 		StatsChan: responseStatsChan,
 		OverallStatsChan: overallStatsChan,
 
@@ -89,6 +201,12 @@ func NewSpawner(responseStatsChan chan ResponseStats, overallStatsChan chan Over
 		RequestsToIssue : reqOpts.RequestsToIssue,
 		RequestOptions : reqOpts,
 		Concurrency : reqOpts.Concurrency,
+		Arrival : reqOpts.Arrival,
+		MaxConcurrency : reqOpts.MaxConcurrency,
+		Overflow : reqOpts.Overflow,
+		Profile : reqOpts.Profile,
+		TargetRate : reqOpts.Rate,
+		TargetConcurrency : reqOpts.Concurrency,
 	}
 }
 
@@ -108,6 +226,8 @@ func (s *Spawner) Start () {
 
 	s.SetupExecutorPool()
 
+	s.SetupProfile()
+
 	s.SetupOverallStatsPipe()
 
 	s.SetupTimeout()
@@ -122,124 +242,421 @@ func (s *Spawner) Start () {
 func (s *Spawner) SetupTimeout() {
 	s.TimeoutTimer = time.NewTimer(s.MaxExecutionTime)
 	Log("spawn", fmt.Sprintln("Timeout timer has started, and will trigger in ",s.MaxExecutionTime) )
+	s.background.Add(1)
 	go func () {
-		for _ = range s.TimeoutTimer.C {
+		defer s.background.Done()
+		select {
+		case <- s.TimeoutTimer.C:
 			Log("spawn", fmt.Sprintln("Timed out, ",time.Now()) )
-			s.Stop()
-			s.Done <- true
+			select {
+			case s.Done <- true:
+			case <- s.quit:
+			}
+		case <- s.quit:
 		}
 	}()
 }
 
-func (s *Spawner) Cleanup() {
-	s.SendOverallStats()
+//Cleanup returns the final overall stats, for the caller to record before the final analysis
+func (s *Spawner) Cleanup() OverallStats {
+	return s.CurrentOverallStats()
 }
 
+//Stop stops issuing requests and waits for the executors and every goroutine of the spawner to exit, then closes RequestChan.
+//It can be called more than once, later calls return once the first has finished.
 func (s *Spawner) Stop() {
+	s.stopOnce.Do(s.stop)
+}
+
+func (s *Spawner) stop() {
+	s.scheduleMu.Lock()
 	s.Stopped = true
 	s.StopTime = time.Now()
-	for _, executor := range s.ExecutorPool {
-		executor.Stop()
-	}
+	s.scheduleMu.Unlock()
+	close(s.quit)
 
 	s.TimeoutTimer.Stop()
-	if (s.RequestOptions.IncreaseRateToFailure) {
-		s.Ticker.Stop()
+	if (s.ProfileTicker != nil) {
+		s.ProfileTicker.Stop()
 	}
 	s.OverallTicker.Stop()
+	//The scheduler and profile can grow the pool, so they have to have exited before the executors are stopped
+	s.background.Wait()
+
+	//Stopping an executor waits for its request to finish, which mustn't hold up the pool
+	s.poolMu.Lock()
+	pool := append([]*Executor{}, s.ExecutorPool...)
+	s.poolMu.Unlock()
+	for _, executor := range pool {
+		executor.Stop()
+	}
+	s.running.Wait()
+
+	close(s.RequestChan)
 }
 
 func (s *Spawner) SetupOverallStatsPipe() {
 	Log("spawn", fmt.Sprintln("Overall stats will be gathered every ",time.Millisecond * overallStatsTickerFrequency) )
 
 	s.OverallTicker = time.NewTicker(time.Millisecond * overallStatsTickerFrequency)
+	s.background.Add(1)
 	go func () {
-		for _ = range s.OverallTicker.C {
-			s.SendOverallStats()
+		defer s.background.Done()
+		for {
+			select {
+			case <- s.OverallTicker.C:
+				s.SendOverallStats()
+			case <- s.quit:
+				return
+			}
 		}
 	}()
 }
 
 func (s *Spawner) SendOverallStats() {
+	select {
+	case s.OverallStatsChan <- s.CurrentOverallStats():
+	case <- s.quit:
+	}
+}
+
+func (s *Spawner) CurrentOverallStats() OverallStats {
+	s.scheduleMu.Lock()
 	overallStats := OverallStats {
 		Rate : s.Rate,
-		NumExecutors : len(s.ExecutorPool),
+		TargetRate : s.TargetRate,
+		AchievedRate : s.achievedRate(time.Now()),
+		TargetConcurrency : s.TargetConcurrency,
 		StartTime : s.StartTime,
 		RequestsIssued : s.RequestsIssued,
+		RequestsIssuedByLabel : s.Selector.Issued(),
+		RequestsScheduled : s.RequestsScheduled,
+		RequestsDelayed : s.RequestsDelayed,
+		RequestsDropped : s.RequestsDropped,
+		TotalDelay : s.TotalDelay,
 	}
+	stopTime := s.StopTime
+	s.scheduleMu.Unlock()
 
+	s.poolMu.Lock()
+	overallStats.NumExecutors = len(s.ExecutorPool)
 	for _, executor := range s.ExecutorPool {
-		if !executor.IsExecuting {
+		if !executor.Executing() {
 			overallStats.NumAvailableExecutors += 1
 		} else {
 			overallStats.NumBusyExecutors += 1
 		}
 	}
+	s.poolMu.Unlock()
 
 	overallStats.TimeElapsed = time.Since(s.StartTime)
-	overallStats.TimeWaitingOnFinalReqs = time.Since(s.StopTime)
+	overallStats.TimeWaitingOnFinalReqs = time.Since(stopTime)
 	overallStats.TotalTestDuration = s.MaxExecutionTime
 	if (overallStats.TimeElapsed > overallStats.TotalTestDuration) {
 		overallStats.TimeElapsed = overallStats.TotalTestDuration
 	}
 
-	s.OverallStatsChan <- overallStats
+	return overallStats
+}
+
+//achievedRate works out the rate requests have been issued at over the last achievedRateWindow, scheduleMu must be held
+func (s *Spawner) achievedRate(now time.Time) float64 {
+	s.rateSamples = append(s.rateSamples, rateSample{Time : now, RequestsIssued : s.RequestsIssued})
+	for (len(s.rateSamples) > 2 && now.Sub(s.rateSamples[1].Time) >= achievedRateWindow) {
+		s.rateSamples = s.rateSamples[1:]
+	}
+
+	oldest := s.rateSamples[0]
+	elapsed := now.Sub(oldest.Time).Seconds()
+	if (elapsed <= 0) {
+		return 0
+	}
+	return float64(s.RequestsIssued - oldest.RequestsIssued) / elapsed
 }
 
 func (s *Spawner) SetupExecutorPool() {
 	Log("spawn", fmt.Sprintln("Adding ", s.Concurrency ,"executors to pool") )
 
-	s.ExecutorPool = make([]*Executor, s.Concurrency)
+	s.poolMu.Lock()
+	defer s.poolMu.Unlock()
+
+	s.ExecutorPool = make([]*Executor, 0, s.Concurrency)
 
 	for i:= 0; i < s.Concurrency; i++ {
-		newExecutor := NewExecutor(fmt.Sprint(i), s.RequestChan, s.StatsChan, s.RequestOptions)
+		s.addExecutor()
+	}
+}
 
-		if s.HasCustomClient() {
-			newExecutor.CustomClient = s.CustomClient
+//addExecutor starts a new executor and adds it to the pool, poolMu must be held
+func (s *Spawner) addExecutor() {
+	newExecutor := NewExecutor(fmt.Sprint(s.executorsAdded), s.RequestChan, s.StatsChan, s.RequestOptions)
+	s.executorsAdded += 1
+	newExecutor.Sequence = &s.TemplateSequence
+	newExecutor.Skipped = s.unissue
+	newExecutor.Context = s.Context
+
+	if s.HasCustomClient() {
+		newExecutor.CustomClient = s.CustomClient
+	}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		newExecutor.Start()
+	}()
+
+	s.ExecutorPool = append(s.ExecutorPool, newExecutor)
+}
+
+//growExecutorPool adds an executor if the pool is smaller than MaxConcurrency, returning false if it's already full
+func (s *Spawner) growExecutorPool() bool {
+	s.poolMu.Lock()
+	defer s.poolMu.Unlock()
+
+	if (len(s.ExecutorPool) >= s.MaxConcurrency) {
+		return false
+	}
+	Log("spawn", fmt.Sprintln("No executors are free, growing the pool to ", len(s.ExecutorPool) + 1) )
+	s.addExecutor()
+	return true
+}
+
+//resizeExecutorPool adds or retires executors until the pool is size, a retired executor finishes the request it has before it exits.
+//Retired executors leave the pool straight away, Stop still waits for them through running.
+func (s *Spawner) resizeExecutorPool(size int) {
+	s.poolMu.Lock()
+	defer s.poolMu.Unlock()
+
+	if (size != len(s.ExecutorPool)) {
+		Log("spawn", fmt.Sprintln("Resizing the pool from ", len(s.ExecutorPool), " to ", size, " executors") )
+	}
+	for (len(s.ExecutorPool) < size) {
+		s.addExecutor()
+	}
+	for (len(s.ExecutorPool) > size) {
+		s.ExecutorPool[len(s.ExecutorPool) - 1].Retire()
+		s.ExecutorPool = s.ExecutorPool[:len(s.ExecutorPool) - 1]
+	}
+}
+
+//SetupProfile follows the load profile, if there is one, by updating the rate and pool size every overall stats tick
+func (s *Spawner) SetupProfile() {
+	if (s.Profile == nil) {
+		return
+	}
+	Log("spawn", fmt.Sprintln("Following a load profile of ", len(s.Profile.Stages), " stages over ", s.Profile.Duration()) )
+
+	s.applyProfile(0)
+	s.ProfileTicker = time.NewTicker(time.Millisecond * overallStatsTickerFrequency)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		for {
+			select {
+			case <- s.ProfileTicker.C:
+				s.applyProfile(time.Since(s.StartTime))
+			case <- s.quit:
+				return
+			}
 		}
+	}()
+}
 
-		go newExecutor.Start()
+func (s *Spawner) applyProfile(elapsed time.Duration) {
+	rate, concurrency := s.Profile.At(elapsed)
+
+	if (s.Profile.HasTargetType(RateTarget)) {
+		s.SetRate(rate)
+	}
 
-		s.ExecutorPool[i] = newExecutor
+	if (s.Profile.HasTargetType(ConcurrencyTarget)) {
+		s.scheduleMu.Lock()
+		s.TargetConcurrency = concurrency
+		s.scheduleMu.Unlock()
+		s.resizeExecutorPool(concurrency)
 	}
 }
 
+//profileFinished is true once every stage of the load profile has run
+func (s *Spawner) profileFinished() bool {
+	return s.Profile != nil && time.Since(s.StartTime) >= s.Profile.Duration()
+}
+
 func (s *Spawner) StartRequests() {
-	if s.RequestOptions.IncreaseRateToFailure {
-		s.Ticker = time.NewTicker(time.Second*tickerSecFrequency)
-		go func() {
-			for _ = range s.Ticker.C {
-				if (s.Stopped) { continue }
-				Log("spawn", fmt.Sprintln(" Requests are rate limited - triggering set of ", s.Rate, " requests at ", time.Now()))
-				s.mu.Lock()
-				for i := 0; i < int(s.Rate); i++ {
-					if (s.RequestsIssued < s.RequestsToIssue) {
-						s.RequestsIssued += 1
-						s.RequestChan <- true
-					} else {
-						s.Cleanup()
-						s.Stop()
-						s.Done <- true
-						break
-					}
-				}
-				s.mu.Unlock()
-			}
-		}()
+	if (s.Arrival == ConstantArrival || s.Arrival == PoissonArrival) {
+		s.StartScheduledRequests()
 	} else {
 		Log("spawn", fmt.Sprintln("Requests are limited by total quantity, ", s.RequestsToIssue, " requests have been buffered on the channel"))
+		s.background.Add(1)
 		go func() {
-			for i := 0; i < s.RequestsToIssue; i++ {
-				if (s.Stopped) {
+			defer s.background.Done()
+			//Requests an executor skips are given back through unissue, so the count is checked each time rather than looping RequestsToIssue times
+			for {
+				s.scheduleMu.Lock()
+				finished := s.Stopped || s.RequestsIssued >= s.RequestsToIssue || s.profileFinished()
+				s.scheduleMu.Unlock()
+				if (finished) {
 					break
 				}
-				s.RequestsIssued += 1
-				s.RequestChan <- true
+				intendedTime := time.Now()
+				if (!s.send(ScheduledRequest{Definition : s.Selector.Next(), IntendedTime : intendedTime})) {
+					break
+				}
+				s.recordIssued(false, intendedTime)
 			}
 		}()
 	}
 }
 
+//StartScheduledRequests issues requests as an open model, arrivals are scheduled at Rate req/s whether or not the executors keep up.
+//Arrivals are evenly spaced, or for poisson arrival spaced by an exponential distribution with the same mean.
+//When no executor is free the pool grows up to MaxConcurrency, past that a request is either delayed until one is free or dropped.
+func (s *Spawner) StartScheduledRequests() {
+	Log("spawn", fmt.Sprintln("Requests are scheduled with ", s.Arrival, " arrival at ", s.Rate, " req/s"))
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		intendedTime := time.Now()
+		for {
+			interval, scheduled := s.nextInterval()
+			intendedTime = intendedTime.Add(interval)
+			if (!s.wait(intendedTime.Sub(time.Now()))) {
+				break
+			}
+
+			s.scheduleMu.Lock()
+			finished := s.Stopped || s.RequestsIssued >= s.RequestsToIssue || s.profileFinished()
+			s.scheduleMu.Unlock()
+			if (finished) {
+				break
+			}
+
+			if (scheduled) {
+				s.scheduleRequest(intendedTime)
+			}
+		}
+	}()
+}
+
+//SetRate changes the rate scheduled requests are issued at
+func (s *Spawner) SetRate(rate float64) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	s.Rate = rate
+	s.TargetRate = rate
+}
+
+//IsStopped is true once the spawner has been stopped
+func (s *Spawner) IsStopped() bool {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	return s.Stopped
+}
+
+//IssuedAndDropped returns how many requests have been issued and how many scheduled requests were dropped so far
+func (s *Spawner) IssuedAndDropped() (issued int, dropped int) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	return s.RequestsIssued, s.RequestsDropped
+}
+
+//nextInterval is the time until the next arrival at the current rate.
+//While the rate is 0, as it can be during a load profile, scheduled is false and the rate is checked again after a short wait.
+func (s *Spawner) nextInterval() (interval time.Duration, scheduled bool) {
+	s.scheduleMu.Lock()
+	rate := s.Rate
+	s.scheduleMu.Unlock()
+
+	if (rate <= 0) {
+		return time.Millisecond * overallStatsTickerFrequency, false
+	}
+	meanInterval := float64(time.Second) / rate
+	if (s.Arrival == PoissonArrival) {
+		return time.Duration(rand.ExpFloat64() * meanInterval), true
+	}
+	return time.Duration(meanInterval), true
+}
+
+func (s *Spawner) scheduleRequest(intendedTime time.Time) {
+	request := ScheduledRequest{Definition : s.Selector.Next(), IntendedTime : intendedTime}
+
+	s.scheduleMu.Lock()
+	s.RequestsScheduled += 1
+	s.scheduleMu.Unlock()
+
+	select {
+	case s.RequestChan <- request:
+		s.recordIssued(true, intendedTime)
+		return
+	default:
+	}
+
+	if (s.growExecutorPool()) {
+		if (s.send(request)) {
+			s.recordIssued(true, intendedTime)
+		}
+		return
+	}
+
+	if (s.Overflow == DropOverflow) {
+		s.Selector.Drop(request.Definition)
+		s.scheduleMu.Lock()
+		s.RequestsDropped += 1
+		s.scheduleMu.Unlock()
+		return
+	}
+
+	if (s.send(request)) {
+		s.recordIssued(true, intendedTime)
+	}
+}
+
+//send hands the request to an executor, waiting for one to be free, it returns false if the spawner stopped first
+func (s *Spawner) send(request ScheduledRequest) bool {
+	select {
+	case s.RequestChan <- request:
+		return true
+	case <- s.quit:
+		s.Selector.Drop(request.Definition)
+		return false
+	}
+}
+
+//wait sleeps for duration, it returns false if the spawner stopped first
+func (s *Spawner) wait(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <- timer.C:
+		return true
+	case <- s.quit:
+		return false
+	}
+}
+
+//recordIssued counts a request that was handed to an executor. A scheduled request sent more than scheduleTolerance after its
+//intended time is delayed, whether it waited for an executor itself or was queued behind one that did.
+func (s *Spawner) recordIssued(scheduled bool, intendedTime time.Time) {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	s.RequestsIssued += 1
+	delay := time.Since(intendedTime)
+	if (scheduled && delay > scheduleTolerance) {
+		s.RequestsDelayed += 1
+		s.TotalDelay += delay
+	}
+}
+
+//unissue takes back a request an executor was handed but didn't issue, such as when the feeder has run out
+func (s *Spawner) unissue(definition *RequestDefinition) {
+	s.Selector.Drop(definition)
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	s.RequestsIssued -= 1
+}
+
 func (s *Spawner) HasCustomClient() bool {
 	if (s.CustomClient != nil && s.CustomClient.Transport != nil) {
 		return true
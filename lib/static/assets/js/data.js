@@ -34,6 +34,16 @@ $( "#failures-btn").bind( "click", function(){
     setSections();
 });
 
+$( "#endpoints-btn").bind( "click", function(){
+    currentSection = "endpoints"
+    setSections();
+});
+
+$( "#timeline-btn").bind( "click", function(){
+    currentSection = "timeline"
+    setSections();
+});
+
 $( "#raw-btn").bind( "click", function(){
     currentSection = "raw"
     setSections();
@@ -60,6 +70,12 @@ function setSections(){
     } else if (currentSection === "failures") {
         $("#failures").css("display", "inherit");
         $("#failures-btn").closest("li").addClass("active");
+    } else if (currentSection === "endpoints") {
+        $("#endpoints").css("display", "inherit");
+        $("#endpoints-btn").closest("li").addClass("active");
+    } else if (currentSection === "timeline") {
+        $("#timeline").css("display", "inherit");
+        $("#timeline-btn").closest("li").addClass("active");
     } else if (currentSection === "raw") {
         $("#raw").css("display", "inherit");
         $("#raw-btn").closest("li").addClass("active");
@@ -82,6 +98,10 @@ function hideAllSections(){
     $("#latencies-btn").closest("li").removeClass("active");
     $("#failures").css("display", "none");
     $("#failures-btn").closest("li").removeClass("active");
+    $("#endpoints").css("display", "none");
+    $("#endpoints-btn").closest("li").removeClass("active");
+    $("#timeline").css("display", "none");
+    $("#timeline-btn").closest("li").removeClass("active");
     $("#raw").css("display", "none");
     $("#raw-btn").closest("li").removeClass("active");
 }
@@ -110,8 +130,9 @@ socket.on('connect', function(data){
     try {
         latestData = JSON.parse(event);
         latestData.Latest.RawStats = "";
-        latestData.Latest.OverallStats = "";
+        latestData.Latest.Overall = "";
         latestData.Latest.FailureCounts = "";
+        latestData.Latest.Buckets = "";
 
         render(latestData);
     } catch (e) {
@@ -135,6 +156,10 @@ function render(latestData) {
         setLatencies(latestData);
     } else if (currentSection === "failures") {
         setFailures(latestData);
+    } else if (currentSection === "endpoints") {
+        setEndpoints(latestData);
+    } else if (currentSection === "timeline") {
+        setTimeline(latestData);
     } else if (currentSection === "raw") {
         $( "#latest").text(JSON.stringify(latestData, null, 2));
     }
@@ -221,6 +246,10 @@ function setStatus(data) {
     $("#max-execution-time").text(data.TotalTime)
     $("#connected").text(connected)
     $("#startTime").text(data.Latest.StartTime)
+    $("#arrival").text(data.ReqOpts.Arrival)
+    $("#executors").text(data.Latest.MaxConcurrentExecutors + " / " + data.ReqOpts.MaxConcurrency)
+    $("#reqs-delayed").text(data.Latest.RequestsDelayed + " (mean " + Math.round(data.Latest.MeanDelay / 1000000 * 100) / 100 + "ms)")
+    $("#reqs-dropped").text(data.Latest.RequestsDropped)
     if (data.TimeElapsed === data.TotalTime) {
         $("#finished").text("Yes")
     } else {
@@ -235,6 +264,7 @@ function setThroughput(data) {
     $("#mean-throughput-kb").text( Math.round(data.Latest.AverageByteThroughput / 1000 * 100) / 100  + " kb/s" )
     $(".mean-throughput-resp").text( Math.round(data.Latest.AverageRespThroughput * 100) / 100 + " resp/s" )
     $(".throughput-chart-note").text("(One out of every " + data.RespThroughPutSampling + " items rendered)")
+    setSearch(data)
 
     if (!googleLoaded) {
         return
@@ -300,6 +330,33 @@ function setThroughput(data) {
 
     var chart = new google.visualization.LineChart( document.getElementById('throughput-kb-chart') );
     chart.draw(throughputBytes, options);
+
+    $(".rate-chart-note").text("(One out of every " + data.RateSampling + " items rendered)")
+
+    var rates = new google.visualization.DataTable();
+    rates.addColumn('string', 'Time');
+    rates.addColumn('number', 'Target req/s');
+    rates.addColumn('number', 'Achieved req/s');
+
+    var rateRows = []
+    data.SampledTargetRates.forEach( function (targetRate, index) {
+        rateRows.push(["", targetRate, data.SampledAchievedRates[index] ])
+    })
+    rates.addRows(rateRows);
+
+    var options = {
+    hAxis: {
+      textPosition: 'none',
+        gridlines: {
+            color: 'transparent'
+        },
+    },
+    height: 150,
+    legend: {position: 'bottom'},
+    }
+
+    var chart = new google.visualization.LineChart( document.getElementById('rate-chart') );
+    chart.draw(rates, options);
 }
 
 function setLatencies(data) {
@@ -310,6 +367,7 @@ function setLatencies(data) {
     $(".top-percentile-time").text(data.TopPercentileTime + "s")
     $(".top-percentile-title").text(data.TopPercentileTimeTitle + " Response Time")
     $(".histogram").text("(Latencies in seconds, one out of every " + data.ResponseLatencySampling + " items rendered)")
+    $(".response-time-note").text("(" + data.TopPercentileTimeTitle + "response time measured from when each request was meant to be sent: " + data.TopResponseTimePercentileTime + "s)")
 
     if (!googleLoaded) {
         return
@@ -318,7 +376,7 @@ function setLatencies(data) {
     var percentiles = []
 
     data.Latest.Percentiles.forEach( function (percentile, index) {
-        percentiles.push([percentile * 100 + "%", data.LatestTotalPercentiles[index]])
+        percentiles.push([percentile * 100 + "%", data.LatestTotalPercentiles[index], data.LatestResponseTimePercentiles[index]])
     })
 
     var options = {
@@ -328,12 +386,13 @@ function setLatencies(data) {
         vAxis: {
           title: 'Latency(s)'
         },
-        legend: {position: 'none'},
+        legend: {position: 'bottom'},
     };
 
     var totalPercentiles = new google.visualization.DataTable();
     totalPercentiles.addColumn('string', 'Total Percentiles');
-    totalPercentiles.addColumn('number', 'Latency (s)');
+    totalPercentiles.addColumn('number', 'Service Time (s)');
+    totalPercentiles.addColumn('number', 'From Intended Send (s)');
 
     totalPercentiles.addRows(percentiles);
 
@@ -410,6 +469,85 @@ function setLatencies(data) {
 
         var chart = new google.visualization.Histogram(document.getElementById('connect-latency-histogram'));
         chart.draw(histData, options);
+
+    setPhases(data)
+}
+
+function setPhases(data) {
+    if (data.Phases == null) {
+        return
+    }
+    $(".phase-note").text("(Latencies in seconds, requests that skipped a phase aren't counted for it, " + data.ConnectionsReused + " requests reused a connection)")
+
+    var phaseLatencies = new google.visualization.DataTable();
+    phaseLatencies.addColumn('string', 'Percentiles');
+    data.Phases.forEach( function (phase) {
+        phaseLatencies.addColumn('number', phase.Name);
+    })
+
+    var percentiles = []
+    data.Latest.Percentiles.forEach( function (percentile, index) {
+        var row = [percentile * 100 + "%"]
+        data.Phases.forEach( function (phase) {
+            row.push( phase.Percentiles == null ? null : phase.Percentiles[index] )
+        })
+        percentiles.push(row)
+    })
+    phaseLatencies.addRows(percentiles);
+
+    var options = {
+        hAxis: {
+          title: 'Percentiles'
+        },
+        vAxis: {
+          title: 'Latency(s)'
+        },
+        legend: {position: 'bottom'},
+    };
+
+    var chart = new google.visualization.LineChart( document.getElementById('phase-latency-chart') );
+    chart.draw(phaseLatencies, options);
+
+    var histograms = $("#phase-histograms")
+    data.Phases.forEach( function (phase, index) {
+        var id = "phase-histogram-" + index
+        if ($("#" + id).length === 0) {
+            histograms.append(
+                $("<div class='col-sm-6 col-md-4'></div>").append(
+                    $("<div class='chart-wrapper'></div>")
+                        .append( $("<div class='chart-title'></div>").text(phase.Name + " Histogram") )
+                        .append( $("<div class='chart-stage'></div>").append( $("<div></div>").attr("id", id) ) )
+                        .append( $("<div class='chart-notes'></div>").attr("id", id + "-note") )
+                )
+            )
+        }
+        $("#" + id + "-note").text("(Max " + phase.MaxTime + "s, one out of every " + phase.LatencySampling + " items rendered)")
+
+        if (phase.SampledLatencies == null || phase.SampledLatencies.length === 0) {
+            return
+        }
+
+        var phaseHistData = [['Latencies']]
+        phase.SampledLatencies.forEach( function (histTime) {
+            phaseHistData.push([histTime])
+        })
+
+        var options = {
+            hAxis: {
+              title: 'Latency(s)'
+            },
+            vAxis: {
+              title: 'Count'
+            },
+            chartArea: {
+               height: '40%'
+            },
+            legend: {position: 'none'},
+        };
+
+        var chart = new google.visualization.Histogram(document.getElementById(id));
+        chart.draw(google.visualization.arrayToDataTable(phaseHistData), options);
+    })
 }
 
 function setFailures(data){
@@ -426,3 +564,161 @@ function setFailures(data){
     }
 }
 
+function setSearch(data){
+    if (!data.ReqOpts.IncreaseRateToFailure) {
+        $("#search").css("display", "none");
+        return
+    }
+    $("#search").css("display", "inherit");
+    $("#search-summary").text(data.SearchSummary)
+
+    var tbody = $("#searchTable").html("")
+    if (data.SearchLevels == null) {
+        return
+    }
+    data.SearchLevels.forEach( function (level) {
+        var row = $("<tr></tr>");
+        row.append( $("<td></td>").text(level.Rate) );
+        row.append( $("<td></td>").text(level.Result) );
+        row.append( $("<td></td>").text(level.Requests) );
+        row.append( $("<td></td>").text(level.Harvest) );
+        row.append( $("<td></td>").text(level.Yield) );
+        row.append( $("<td></td>").text(level.Throughput) );
+        row.append( $("<td></td>").text(level.MeanResponseTime) );
+        row.append( $("<td></td>").text(level.MaxResponseTime) );
+        row.append( $("<td></td>").text(level.Failure) );
+        tbody.append(row);
+    });
+}
+
+function setEndpoints(data){
+    var headRow = $("<tr></tr>");
+    ["Endpoint", "Requests", "Responses", "Failures", "% Harvest", "% Yield", "Mean", "Max"].forEach( function (title) {
+        headRow.append( $("<th></th>").text(title) );
+    });
+    data.PercentileTitles.forEach( function (title) {
+        headRow.append( $("<th></th>").text(title) );
+    });
+    $("#endpointTableHead").html("").append(headRow);
+
+    var tbody = $("#endpointTable").html("")
+    if (data.Endpoints == null) {
+        return
+    }
+    data.Endpoints.forEach( function (endpoint) {
+        var row = $("<tr></tr>");
+        row.append( $("<td></td>").text(endpoint.Label) );
+        row.append( $("<td></td>").text(endpoint.Requests) );
+        row.append( $("<td></td>").text(endpoint.Responses) );
+        row.append( $("<td></td>").text(endpoint.Failures) );
+        row.append( $("<td></td>").text(endpoint.Harvest) );
+        row.append( $("<td></td>").text(endpoint.Yield) );
+        row.append( $("<td></td>").text(endpoint.MeanResponseTime) );
+        row.append( $("<td></td>").text(endpoint.MaxResponseTime) );
+        (endpoint.TotalPercentiles || []).forEach( function (percentile) {
+            row.append( $("<td></td>").text(percentile) );
+        });
+        tbody.append(row);
+    });
+}
+
+function setTimeline(data){
+    var timeline = data.Timeline;
+    $("#timeline-req-rate").text(timeline.RequestRate);
+    $("#timeline-resp-rate").text(timeline.ResponseRate);
+    $("#timeline-error-rate").text(timeline.ErrorRate);
+    $("#timeline-kb-rate").text(timeline.KbRate);
+    $("#timeline-top-percentile").text(timeline.TopPercentileTime);
+    var topPercentile = data.Latest.Percentiles[data.Latest.Percentiles.length - 1] * 100;
+    $(".timeline-top-percentile-title").text("Recent " + topPercentile + "th Percentile Latency (s)");
+    $(".timeline-note").text("(Recent figures cover the last " + timeline.Window + ", one out of every " + timeline.Sampling + " seconds rendered)");
+
+    if (!googleLoaded) {
+        return
+    }
+
+    var options = {
+    hAxis: {
+      textPosition: 'none',
+        gridlines: {
+            color: 'transparent'
+        },
+    },
+    height: 200,
+    legend: {position: 'bottom'},
+    }
+
+    var requests = new google.visualization.DataTable();
+    requests.addColumn('string', 'Second');
+    requests.addColumn('number', 'Requests sent');
+    requests.addColumn('number', 'Responses');
+    requests.addColumn('number', 'Errors');
+    var requestRows = []
+    timeline.RequestsSent.forEach( function (requestsSent, index) {
+        requestRows.push(["", requestsSent, timeline.Responses[index], timeline.Errors[index] ])
+    })
+    requests.addRows(requestRows);
+    var chart = new google.visualization.LineChart( document.getElementById('timeline-requests-chart') );
+    chart.draw(requests, options);
+
+    var latencies = new google.visualization.DataTable();
+    latencies.addColumn('string', 'Second');
+    data.Latest.Percentiles.forEach( function (percentile) {
+        latencies.addColumn('number', (percentile * 100) + "th");
+    })
+    var latencyRows = []
+    timeline.RequestsSent.forEach( function (requestsSent, index) {
+        var row = [""]
+        timeline.Percentiles.forEach( function (percentileTimes) {
+            row.push(percentileTimes[index])
+        })
+        latencyRows.push(row)
+    })
+    latencies.addRows(latencyRows);
+    var chart = new google.visualization.LineChart( document.getElementById('timeline-latency-chart') );
+    chart.draw(latencies, options);
+
+    var errors = new google.visualization.DataTable();
+    errors.addColumn('string', 'Second');
+    var categories = timeline.ErrorCategories || [];
+    if (categories.length === 0) {
+        errors.addColumn('number', 'Errors');
+    }
+    categories.forEach( function (category) {
+        errors.addColumn('number', category);
+    })
+    var errorRows = []
+    timeline.RequestsSent.forEach( function (requestsSent, index) {
+        var row = [""]
+        if (categories.length === 0) {
+            row.push(0)
+        }
+        (timeline.ErrorsByCategory || []).forEach( function (categoryErrors) {
+            row.push(categoryErrors[index])
+        })
+        errorRows.push(row)
+    })
+    errors.addRows(errorRows);
+    var chart = new google.visualization.LineChart( document.getElementById('timeline-errors-chart') );
+    chart.draw(errors, options);
+
+    var kb = new google.visualization.DataTable();
+    kb.addColumn('string', 'Second');
+    kb.addColumn('number', 'kb/s');
+    var kbRows = []
+    timeline.KbPerSecond.forEach( function (kbPerSecond) {
+        kbRows.push(["", kbPerSecond])
+    })
+    kb.addRows(kbRows);
+    var chart = new google.visualization.LineChart( document.getElementById('timeline-kb-chart') );
+    chart.draw(kb, {
+    hAxis: {
+      textPosition: 'none',
+        gridlines: {
+            color: 'transparent'
+        },
+    },
+    height: 200,
+    legend: {position: 'none'},
+    });
+}
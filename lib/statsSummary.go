@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"time"
+)
+
+//FailureCount is how many times a failure occurred, along with the first occurrence
+type FailureCount struct {
+	Count int
+	Example DescriptiveError
+}
+
+//failureKey groups failures by category and description, unlike the error itself these leave out urls and other values that change every request
+func failureKey(failure DescriptiveError) string {
+	return failure.Category() + ": " + failure.Description()
+}
+
+//StatsSummary aggregates response stats as they arrive into counters and latency histograms,
+//so the stats of a test take the same memory however long it runs.
+//Latencies are only recorded for stats containing a response, see DoAnalysis.
+type StatsSummary struct {
+	Requests int
+	Responses int
+	ValidResponses int
+	//WrongStatusResponses counts the responses whose status code wasn't expected, they're responses but not valid ones
+	WrongStatusResponses int
+	Failures int
+	//FailureCounts is keyed by failureKey
+	FailureCounts map[string]FailureCount
+	//StatusCodes counts the requests by the status code of their response, 0 counts those that got no response
+	StatusCodes map[int]int
+
+	ResponseBytes int
+	ConnectionsReused int
+
+	TotalTime *LatencyHistogram
+	TimeToRespond *LatencyHistogram
+	TimeToConnect *LatencyHistogram
+	ResponseTime *LatencyHistogram
+
+	//Phases has a histogram for each of phaseNames, a phase is only recorded when the request went through it
+	Phases []*LatencyHistogram
+}
+
+func NewStatsSummary() *StatsSummary {
+	summary := &StatsSummary{
+		FailureCounts : make(map[string]FailureCount),
+		StatusCodes : make(map[int]int),
+		TotalTime : NewLatencyHistogram(),
+		TimeToRespond : NewLatencyHistogram(),
+		TimeToConnect : NewLatencyHistogram(),
+		ResponseTime : NewLatencyHistogram(),
+	}
+	for _ = range phaseNames {
+		summary.Phases = append(summary.Phases, NewLatencyHistogram())
+	}
+	return summary
+}
+
+//SummariseStats records each of the stats into a new summary
+func SummariseStats(stats []ResponseStats) *StatsSummary {
+	summary := NewStatsSummary()
+	for _, stat := range stats {
+		summary.Record(stat)
+	}
+	return summary
+}
+
+func (s *StatsSummary) Record(stat ResponseStats) {
+	s.Requests += 1
+	s.StatusCodes[stat.StatusCode] += 1
+
+	if (stat.Failure()) {
+		s.Failures += 1
+		for _, failure := range stat.Failures {
+			key := failureKey(failure)
+			failureCount, ok := s.FailureCounts[key]
+			if (!ok) {
+				failureCount.Example = failure
+			}
+			failureCount.Count += 1
+			s.FailureCounts[key] = failureCount
+		}
+	} else {
+		s.ValidResponses += 1
+	}
+
+	if (!DoAnalysis(stat)) {
+		return
+	}
+
+	s.Responses += 1
+	if (WrongStatus(stat)) {
+		s.WrongStatusResponses += 1
+	}
+	s.ResponseBytes += stat.ResponseBytes()
+	if (stat.Phases.ConnectionReused) {
+		s.ConnectionsReused += 1
+	}
+
+	s.TotalTime.Record(stat.TotalTime)
+	s.TimeToRespond.Record(stat.TimeToRespond)
+	s.TimeToConnect.Record(stat.TimeToConnect)
+	s.ResponseTime.Record(stat.ResponseTime())
+	for index, duration := range phaseDurations(stat.Phases) {
+		if (duration > 0) {
+			s.Phases[index].Record(duration)
+		}
+	}
+}
+
+//Merge adds the stats summarised by other to s
+func (s *StatsSummary) Merge(other *StatsSummary) {
+	s.Requests += other.Requests
+	s.Responses += other.Responses
+	s.ValidResponses += other.ValidResponses
+	s.WrongStatusResponses += other.WrongStatusResponses
+	s.Failures += other.Failures
+	s.ResponseBytes += other.ResponseBytes
+	s.ConnectionsReused += other.ConnectionsReused
+
+	for key, otherCount := range other.FailureCounts {
+		failureCount, ok := s.FailureCounts[key]
+		if (!ok) {
+			failureCount.Example = otherCount.Example
+		}
+		failureCount.Count += otherCount.Count
+		s.FailureCounts[key] = failureCount
+	}
+	for statusCode, count := range other.StatusCodes {
+		s.StatusCodes[statusCode] += count
+	}
+
+	s.TotalTime.Merge(other.TotalTime)
+	s.TimeToRespond.Merge(other.TimeToRespond)
+	s.TimeToConnect.Merge(other.TimeToConnect)
+	s.ResponseTime.Merge(other.ResponseTime)
+	for index, phase := range other.Phases {
+		s.Phases[index].Merge(phase)
+	}
+}
+
+//Copy returns a summary that won't change as more stats are recorded into s
+func (s *StatsSummary) Copy() *StatsSummary {
+	summary := NewStatsSummary()
+	summary.Merge(s)
+	return summary
+}
+
+//OverallSummary aggregates the overall stats the spawner sends every tick into the first and latest of them and running totals
+//of the pool size, so like StatsSummary it takes the same memory however long the test runs
+type OverallSummary struct {
+	First OverallStats
+	Latest OverallStats
+	Count int
+	TotalExecutors int
+	MaxExecutors int
+}
+
+func (s *OverallSummary) Record(stats OverallStats) {
+	if (s.Count == 0) {
+		s.First = stats
+	}
+	s.Latest = stats
+	s.Count += 1
+	s.TotalExecutors += stats.NumExecutors
+	if (stats.NumExecutors > s.MaxExecutors) {
+		s.MaxExecutors = stats.NumExecutors
+	}
+}
+
+//StatsWindow summarises the stats of the requests that were meant to be sent between Start and End
+type StatsWindow struct {
+	Start time.Time
+	End time.Time
+	Summary *StatsSummary
+}
+
+func (w *StatsWindow) Contains(stat ResponseStats) bool {
+	return !stat.IntendedTime.Before(w.Start) && stat.IntendedTime.Before(w.End)
+}
@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"errors"
+	"net/url"
+)
+
+func TestStatsSummary(t *testing.T) {
+	c.Convey("Failures group by category and description however many urls they happen on", t, func(){
+		summary := NewStatsSummary()
+		for _, rawURL := range []string{"http://localhost:1/users/1", "http://localhost:1/users/2", "http://localhost:1/users/3"} {
+			refused := *NewRequestExecutionError(&url.Error{Op : "Get", URL : rawURL, Err : errors.New("connection refused")})
+			summary.Record(ResponseStats{Failures : []DescriptiveError{refused}})
+		}
+		summary.Record(ResponseStats{StatusCode : 500, Failures : []DescriptiveError{*NewStatusCodeError(500)}})
+		summary.Record(ResponseStats{StatusCode : 503, Failures : []DescriptiveError{*NewStatusCodeError(503)}})
+
+		c.So(len(summary.FailureCounts), c.ShouldEqual, 3)
+		refusals := summary.FailureCounts["RequestExecutionError: An error occurred executing the request connection refused"]
+		c.So(refusals.Count, c.ShouldEqual, 3)
+		c.So(refusals.Example.Error(), c.ShouldContainSubstring, "users/1")
+	})
+
+	c.Convey("Responses with the wrong status code are counted apart from requests that got no response", t, func(){
+		summary := NewStatsSummary()
+		summary.Record(ResponseStats{StatusCode : 200})
+		summary.Record(ResponseStats{StatusCode : 404, Failures : []DescriptiveError{*NewStatusCodeError(404)}})
+		summary.Record(ResponseStats{Failures : []DescriptiveError{*NewRequestExecutionError(errors.New("connection refused"))}})
+
+		other := NewStatsSummary()
+		other.Record(ResponseStats{StatusCode : 500, Failures : []DescriptiveError{*NewStatusCodeError(500)}})
+		summary.Merge(other)
+
+		c.So(summary.Responses, c.ShouldEqual, 3)
+		c.So(summary.ValidResponses, c.ShouldEqual, 1)
+		c.So(summary.WrongStatusResponses, c.ShouldEqual, 2)
+	})
+
+	c.Convey("The overall stats are kept as running totals", t, func(){
+		overall := OverallSummary{}
+		for _, executors := range []int{2, 6, 4} {
+			overall.Record(OverallStats{NumExecutors : executors, RequestsIssued : executors * 10})
+		}
+		c.So(overall.Count, c.ShouldEqual, 3)
+		c.So(overall.First.RequestsIssued, c.ShouldEqual, 20)
+		c.So(overall.Latest.RequestsIssued, c.ShouldEqual, 40)
+		c.So(AverageConcurrency(overall), c.ShouldEqual, 4)
+		c.So(MaxConcurrency(overall), c.ShouldEqual, 6)
+	})
+}
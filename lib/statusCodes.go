@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//StatusCodeRange is the status codes from Min to Max inclusive
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+//StatusCodes is the set of status codes a request expects, written as a list of codes and ranges such as 200-299,304
+type StatusCodes []StatusCodeRange
+
+//OnlyStatusCode is the set of just code
+func OnlyStatusCode(code int) StatusCodes {
+	return StatusCodes{{Min : code, Max : code}}
+}
+
+//ParseStatusCodes reads a comma separated list of status codes and ranges, such as 200-299,304
+func ParseStatusCodes(rawCodes string) (codes StatusCodes, err error) {
+	for _, rawRange := range strings.Split(rawCodes, ",") {
+		rawRange = strings.TrimSpace(rawRange)
+		if (rawRange == "") { continue }
+
+		bounds := strings.SplitN(rawRange, "-", 2)
+		codeRange := StatusCodeRange{}
+		codeRange.Min, err = parseStatusCode(bounds[0])
+		if (err == nil) {
+			codeRange.Max = codeRange.Min
+			if (len(bounds) == 2) {
+				codeRange.Max, err = parseStatusCode(bounds[1])
+			}
+		}
+		if (err != nil || codeRange.Max < codeRange.Min) {
+			return nil, errors.New(fmt.Sprintf("Unknown status codes '%v', expected codes and ranges such as 200-299,304", rawCodes))
+		}
+		codes = append(codes, codeRange)
+	}
+	if (len(codes) == 0) {
+		return nil, errors.New("At least one status code is expected")
+	}
+	return codes, nil
+}
+
+func parseStatusCode(rawCode string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(rawCode))
+	if (err != nil || code < 100 || code > 999) {
+		return 0, errors.New(fmt.Sprintf("'%v' is not a status code", rawCode))
+	}
+	return code, nil
+}
+
+func (s StatusCodes) Contains(code int) bool {
+	for _, codeRange := range s {
+		if (code >= codeRange.Min && code <= codeRange.Max) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s StatusCodes) String() string {
+	ranges := []string{}
+	for _, codeRange := range s {
+		if (codeRange.Min == codeRange.Max) {
+			ranges = append(ranges, strconv.Itoa(codeRange.Min))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%v-%v", codeRange.Min, codeRange.Max))
+		}
+	}
+	return strings.Join(ranges, ",")
+}
+
+//UnmarshalJSON accepts a single code such as 201, a string such as "200-299,304" or a list of either
+func (s *StatusCodes) UnmarshalJSON(data []byte) error {
+	var code int
+	if (json.Unmarshal(data, &code) == nil) {
+		codes, err := ParseStatusCodes(strconv.Itoa(code))
+		*s = codes
+		return err
+	}
+
+	var rawCodes string
+	if (json.Unmarshal(data, &rawCodes) == nil) {
+		codes, err := ParseStatusCodes(rawCodes)
+		*s = codes
+		return err
+	}
+
+	var list []json.RawMessage
+	err := json.Unmarshal(data, &list)
+	if (err != nil) {
+		return errors.New(fmt.Sprintf("Unknown status codes %v, expected a code, a string such as \"200-299,304\" or a list", string(data)))
+	}
+	codes := StatusCodes{}
+	for _, item := range list {
+		itemCodes := StatusCodes{}
+		err = itemCodes.UnmarshalJSON(item)
+		if (err != nil) {
+			return err
+		}
+		codes = append(codes, itemCodes...)
+	}
+	*s = codes
+	return nil
+}
+
+func (s StatusCodes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"encoding/json"
+	"net/http"
+)
+
+func TestStatusCodes(t *testing.T) {
+	c.Convey("Codes and ranges are parsed into a set", t, func(){
+		codes, err := ParseStatusCodes("200-299, 304")
+		c.So(err, c.ShouldBeNil)
+		c.So(codes.String(), c.ShouldEqual, "200-299,304")
+		c.So(codes.Contains(204), c.ShouldBeTrue)
+		c.So(codes.Contains(304), c.ShouldBeTrue)
+		c.So(codes.Contains(301), c.ShouldBeFalse)
+
+		for _, invalid := range []string{"", "ok", "299-200", "20", "200-"} {
+			_, err = ParseStatusCodes(invalid)
+			c.So(err, c.ShouldNotBeNil)
+		}
+	})
+
+	c.Convey("A request definition accepts a code, a string or a list", t, func(){
+		for raw, expected := range map[string]string{`404`: "404", `"200-299,304"`: "200-299,304", `[200, "204-206"]`: "200,204-206"} {
+			definition := RequestDefinition{}
+			c.So(json.Unmarshal([]byte(`{"responseCode": ` + raw + `}`), &definition), c.ShouldBeNil)
+			c.So(definition.ResponseCodes.String(), c.ShouldEqual, expected)
+		}
+		c.So(json.Unmarshal([]byte(`{"responseCode": true}`), &RequestDefinition{}), c.ShouldNotBeNil)
+	})
+
+	c.Convey("A response outside the set still counts as a response, but not a valid one", t, func(){
+		err := ValidateStatusCode(OnlyStatusCode(404), &http.Response{StatusCode : 200})
+		c.So(err, c.ShouldNotBeNil)
+		c.So(ValidateStatusCode(OnlyStatusCode(404), &http.Response{StatusCode : 404}), c.ShouldBeNil)
+
+		summary := SummariseStats([]ResponseStats{
+			{StatusCode : 200},
+			{StatusCode : 500, Failures : []DescriptiveError{err}},
+		})
+		c.So(summary.Responses, c.ShouldEqual, 2)
+		c.So(summary.ValidResponses, c.ShouldEqual, 1)
+		c.So(Harvest(summary.Responses, summary.Requests), c.ShouldEqual, 100)
+		c.So(Yield(summary.Responses, summary.ValidResponses), c.ShouldEqual, 50)
+	})
+}
@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+)
+
+var chartColours = []string{"#3366cc", "#dc3912", "#ff9900", "#109618", "#990099", "#0099c6", "#dd4477", "#66aa00"}
+
+const (
+	chartWidth = 560.0
+	chartHeight = 260.0
+	chartMarginLeft = 60.0
+	chartMarginRight = 15.0
+	chartMarginTop = 30.0
+	chartMarginBottom = 45.0
+	chartYTicks = 4
+	chartMaxXLabels = 8
+)
+
+//ChartSeries is a named line on a LineChart
+type ChartSeries struct {
+	Name string
+	Values []float64
+}
+
+//LineChart is drawn as inline SVG, so the static HTML report needs no charting library to load
+type LineChart struct {
+	XTitle string
+	YTitle string
+	//XLabels names each point, when it's empty the points are numbered in steps of XStep
+	XLabels []string
+	XStep float64
+	Series []ChartSeries
+}
+
+//SVG draws the chart, or a note that there's nothing to draw when none of the series have values
+func (l LineChart) SVG() template.HTML {
+	points, maxValue := 0, 0.0
+	for _, series := range l.Series {
+		if (len(series.Values) > points) {
+			points = len(series.Values)
+		}
+		for _, value := range series.Values {
+			maxValue = math.Max(maxValue, value)
+		}
+	}
+	if (points == 0) {
+		return template.HTML(`<p class="text-muted">No data was recorded</p>`)
+	}
+	maxValue = niceCeiling(maxValue)
+
+	plotWidth := chartWidth - chartMarginLeft - chartMarginRight
+	plotHeight := chartHeight - chartMarginTop - chartMarginBottom
+	x := func(index int) float64 {
+		if (points == 1) {
+			return chartMarginLeft + plotWidth / 2
+		}
+		return chartMarginLeft + float64(index) * plotWidth / float64(points - 1)
+	}
+	y := func(value float64) float64 {
+		return chartMarginTop + plotHeight - value / maxValue * plotHeight
+	}
+
+	buf := bytes.NewBufferString("")
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %v %v" width="100%%" font-family="sans-serif" font-size="11">`, chartWidth, chartHeight)
+
+	for tick := 0; tick <= chartYTicks; tick++ {
+		value := maxValue * float64(tick) / chartYTicks
+		fmt.Fprintf(buf, `<line x1="%v" y1="%.1f" x2="%v" y2="%.1f" stroke="#e0e0e0"/>`, chartMarginLeft, y(value), chartMarginLeft + plotWidth, y(value))
+		fmt.Fprintf(buf, `<text x="%v" y="%.1f" text-anchor="end" fill="#666">%.4g</text>`, chartMarginLeft - 5, y(value) + 4, value)
+	}
+
+	labelEvery := int(math.Ceil(float64(points) / chartMaxXLabels))
+	for index := 0; index < points; index += labelEvery {
+		label := fmt.Sprintf("%.4g", float64(index) * l.XStep)
+		if (len(l.XLabels) > 0) {
+			if (index >= len(l.XLabels)) {
+				break
+			}
+			label = l.XLabels[index]
+		}
+		fmt.Fprintf(buf, `<text x="%.1f" y="%v" text-anchor="middle" fill="#666">%v</text>`, x(index), chartMarginTop + plotHeight + 15, template.HTMLEscapeString(label))
+	}
+	fmt.Fprintf(buf, `<text x="%v" y="%v" text-anchor="middle" fill="#333">%v</text>`, chartMarginLeft + plotWidth / 2, chartHeight - 8, template.HTMLEscapeString(l.XTitle))
+	fmt.Fprintf(buf, `<text x="12" y="%v" text-anchor="middle" fill="#333" transform="rotate(-90 12 %v)">%v</text>`, chartMarginTop + plotHeight / 2, chartMarginTop + plotHeight / 2, template.HTMLEscapeString(l.YTitle))
+
+	legendX := chartMarginLeft
+	for index, series := range l.Series {
+		colour := chartColours[index % len(chartColours)]
+		fmt.Fprintf(buf, `<rect x="%.1f" y="8" width="10" height="10" fill="%v"/>`, legendX, colour)
+		fmt.Fprintf(buf, `<text x="%.1f" y="17" fill="#333">%v</text>`, legendX + 14, template.HTMLEscapeString(series.Name))
+		legendX += 24 + float64(len(series.Name)) * 6
+
+		if (len(series.Values) == 1) {
+			fmt.Fprintf(buf, `<circle cx="%.1f" cy="%.1f" r="3" fill="%v"/>`, x(0), y(series.Values[0]), colour)
+			continue
+		}
+		fmt.Fprintf(buf, `<polyline fill="none" stroke="%v" stroke-width="1.5" points="`, colour)
+		for index, value := range series.Values {
+			fmt.Fprintf(buf, "%.1f,%.1f ", x(index), y(value))
+		}
+		buf.WriteString(`"/>`)
+	}
+
+	buf.WriteString(`</svg>`)
+	return template.HTML(buf.String())
+}
+
+//niceCeiling rounds up to 1, 2 or 5 times a power of ten so the axis labels are readable
+func niceCeiling(value float64) float64 {
+	if (value <= 0) {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if (value <= step * magnitude) {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
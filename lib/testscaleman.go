@@ -1,10 +1,24 @@
 package lib
 
+import (
+	"fmt"
+	"os"
+)
+
 func DoScaleTest() {
+	if (len(os.Args) > 1) {
+		switch os.Args[1] {
+		case "compare":
+			os.Exit(DoCompare(os.Args[2:], os.Stdout))
+		case "openapi":
+			os.Exit(DoOpenAPIImport(os.Args[2:], os.Stdout))
+		}
+	}
 
 	reqOpts, outOpts, err := digestOptions()
 	if (err != nil) {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitConfigurationError)
 	}
 
 	choreographer := NewChoreographer(reqOpts, outOpts)
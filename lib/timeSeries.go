@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"time"
+)
+
+const metricsBucketWidth = time.Second
+const rollingWindowBuckets = 10
+
+//MetricsBucket holds the stats of one second of the test.
+//Requests are counted in the bucket they were sent in, responses, errors, bytes and latencies in the bucket they finished in.
+type MetricsBucket struct {
+	Start time.Time
+
+	RequestsSent int
+	Responses int
+	Errors int
+	ErrorsByCategory map[string]int
+	ResponseBytes int
+
+	//TargetRate and AchievedRate are the latest the spawner reported during the bucket
+	TargetRate float64
+	AchievedRate float64
+
+	Percentiles []time.Duration
+	MeanTime time.Duration
+	MaxTime time.Duration
+
+	//histogram is dropped once the bucket is out of the rolling window, its percentiles are kept
+	histogram *LatencyHistogram
+}
+
+//RollingStats are the stats of the last few buckets, so a change part way through a test isn't averaged away like it is in the cumulative stats
+type RollingStats struct {
+	Window time.Duration
+
+	RequestsSent int
+	Responses int
+	Errors int
+	ErrorsByCategory map[string]int
+	ResponseBytes int
+
+	RequestRate float64
+	ResponseRate float64
+	ErrorRate float64
+	ByteRate float64
+
+	Percentiles []time.Duration
+	MeanTime time.Duration
+	MaxTime time.Duration
+}
+
+//TimeSeries splits the stats of a test into fixed width buckets from Start.
+//Only the buckets in the rolling window keep a latency histogram, so a long test adds a few counters a second.
+type TimeSeries struct {
+	Start time.Time
+	Width time.Duration
+	RollingBuckets int
+	Percentiles []float64
+
+	Buckets []*MetricsBucket
+}
+
+func NewTimeSeries(start time.Time, percentiles []float64) *TimeSeries {
+	return &TimeSeries{
+		Start : start,
+		Width : metricsBucketWidth,
+		RollingBuckets : rollingWindowBuckets,
+		Percentiles : percentiles,
+	}
+}
+
+func (t *TimeSeries) Record(stat ResponseStats) {
+	if (!stat.StartTime.IsZero()) {
+		t.bucket(stat.StartTime).RequestsSent += 1
+	}
+
+	finishTime := stat.FinishTime
+	if (finishTime.IsZero()) {
+		finishTime = time.Now()
+	}
+	bucket := t.bucket(finishTime)
+
+	if (stat.Failure()) {
+		bucket.Errors += 1
+		for _, failure := range stat.Failures {
+			bucket.ErrorsByCategory[failure.Category()] += 1
+		}
+	}
+
+	if (DoAnalysis(stat)) {
+		bucket.Responses += 1
+		bucket.ResponseBytes += stat.ResponseBytes()
+		if (stat.TotalTime > bucket.MaxTime) {
+			bucket.MaxTime = stat.TotalTime
+		}
+		if (bucket.histogram != nil) {
+			bucket.histogram.Record(stat.TotalTime)
+		}
+	}
+}
+
+//RecordOverall keeps the rates of the overall stats reported at in the bucket covering it
+func (t *TimeSeries) RecordOverall(stats OverallStats, at time.Time) {
+	bucket := t.bucket(at)
+	bucket.TargetRate = stats.TargetRate
+	bucket.AchievedRate = stats.AchievedRate
+}
+
+//bucket returns the bucket covering at, adding buckets up to it and closing those that have left the rolling window
+func (t *TimeSeries) bucket(at time.Time) *MetricsBucket {
+	index := int(at.Sub(t.Start) / t.Width)
+	if (index < 0) {
+		index = 0
+	}
+
+	for (len(t.Buckets) <= index) {
+		t.Buckets = append(t.Buckets, &MetricsBucket{
+			Start : t.Start.Add(time.Duration(len(t.Buckets)) * t.Width),
+			ErrorsByCategory : make(map[string]int),
+			histogram : NewLatencyHistogram(),
+		})
+		closeIndex := len(t.Buckets) - 1 - t.RollingBuckets - 1
+		if (closeIndex >= 0) {
+			t.Buckets[closeIndex].close(t.Percentiles)
+		}
+	}
+	return t.Buckets[index]
+}
+
+func (b *MetricsBucket) close(percentiles []float64) {
+	if (b.histogram == nil) {
+		return
+	}
+	b.Percentiles = b.histogram.Percentiles(percentiles)
+	b.MeanTime = b.histogram.Mean()
+	b.histogram = nil
+}
+
+//Snapshot copies the last limit buckets up to now, or every bucket when limit isn't positive, working out the percentiles of the open ones, along with the stats of the rolling window
+func (t *TimeSeries) Snapshot(now time.Time, limit int) (buckets []MetricsBucket, rolling RollingStats) {
+	t.bucket(now)
+
+	copyFrom := 0
+	if (limit > 0 && len(t.Buckets) > limit) {
+		copyFrom = len(t.Buckets) - limit
+	}
+	for _, bucket := range t.Buckets[copyFrom:] {
+		bucketCopy := *bucket
+		bucketCopy.histogram = nil
+		bucketCopy.ErrorsByCategory = make(map[string]int)
+		for category, errors := range bucket.ErrorsByCategory {
+			bucketCopy.ErrorsByCategory[category] = errors
+		}
+		if (bucket.histogram != nil) {
+			bucketCopy.Percentiles = bucket.histogram.Percentiles(t.Percentiles)
+			bucketCopy.MeanTime = bucket.histogram.Mean()
+		}
+		buckets = append(buckets, bucketCopy)
+	}
+
+	firstIndex := len(t.Buckets) - t.RollingBuckets
+	if (firstIndex < 0) {
+		firstIndex = 0
+	}
+	rolling.ErrorsByCategory = make(map[string]int)
+	histogram := NewLatencyHistogram()
+	for _, bucket := range t.Buckets[firstIndex:] {
+		rolling.RequestsSent += bucket.RequestsSent
+		rolling.Responses += bucket.Responses
+		rolling.Errors += bucket.Errors
+		rolling.ResponseBytes += bucket.ResponseBytes
+		for category, errors := range bucket.ErrorsByCategory {
+			rolling.ErrorsByCategory[category] += errors
+		}
+		if (bucket.histogram != nil) {
+			histogram.Merge(bucket.histogram)
+		}
+	}
+
+	rolling.Window = now.Sub(t.Buckets[firstIndex].Start)
+	if (rolling.Window > 0) {
+		rolling.RequestRate = float64(rolling.RequestsSent) / rolling.Window.Seconds()
+		rolling.ResponseRate = float64(rolling.Responses) / rolling.Window.Seconds()
+		rolling.ErrorRate = float64(rolling.Errors) / rolling.Window.Seconds()
+		rolling.ByteRate = float64(rolling.ResponseBytes) / rolling.Window.Seconds()
+	}
+	rolling.Percentiles = histogram.Percentiles(t.Percentiles)
+	rolling.MeanTime = histogram.Mean()
+	rolling.MaxTime = time.Duration(histogram.Max)
+
+	return buckets, rolling
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"testing"
+	c "github.com/smartystreets/goconvey/convey"
+	"errors"
+	"time"
+)
+
+func TestTimeSeries(t *testing.T) {
+	c.Convey("With a series of stats across 30 seconds that slow down after 20", t, func(){
+		start := time.Now().Add(-time.Second * 30)
+		series := NewTimeSeries(start, []float64{0.5})
+		for second := 0; second < 30; second++ {
+			latency := time.Millisecond * 10
+			if (second >= 20) {
+				latency = time.Millisecond * 100
+			}
+			sent := start.Add(time.Duration(second) * time.Second)
+			series.Record(ResponseStats{StartTime : sent, FinishTime : sent.Add(latency), TotalTime : latency})
+		}
+		failed := start.Add(time.Second * 25)
+		series.Record(ResponseStats{
+			StartTime : failed,
+			FinishTime : failed,
+			Failures : []DescriptiveError{*NewRequestExecutionError(errors.New("refused"))},
+		})
+
+		buckets, rolling := series.Snapshot(start.Add(time.Millisecond * 30500), 0)
+
+		c.Convey("Each second has its own bucket", func(){
+			c.So(len(buckets), c.ShouldEqual, 31)
+			c.So(buckets[5].RequestsSent, c.ShouldEqual, 1)
+			c.So(buckets[5].Responses, c.ShouldEqual, 1)
+			c.So(buckets[5].Percentiles[0], c.ShouldEqual, time.Millisecond * 10)
+			c.So(buckets[25].Percentiles[0], c.ShouldEqual, time.Millisecond * 100)
+			c.So(buckets[25].Errors, c.ShouldEqual, 1)
+			c.So(buckets[25].ErrorsByCategory[NewRequestExecutionError(errors.New("refused")).Category()], c.ShouldEqual, 1)
+		})
+
+		c.Convey("The rolling window only covers the latest seconds", func(){
+			c.So(rolling.Window, c.ShouldEqual, time.Millisecond * 9500)
+			c.So(rolling.RequestsSent, c.ShouldEqual, 10)
+			c.So(rolling.Errors, c.ShouldEqual, 1)
+			c.So(rolling.Percentiles[0], c.ShouldEqual, time.Millisecond * 100)
+		})
+
+		c.Convey("A limited snapshot only copies the latest buckets but keeps the same rolling window", func(){
+			latest, latestRolling := series.Snapshot(start.Add(time.Millisecond * 30500), 10)
+			c.So(len(latest), c.ShouldEqual, 10)
+			c.So(latest[0].Start, c.ShouldEqual, buckets[21].Start)
+			c.So(latest[4].Errors, c.ShouldEqual, 1)
+			c.So(latest[9].Start, c.ShouldEqual, buckets[30].Start)
+			c.So(latestRolling.RequestsSent, c.ShouldEqual, rolling.RequestsSent)
+
+			all, _ := series.Snapshot(start.Add(time.Millisecond * 30500), 0)
+			c.So(len(all), c.ShouldEqual, 31)
+		})
+	})
+}